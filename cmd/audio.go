@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// DetectionActionRestartAudio recreates the PulseAudio null sink set up by start.sh
+// and then restarts the pipeline so Chrome and FFmpeg reconnect to it.
+const DetectionActionRestartAudio = "restartAudio"
+
+const (
+	// Default level below which audio counts as silent
+	DefaultSilenceNoiseLevel = -60
+	// PulseAudio sink created by start.sh that Chrome plays into and FFmpeg records from
+	pulseNullSink = "null_output"
+	// Instance names of the silence detector and level meter, used to find their output
+	silenceCheckFilterName = "silencecheck"
+	audioLevelFilterName   = "audiolevel"
+)
+
+var (
+	// FFmpeg prefixes a filter's log lines with its instance name, so
+	// "silencedetect@silencecheck" logs e.g. "[silencecheck @ 0x55d1c0a3e2c0] silence_start: 12.4"
+	silenceEventPattern = regexp.MustCompile(`\[` + silenceCheckFilterName + ` @ [^\]]*\] silence_(start|end):`)
+	// e.g. "[audiolevel @ 0x55d1c0a3e2c0] lavfi.astats.Overall.RMS_level=-23.5"
+	audioLevelPattern = regexp.MustCompile(`\[` + audioLevelFilterName + ` @ [^\]]*\] lavfi\.astats\.Overall\.RMS_level=(\S+)`)
+)
+
+// SilenceCheck configures silence detection on the stream's audio track.
+type SilenceCheck struct {
+	// How long audio may stay silent before Action is taken; 0 disables detection
+	Threshold time.Duration
+	// Level in dBFS below which audio counts as silent
+	NoiseLevel int
+	Action     string
+}
+
+// loadSilenceCheck reads SILENCE_THRESHOLD, SILENCE_NOISE_LEVEL and SILENCE_ACTION.
+func loadSilenceCheck(ctx context.Context) (SilenceCheck, error) {
+	action, err := loadDetectionAction("SILENCE_ACTION", DetectionActionLog, DetectionActionReload, DetectionActionRestartAudio)
+	if err != nil {
+		return SilenceCheck{}, err
+	}
+
+	check := SilenceCheck{
+		Threshold:  utils.GetSecondsFromEnv(ctx, "SILENCE_THRESHOLD", 0),
+		NoiseLevel: DefaultSilenceNoiseLevel,
+		Action:     action,
+	}
+	if levelStr := utils.GetEnvOrDefault("SILENCE_NOISE_LEVEL", ""); levelStr != "" {
+		level, err := strconv.Atoi(levelStr)
+		if err != nil || level >= 0 {
+			return SilenceCheck{}, fmt.Errorf("invalid SILENCE_NOISE_LEVEL %q: expected a negative dBFS value", levelStr)
+		}
+		check.NoiseLevel = level
+	}
+	return check, nil
+}
+
+// audioMonitor runs silencedetect and a once-per-second level meter on the audio
+// track and acts on the events FFmpeg prints once silence outlasts its threshold.
+type audioMonitor struct {
+	ctx            context.Context
+	config         *Config
+	check          SilenceCheck
+	primary        *chromeInstance
+	primaryDisplay int
+	logger         *zap.Logger
+	// act runs the configured action; replaceable in tests
+	act func()
+
+	mu sync.Mutex
+	// When the current silence began (zero while audio is playing)
+	silentSince time.Time
+	timer       *time.Timer
+}
+
+// newAudioMonitor returns a monitor for the pipeline's audio track, or nil when
+// silence detection is disabled. primary is the browser producing the audio.
+func newAudioMonitor(ctx context.Context, config *Config, primary *chromeInstance, primaryDisplay int) *audioMonitor {
+	if config.SilenceCheck.Threshold <= 0 {
+		return nil
+	}
+	m := &audioMonitor{
+		ctx:            ctx,
+		config:         config,
+		check:          config.SilenceCheck,
+		primary:        primary,
+		primaryDisplay: primaryDisplay,
+		logger:         utils.GetLoggerFromContext(ctx),
+	}
+	m.act = m.runAction
+	return m
+}
+
+// filterGraph returns filter_complex parts that meter the audio input and detect
+// silence on a copy of it, plus the label of the untouched copy to encode. Returns
+// no parts and the input itself when detection is disabled.
+func (m *audioMonitor) filterGraph(audioInputIdx int) ([]string, string) {
+	input := fmt.Sprintf("%d:a", audioInputIdx)
+	if m == nil {
+		return nil, input
+	}
+	return []string{
+		fmt.Sprintf("[%s]asplit=2[aout][ameter]", input),
+		// Regroup samples into one-second frames so the level is printed once per second
+		fmt.Sprintf("[ameter]silencedetect@%s=n=%ddB:d=%g,asetnsamples=n=44100:p=0,astats=metadata=1:reset=1,ametadata@%s=mode=print:key=lavfi.astats.Overall.RMS_level,anullsink",
+			silenceCheckFilterName, m.check.NoiseLevel, m.check.Threshold.Seconds(), audioLevelFilterName),
+	}, "[aout]"
+}
+
+// writer returns an io.Writer for FFmpeg's log output feeding the monitor.
+func (m *audioMonitor) writer() *lineWriter {
+	return &lineWriter{handle: m.handleLine}
+}
+
+func (m *audioMonitor) handleLine(line string) {
+	if match := audioLevelPattern.FindStringSubmatch(line); match != nil {
+		level, err := strconv.ParseFloat(match[1], 64)
+		if err != nil || math.IsInf(level, -1) {
+			// Digital silence is reported as -inf; clamp so the gauge stays plottable
+			level = -144
+		}
+		audioLevelDBFS.Set(level)
+		m.updateSilenceDuration()
+		return
+	}
+
+	match := silenceEventPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	if match[1] == "start" {
+		m.start()
+	} else {
+		m.end()
+	}
+}
+
+// start begins tracking silence. silencedetect only reports silence once it has lasted
+// the threshold, so the action runs straight away and repeats every threshold after.
+func (m *audioMonitor) start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		return
+	}
+	m.silentSince = time.Now().Add(-m.check.Threshold)
+
+	var fire func()
+	fire = func() {
+		m.mu.Lock()
+		if m.timer == nil {
+			m.mu.Unlock()
+			return
+		}
+		m.timer = time.AfterFunc(m.check.Threshold, fire)
+		silentFor := time.Since(m.silentSince)
+		m.mu.Unlock()
+
+		audioSilencesTotal.Inc()
+		m.logger.Error("Audio has been silent past threshold, taking action",
+			zap.Duration("silentFor", silentFor),
+			zap.Int("noiseLevel", m.check.NoiseLevel),
+			zap.String("action", m.check.Action))
+		m.act()
+	}
+	m.timer = time.AfterFunc(0, fire)
+	audioSilenceSeconds.Set(m.check.Threshold.Seconds())
+}
+
+// end stops tracking silence once FFmpeg reports audio again.
+func (m *audioMonitor) end() {
+	m.mu.Lock()
+	timer := m.timer
+	silentFor := time.Since(m.silentSince)
+	m.timer = nil
+	m.silentSince = time.Time{}
+	m.mu.Unlock()
+	if timer == nil {
+		return
+	}
+	timer.Stop()
+	audioSilenceSeconds.Set(0)
+	m.logger.Info("Audio recovered", zap.Duration("silentFor", silentFor))
+}
+
+// updateSilenceDuration refreshes the silence duration gauge while silent.
+func (m *audioMonitor) updateSilenceDuration() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.silentSince.IsZero() {
+		audioSilenceSeconds.Set(time.Since(m.silentSince).Seconds())
+	}
+}
+
+// stop cancels any pending action when the pipeline ends.
+func (m *audioMonitor) stop() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	m.silentSince = time.Time{}
+	audioSilenceSeconds.Set(0)
+}
+
+// runAction performs the configured action.
+func (m *audioMonitor) runAction() {
+	switch m.check.Action {
+	case DetectionActionReload:
+		if m.primary == nil {
+			return
+		}
+		reloadCtx, cancel := context.WithTimeout(m.primary.context(), chromeReloadTimeout)
+		defer cancel()
+		if err := chromedp.Run(reloadCtx, chromedp.Reload()); err != nil {
+			m.logger.Error("Failed to reload primary page after silence",
+				zap.Int("display", m.primaryDisplay), zap.Error(err))
+		}
+	case DetectionActionRestartAudio:
+		if err := restartAudioChain(m.ctx); err != nil {
+			m.logger.Error("Failed to restart audio chain", zap.Error(err))
+			return
+		}
+		if err := RestartStream(m.ctx, m.config); err != nil {
+			m.logger.Error("Failed to restart stream", zap.Error(err))
+		}
+	}
+}
+
+// restartAudioChain makes sure PulseAudio is running and the null sink from start.sh
+// exists and is the default, recreating whatever went missing.
+func restartAudioChain(ctx context.Context) error {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	if err := exec.CommandContext(ctx, "pactl", "info").Run(); err != nil {
+		logger.Warn("PulseAudio is not responding, starting it", zap.Error(err))
+		if out, err := exec.CommandContext(ctx, "pulseaudio", "--start", "--log-target=syslog", "--system=false").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to start pulseaudio: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	sinks, err := exec.CommandContext(ctx, "pactl", "list", "short", "sinks").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list pulseaudio sinks: %w", err)
+	}
+	if !strings.Contains(string(sinks), pulseNullSink) {
+		logger.Warn("PulseAudio null sink is missing, recreating it", zap.String("sink", pulseNullSink))
+		if out, err := exec.CommandContext(ctx, "pactl", "load-module", "module-null-sink",
+			"sink_name="+pulseNullSink, "sink_properties=device.description=Null_Output").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to create null sink: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	if out, err := exec.CommandContext(ctx, "pactl", "set-default-sink", pulseNullSink).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set default sink: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	logger.Info("Audio chain restarted")
+	return nil
+}
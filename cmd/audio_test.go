@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func testAudioMonitor(t *testing.T, threshold time.Duration) (*audioMonitor, chan struct{}) {
+	t.Helper()
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+	check := SilenceCheck{Threshold: threshold, NoiseLevel: DefaultSilenceNoiseLevel, Action: DetectionActionLog}
+	m := newAudioMonitor(ctx, &Config{SilenceCheck: check}, nil, 99)
+	if m == nil {
+		t.Fatal("Expected an audio monitor for an enabled check")
+	}
+	actions := make(chan struct{}, 10)
+	m.act = func() { actions <- struct{}{} }
+	t.Cleanup(m.stop)
+	return m, actions
+}
+
+func TestLoadSilenceCheck(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		t.Setenv("SILENCE_THRESHOLD", "")
+		t.Setenv("SILENCE_NOISE_LEVEL", "")
+		t.Setenv("SILENCE_ACTION", "")
+		check, err := loadSilenceCheck(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if check.Threshold != 0 || check.NoiseLevel != DefaultSilenceNoiseLevel || check.Action != DetectionActionLog {
+			t.Errorf("Unexpected defaults: %+v", check)
+		}
+		if newAudioMonitor(ctx, &Config{SilenceCheck: check}, nil, 99) != nil {
+			t.Error("Expected no audio monitor when detection is disabled")
+		}
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		t.Setenv("SILENCE_THRESHOLD", "30")
+		t.Setenv("SILENCE_NOISE_LEVEL", "-50")
+		t.Setenv("SILENCE_ACTION", "restartaudio")
+		check, err := loadSilenceCheck(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if check.Threshold != 30*time.Second || check.NoiseLevel != -50 || check.Action != DetectionActionRestartAudio {
+			t.Errorf("Unexpected check: %+v", check)
+		}
+	})
+
+	t.Run("Invalid Values", func(t *testing.T) {
+		t.Setenv("SILENCE_ACTION", "restart")
+		if _, err := loadSilenceCheck(ctx); err == nil {
+			t.Error("Expected error for unsupported action")
+		}
+		t.Setenv("SILENCE_ACTION", "")
+		t.Setenv("SILENCE_NOISE_LEVEL", "10")
+		if _, err := loadSilenceCheck(ctx); err == nil {
+			t.Error("Expected error for positive noise level")
+		}
+	})
+}
+
+func TestAudioMonitorFilterGraph(t *testing.T) {
+	var disabled *audioMonitor
+	if parts, label := disabled.filterGraph(2); parts != nil || label != "2:a" {
+		t.Errorf("Expected the raw audio input without a monitor, got %q %q", parts, label)
+	}
+
+	m, _ := testAudioMonitor(t, 15*time.Second)
+	parts, label := m.filterGraph(2)
+	if label != "[aout]" {
+		t.Errorf("Expected [aout] to be encoded, got %q", label)
+	}
+	graph := strings.Join(parts, ";")
+	for _, want := range []string{"[2:a]asplit=2[aout][ameter]", "silencedetect@silencecheck=n=-60dB:d=15", "ametadata@audiolevel=mode=print", "anullsink"} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("Expected graph to contain %q, got %q", want, graph)
+		}
+	}
+}
+
+func TestAudioMonitorEvents(t *testing.T) {
+	t.Run("Silence Triggers Action Until Audio Returns", func(t *testing.T) {
+		m, actions := testAudioMonitor(t, 30*time.Millisecond)
+		m.handleLine("[silencecheck @ 0x55d1c0a3e2c0] silence_start: 12.4")
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-actions:
+			case <-time.After(time.Second):
+				t.Fatalf("Expected action %d while silent", i+1)
+			}
+		}
+
+		m.handleLine("[silencecheck @ 0x55d1c0a3e2c0] silence_end: 20.1 | silence_duration: 7.7")
+		if got := testutil.ToFloat64(audioSilenceSeconds); got != 0 {
+			t.Errorf("Expected silence duration to reset, got %v", got)
+		}
+		// Drain an action that may have fired concurrently with silence_end
+		select {
+		case <-actions:
+		case <-time.After(10 * time.Millisecond):
+		}
+		select {
+		case <-actions:
+			t.Error("Expected no action after audio returned")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Audio Level Updates Gauge", func(t *testing.T) {
+		m, _ := testAudioMonitor(t, time.Hour)
+		m.handleLine("[audiolevel @ 0x55d1c0a40b40] lavfi.astats.Overall.RMS_level=-23.5")
+		if got := testutil.ToFloat64(audioLevelDBFS); got != -23.5 {
+			t.Errorf("Expected level -23.5, got %v", got)
+		}
+		m.handleLine("[audiolevel @ 0x55d1c0a40b40] lavfi.astats.Overall.RMS_level=-inf")
+		if got := testutil.ToFloat64(audioLevelDBFS); got != -144 {
+			t.Errorf("Expected -inf to be clamped to -144, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/ffmpeg"
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default ingest the upload bandwidth test publishes to; Twitch picks the closest server
+	DefaultBandwidthTestIngest = "rtmp://ingest.global-contribute.live-video.net/app"
+	// How long the bandwidth test publishes for
+	bandwidthTestDuration = 10 * time.Second
+	// Bitrate of the bandwidth test stream in kbps, the highest speed it can measure
+	bandwidthTestBitrate = 20000
+	// Share of the measured upload speed offered as the aggregate bitrate budget,
+	// leaving room for audio, protocol overhead and fluctuations
+	bandwidthTestHeadroomPercent = 80
+	// The budget is rounded down to a multiple of this many kbps, so small variations
+	// between measurements don't change the Go Live request
+	bandwidthTestStep = 500
+)
+
+// loadGoLiveLimits sets the track cap and aggregate bitrate budget sent to the Go Live
+// API from TWITCH_MAX_VIDEO_TRACKS and TWITCH_MAX_AGGREGATE_BITRATE. Without an explicit
+// budget, TWITCH_BANDWIDTH_TEST=true measures the uplink to derive one.
+func loadGoLiveLimits(ctx context.Context, streamKey string, opts *twitch.GoLiveOptions) {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	if tracksStr := utils.GetEnvOrDefault("TWITCH_MAX_VIDEO_TRACKS", ""); tracksStr != "" {
+		tracks, err := strconv.Atoi(tracksStr)
+		if err != nil || tracks <= 0 {
+			logger.Warn("Invalid TWITCH_MAX_VIDEO_TRACKS value, ignoring", zap.String("invalidValue", tracksStr))
+		} else {
+			opts.MaxTracks = &tracks
+		}
+	}
+
+	if bitrateStr := utils.GetEnvOrDefault("TWITCH_MAX_AGGREGATE_BITRATE", ""); bitrateStr != "" {
+		bitrate, err := strconv.Atoi(strings.TrimSuffix(bitrateStr, "k"))
+		if err != nil || bitrate <= 0 {
+			logger.Warn("Invalid TWITCH_MAX_AGGREGATE_BITRATE value, ignoring", zap.String("invalidValue", bitrateStr))
+		} else {
+			opts.MaxAggregateBitrate = &bitrate
+			return
+		}
+	}
+
+	if !strings.EqualFold(utils.GetEnvOrDefault("TWITCH_BANDWIDTH_TEST", ""), "true") {
+		return
+	}
+	ingest := utils.GetEnvOrDefault("TWITCH_BANDWIDTH_TEST_INGEST", DefaultBandwidthTestIngest)
+	logger.Info("Measuring upload bandwidth to ingest", zap.String("ingest", ingest), zap.Duration("duration", bandwidthTestDuration))
+	measured, err := probeUploadBitrate(ctx, ingest, streamKey)
+	if err != nil {
+		logger.Warn("Upload bandwidth test failed, not limiting aggregate bitrate", zap.Error(err))
+		return
+	}
+	budget := uplinkBudget(measured)
+	logger.Info("Upload bandwidth measured",
+		zap.Int("uploadKbps", measured),
+		zap.Int("maxAggregateBitrateKbps", budget))
+	if budget > 0 {
+		opts.MaxAggregateBitrate = &budget
+	}
+}
+
+// bandwidthTestURL publishes to the stream key's channel in Twitch's bandwidth test
+// mode, which accepts the stream without ever taking the channel live.
+func bandwidthTestURL(ingest, streamKey string) string {
+	return strings.TrimSuffix(ingest, "/") + "/" + streamKey + "?bandwidthtest=true"
+}
+
+// uplinkBudget is the aggregate bitrate, in kbps, to request for a measured upload speed.
+func uplinkBudget(measuredKbps int) int {
+	budget := measuredKbps * bandwidthTestHeadroomPercent / 100
+	return budget / bandwidthTestStep * bandwidthTestStep
+}
+
+// probeUploadBitrate publishes FFmpeg's bandwidth test stream to the ingest and returns
+// the upload speed it sustained, in kbps.
+func probeUploadBitrate(ctx context.Context, ingest, streamKey string) (int, error) {
+	// A slow uplink stretches the test; give up well before it stalls startup
+	ctx, cancel := context.WithTimeout(ctx, 3*bandwidthTestDuration)
+	defer cancel()
+
+	test := ffmpeg.BandwidthTest{Bitrate: bandwidthTestBitrate, Duration: bandwidthTestDuration, URL: bandwidthTestURL(ingest, streamKey)}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", test.Args()...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		// FFmpeg's errors name the URL, which holds the stream key
+		output := strings.ReplaceAll(strings.TrimSpace(stderr.String()), streamKey, "[REDACTED]")
+		return 0, fmt.Errorf("bandwidth test failed: %w: %s", err, output)
+	}
+	elapsed := time.Since(start)
+
+	totalSize, err := ffmpeg.ParseTotalSize(&stdout)
+	if err != nil {
+		return 0, fmt.Errorf("bandwidth test failed: %w", err)
+	}
+	return int(float64(totalSize) * 8 / 1000 / elapsed.Seconds()), nil
+}
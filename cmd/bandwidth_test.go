@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func TestLoadGoLiveLimits(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	setup := func(t *testing.T, tracks, bitrate string) *twitch.GoLiveOptions {
+		t.Setenv("TWITCH_MAX_VIDEO_TRACKS", tracks)
+		t.Setenv("TWITCH_MAX_AGGREGATE_BITRATE", bitrate)
+		t.Setenv("TWITCH_BANDWIDTH_TEST", "")
+		inferred := 4
+		return &twitch.GoLiveOptions{MaxTracks: &inferred}
+	}
+
+	t.Run("Explicit Limits", func(t *testing.T) {
+		opts := setup(t, "3", "8000k")
+		loadGoLiveLimits(ctx, "live_test_key", opts)
+
+		if opts.MaxTracks == nil || *opts.MaxTracks != 3 {
+			t.Errorf("Expected a track cap of 3, got %v", opts.MaxTracks)
+		}
+		if opts.MaxAggregateBitrate == nil || *opts.MaxAggregateBitrate != 8000 {
+			t.Errorf("Expected an aggregate bitrate of 8000 kbps, got %v", opts.MaxAggregateBitrate)
+		}
+	})
+
+	t.Run("Unset Keeps Inferred Track Cap", func(t *testing.T) {
+		opts := setup(t, "", "")
+		loadGoLiveLimits(ctx, "live_test_key", opts)
+
+		if opts.MaxTracks == nil || *opts.MaxTracks != 4 {
+			t.Errorf("Expected the inferred track cap of 4, got %v", opts.MaxTracks)
+		}
+		if opts.MaxAggregateBitrate != nil {
+			t.Errorf("Expected no aggregate bitrate limit, got %d", *opts.MaxAggregateBitrate)
+		}
+	})
+
+	t.Run("Invalid Values Are Ignored", func(t *testing.T) {
+		opts := setup(t, "0", "fast")
+		loadGoLiveLimits(ctx, "live_test_key", opts)
+
+		if opts.MaxTracks == nil || *opts.MaxTracks != 4 {
+			t.Errorf("Expected the inferred track cap of 4, got %v", opts.MaxTracks)
+		}
+		if opts.MaxAggregateBitrate != nil {
+			t.Errorf("Expected no aggregate bitrate limit, got %d", *opts.MaxAggregateBitrate)
+		}
+	})
+}
+
+func TestUplinkBudget(t *testing.T) {
+	tests := []struct {
+		measured int
+		expected int
+	}{
+		{20000, 16000},
+		{9876, 7500},
+		{500, 0},
+	}
+	for _, tc := range tests {
+		if got := uplinkBudget(tc.measured); got != tc.expected {
+			t.Errorf("Expected a budget of %d kbps for %d kbps measured, got %d", tc.expected, tc.measured, got)
+		}
+	}
+}
+
+func TestBandwidthTestURL(t *testing.T) {
+	got := bandwidthTestURL("rtmp://ingest.example.com/app/", "live_test_key")
+	if got != "rtmp://ingest.example.com/app/live_test_key?bandwidthtest=true" {
+		t.Errorf("Expected the bandwidth test URL, got %q", got)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default number of times a single component may be restarted within
+	// componentRestartWindow before the whole pipeline is restarted instead
+	DefaultComponentMaxRestarts = 5
+	// Window over which component restarts are counted
+	componentRestartWindow = 5 * time.Minute
+	// Delay before restarting a component that exited
+	componentRestartDelay = time.Second
+)
+
+// Components recorded on the component restart metric
+const (
+	componentFFmpeg = "ffmpeg"
+	componentXvfb   = "xvfb"
+)
+
+// restartBudget counts a component's restarts within componentRestartWindow.
+type restartBudget struct {
+	max      int
+	restarts []time.Time
+	now      func() time.Time
+}
+
+func newRestartBudget(max int) *restartBudget {
+	return &restartBudget{max: max, now: time.Now}
+}
+
+// take records a restart and reports whether it is within budget. max <= 0 is unlimited.
+func (b *restartBudget) take() bool {
+	now := b.now()
+	kept := b.restarts[:0]
+	for _, t := range b.restarts {
+		if now.Sub(t) < componentRestartWindow {
+			kept = append(kept, t)
+		}
+	}
+	b.restarts = append(kept, now)
+	return b.max <= 0 || len(b.restarts) <= b.max
+}
+
+// loadComponentMaxRestarts reads COMPONENT_MAX_RESTARTS.
+func loadComponentMaxRestarts(ctx context.Context) int {
+	value := utils.GetEnvOrDefault("COMPONENT_MAX_RESTARTS", "")
+	if value == "" {
+		return DefaultComponentMaxRestarts
+	}
+	max, err := strconv.Atoi(value)
+	if err != nil || max < 0 {
+		utils.GetLoggerFromContext(ctx).Warn("Invalid COMPONENT_MAX_RESTARTS value, using default",
+			zap.String("invalidValue", value), zap.Int("default", DefaultComponentMaxRestarts))
+		return DefaultComponentMaxRestarts
+	}
+	return max
+}
+
+// sleepContext waits for d, returning false if ctx is cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// superviseFFmpeg runs FFmpeg and restarts only FFmpeg when it exits, leaving the
+// browsers and displays running. It returns nil once the pipeline is stopped, or an
+// error once FFmpeg exceeds its restart budget so the whole pipeline is restarted.
+// Runs that fail within IngestConnectTimeout fail over to the next ingest endpoint,
+// and once every endpoint has failed the whole pipeline is restarted as well. A run
+// stopped by watchIngestFailback is restarted straight away on the primary.
+func superviseFFmpeg(ctx context.Context, config *Config, encoders encoderLauncher, frames *frameMonitor, audio *audioMonitor) error {
+	logger := utils.GetLoggerFromContext(ctx)
+	budget := newRestartBudget(config.ComponentMaxRestarts)
+
+	for {
+		recordIngest(config)
+		started := time.Now()
+		err := startFFmpegStream(ctx, config, encoders, frames, audio)
+		// Clear pending detector actions; they refer to the FFmpeg run that just ended
+		frames.stop()
+		audio.stop()
+
+		if ctx.Err() != nil || !globalStreamState.isStreamRunning() {
+			return nil
+		}
+		if config.Ingests != nil {
+			if config.Ingests.takeFailBack() {
+				continue
+			}
+			// A run that ends this quickly never got the stream through to the ingest.
+			// Failed connections are bounded by the ingest list, not the restart budget.
+			if time.Since(started) < config.IngestConnectTimeout {
+				if !ingestConnectFailed(logger, config, err) {
+					return fmt.Errorf("failed to connect to every ingest endpoint: %w", err)
+				}
+				componentRestartsTotal.WithLabelValues(componentFFmpeg, "").Inc()
+				if !sleepContext(ctx, componentRestartDelay) {
+					return nil
+				}
+				continue
+			}
+			config.Ingests.connected()
+		}
+		if !budget.take() {
+			return fmt.Errorf("ffmpeg exited more than %d times within %v: %w", config.ComponentMaxRestarts, componentRestartWindow, err)
+		}
+
+		componentRestartsTotal.WithLabelValues(componentFFmpeg, "").Inc()
+		logger.Warn("FFmpeg exited, restarting FFmpeg only",
+			zap.Duration("restartIn", componentRestartDelay), zap.Error(err))
+		if !sleepContext(ctx, componentRestartDelay) {
+			return nil
+		}
+	}
+}
+
+// displayServer owns the display server process for one output and restarts it if it exits.
+type displayServer struct {
+	output   StreamOutput
+	launcher displayLauncher
+
+	mu      sync.Mutex
+	process displayProcess
+	stopped bool
+}
+
+// startDisplayServer starts a display server for the output's display.
+func startDisplayServer(ctx context.Context, launcher displayLauncher, output StreamOutput) (*displayServer, error) {
+	process, err := launcher.startDisplay(ctx, output)
+	if err != nil {
+		return nil, err
+	}
+	return &displayServer{output: output, launcher: launcher, process: process}, nil
+}
+
+// current returns the display server process currently serving the display.
+func (s *displayServer) current() displayProcess {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.process
+}
+
+// stop kills the current process and stops it from being restarted.
+func (s *displayServer) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	process := s.process
+	s.mu.Unlock()
+	if process != nil {
+		process.kill()
+	}
+}
+
+// waitStopped waits up to timeout for the current process to exit after stop,
+// so a new server can take over the display straight away.
+func (s *displayServer) waitStopped(timeout time.Duration) bool {
+	process := s.current()
+	if process == nil {
+		return true
+	}
+	select {
+	case <-process.exited():
+		return true
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-process.exited():
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// supervise waits for the display server to exit and restarts it on the same display,
+// then calls onRestart so the browser drawing on it can be recreated. If it can't be
+// brought back within budget, fail is called with the error to restart the whole pipeline.
+func (s *displayServer) supervise(ctx context.Context, maxRestarts int, onRestart func() error, fail func(error)) {
+	logger := utils.GetLoggerFromContext(ctx)
+	display := strconv.Itoa(s.output.Display)
+	budget := newRestartBudget(maxRestarts)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.current().exited():
+		}
+
+		for {
+			s.mu.Lock()
+			stopped := s.stopped
+			s.mu.Unlock()
+			if stopped || ctx.Err() != nil {
+				return
+			}
+			if !budget.take() {
+				fail(fmt.Errorf("xvfb on display :%d exited more than %d times within %v", s.output.Display, maxRestarts, componentRestartWindow))
+				return
+			}
+
+			componentRestartsTotal.WithLabelValues(componentXvfb, display).Inc()
+			logger.Warn("Xvfb exited, restarting it on the same display", zap.Int("display", s.output.Display))
+			if !sleepContext(ctx, componentRestartDelay) {
+				return
+			}
+
+			process, err := s.launcher.startDisplay(ctx, s.output)
+			if err != nil {
+				logger.Error("Failed to restart Xvfb", zap.Int("display", s.output.Display), zap.Error(err))
+				continue
+			}
+
+			s.mu.Lock()
+			if s.stopped {
+				s.mu.Unlock()
+				process.kill()
+				return
+			}
+			s.process = process
+			s.mu.Unlock()
+			break
+		}
+
+		// The browser lost its display along with Xvfb
+		if err := onRestart(); err != nil {
+			logger.Error("Failed to recreate Chrome after Xvfb restart", zap.Int("display", s.output.Display), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func TestRestartBudget(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	budget := newRestartBudget(2)
+	budget.now = func() time.Time { return now }
+
+	if !budget.take() || !budget.take() {
+		t.Fatal("Expected the first two restarts to be within budget")
+	}
+	if budget.take() {
+		t.Error("Expected the third restart within the window to exceed the budget")
+	}
+
+	now = now.Add(componentRestartWindow)
+	if !budget.take() {
+		t.Error("Expected restarts outside the window to be forgotten")
+	}
+
+	unlimited := newRestartBudget(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.take() {
+			t.Fatal("Expected a zero budget to be unlimited")
+		}
+	}
+}
+
+func TestLoadComponentMaxRestarts(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected int
+	}{
+		{"Unset Uses Default", "", DefaultComponentMaxRestarts},
+		{"Valid Value", "3", 3},
+		{"Zero Is Unlimited", "0", 0},
+		{"Invalid Uses Default", "many", DefaultComponentMaxRestarts},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("COMPONENT_MAX_RESTARTS", tc.value)
+			if got := loadComponentMaxRestarts(ctx); got != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+// testDisplayServer returns a server tracking a long-running stand-in process.
+// Restarts go through launcher.
+func testDisplayServer(t *testing.T, launcher displayLauncher) *displayServer {
+	t.Helper()
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Cannot start stand-in process: %v", err)
+	}
+	s := &displayServer{
+		output:   StreamOutput{Display: 100, Width: 640, Height: 360},
+		launcher: launcher,
+		process:  newExecProcess(cmd),
+	}
+	t.Cleanup(s.stop)
+	return s
+}
+
+func TestDisplayServerSupervise(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	t.Run("Stop Does Not Restart", func(t *testing.T) {
+		s := testDisplayServer(t, xvfbLauncher{})
+		done := make(chan struct{})
+		go func() {
+			s.supervise(ctx, 5,
+				func() error { t.Error("Expected no restart after stop"); return nil },
+				func(err error) { t.Errorf("Expected no failure after stop, got %v", err) })
+			close(done)
+		}()
+
+		s.stop()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected supervisor to return after stop")
+		}
+	})
+
+	t.Run("Exhausted Budget Fails Pipeline", func(t *testing.T) {
+		s := testDisplayServer(t, &fakeDisplayLauncher{err: errors.New("no display")})
+		failed := make(chan error, 1)
+		go s.supervise(ctx, 1, func() error { return nil }, func(err error) { failed <- err })
+
+		// Simulate Xvfb crashing
+		s.current().kill()
+
+		select {
+		case err := <-failed:
+			if err == nil {
+				t.Error("Expected a failure error")
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("Expected supervisor to give up once restarts keep failing")
+		}
+	})
+}
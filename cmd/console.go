@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	cdplog "github.com/chromedp/cdproto/log"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// Browser log severities that can be remapped with CHROME_CONSOLE_LOG_LEVELS.
+// Console API calls and Log domain entries are folded into the same four
+// severities; uncaught exceptions have their own key.
+const (
+	BrowserLevelVerbose   = "verbose"
+	BrowserLevelInfo      = "info"
+	BrowserLevelWarning   = "warning"
+	BrowserLevelError     = "error"
+	BrowserLevelException = "exception"
+)
+
+// ConsoleLogLevels maps browser log severities to zap levels. Severities missing
+// from the map (configured as "off") are dropped.
+type ConsoleLogLevels map[string]zapcore.Level
+
+// defaultConsoleLogLevels keeps chatty console.log output at debug so it doesn't
+// drown out the application's own logs.
+func defaultConsoleLogLevels() ConsoleLogLevels {
+	return ConsoleLogLevels{
+		BrowserLevelVerbose:   zapcore.DebugLevel,
+		BrowserLevelInfo:      zapcore.DebugLevel,
+		BrowserLevelWarning:   zapcore.WarnLevel,
+		BrowserLevelError:     zapcore.ErrorLevel,
+		BrowserLevelException: zapcore.ErrorLevel,
+	}
+}
+
+// loadConsoleLogLevels parses CHROME_CONSOLE_LOG_LEVELS, a comma-separated list of
+// browserLevel=zapLevel pairs (e.g. "info=info,verbose=off"), on top of the defaults.
+func loadConsoleLogLevels() (ConsoleLogLevels, error) {
+	levels := defaultConsoleLogLevels()
+
+	spec := utils.GetEnvOrDefault("CHROME_CONSOLE_LOG_LEVELS", "")
+	if spec == "" {
+		return levels, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		browserLevel, zapLevel, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid CHROME_CONSOLE_LOG_LEVELS entry %q: expected browserLevel=logLevel", pair)
+		}
+		browserLevel = strings.ToLower(strings.TrimSpace(browserLevel))
+		zapLevel = strings.ToLower(strings.TrimSpace(zapLevel))
+
+		if _, known := defaultConsoleLogLevels()[browserLevel]; !known {
+			return nil, fmt.Errorf("invalid CHROME_CONSOLE_LOG_LEVELS entry %q: unknown browser level %q", pair, browserLevel)
+		}
+
+		if zapLevel == "off" {
+			delete(levels, browserLevel)
+			continue
+		}
+		if zapLevel == "warning" {
+			zapLevel = "warn"
+		}
+		level, err := zapcore.ParseLevel(zapLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CHROME_CONSOLE_LOG_LEVELS entry %q: %w", pair, err)
+		}
+		levels[browserLevel] = level
+	}
+
+	return levels, nil
+}
+
+// consoleAPISeverity folds a console API call type into a browser severity.
+func consoleAPISeverity(t runtime.APIType) string {
+	switch t {
+	case runtime.APITypeDebug:
+		return BrowserLevelVerbose
+	case runtime.APITypeWarning:
+		return BrowserLevelWarning
+	case runtime.APITypeError, runtime.APITypeAssert:
+		return BrowserLevelError
+	default:
+		return BrowserLevelInfo
+	}
+}
+
+// remoteObjectString renders a console argument the way DevTools would print it.
+func remoteObjectString(obj *runtime.RemoteObject) string {
+	if obj == nil {
+		return ""
+	}
+	if len(obj.Value) > 0 {
+		var str string
+		if err := json.Unmarshal(obj.Value, &str); err == nil {
+			return str
+		}
+		return string(obj.Value)
+	}
+	if obj.UnserializableValue != "" {
+		return string(obj.UnserializableValue)
+	}
+	if obj.Description != "" {
+		return obj.Description
+	}
+	return string(obj.Type)
+}
+
+// forwardBrowserLogs emits the page's console output, uncaught exceptions and browser
+// log entries through the zap logger, tagged with the canvas display and track name.
+// Uncaught exceptions are also counted per canvas.
+func forwardBrowserLogs(ctx context.Context, chromeCtx context.Context, levels ConsoleLogLevels, output StreamOutput) {
+	logger := utils.GetLoggerFromContext(ctx).With(
+		zap.Int("display", output.Display),
+		zap.String("track", output.Name))
+	exceptions := pageExceptionsTotal.WithLabelValues(strconv.Itoa(output.Display))
+
+	emit := func(severity, msg string, fields ...zap.Field) {
+		level, ok := levels[severity]
+		if !ok {
+			return
+		}
+		if ce := logger.Check(level, msg); ce != nil {
+			ce.Write(append(fields, zap.String("browserLevel", severity))...)
+		}
+	}
+
+	chromedp.ListenTarget(chromeCtx, func(ev any) {
+		switch e := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			args := make([]string, 0, len(e.Args))
+			for _, arg := range e.Args {
+				args = append(args, remoteObjectString(arg))
+			}
+			emit(consoleAPISeverity(e.Type), "Browser console message",
+				zap.String("source", "console"),
+				zap.String("consoleType", string(e.Type)),
+				zap.String("message", strings.Join(args, " ")))
+		case *runtime.EventExceptionThrown:
+			exceptions.Inc()
+			details := e.ExceptionDetails
+			if details == nil {
+				return
+			}
+			message := details.Text
+			if details.Exception != nil && details.Exception.Description != "" {
+				message = details.Exception.Description
+			}
+			emit(BrowserLevelException, "Browser page exception",
+				zap.String("source", "exception"),
+				zap.String("message", message),
+				zap.String("url", details.URL),
+				zap.Int64("line", details.LineNumber+1),
+				zap.Int64("column", details.ColumnNumber+1))
+		case *cdplog.EventEntryAdded:
+			entry := e.Entry
+			if entry == nil {
+				return
+			}
+			// Log domain levels (verbose/info/warning/error) match the browser severities
+			emit(string(entry.Level), "Browser log entry",
+				zap.String("source", string(entry.Source)),
+				zap.String("message", entry.Text),
+				zap.String("url", entry.URL))
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/chromedp/cdproto/runtime"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLoadConsoleLogLevels(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		t.Setenv("CHROME_CONSOLE_LOG_LEVELS", "")
+
+		levels, err := loadConsoleLogLevels()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if levels[BrowserLevelInfo] != zapcore.DebugLevel {
+			t.Errorf("Expected info to map to debug, got %v", levels[BrowserLevelInfo])
+		}
+		if levels[BrowserLevelException] != zapcore.ErrorLevel {
+			t.Errorf("Expected exception to map to error, got %v", levels[BrowserLevelException])
+		}
+	})
+
+	t.Run("Overrides And Off", func(t *testing.T) {
+		t.Setenv("CHROME_CONSOLE_LOG_LEVELS", "info=info, verbose=off ,warning=warning,ERROR=warn")
+
+		levels, err := loadConsoleLogLevels()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if levels[BrowserLevelInfo] != zapcore.InfoLevel {
+			t.Errorf("Expected info to map to info, got %v", levels[BrowserLevelInfo])
+		}
+		if _, ok := levels[BrowserLevelVerbose]; ok {
+			t.Error("Expected verbose to be turned off")
+		}
+		if levels[BrowserLevelWarning] != zapcore.WarnLevel {
+			t.Errorf("Expected warning to map to warn, got %v", levels[BrowserLevelWarning])
+		}
+		if levels[BrowserLevelError] != zapcore.WarnLevel {
+			t.Errorf("Expected error to map to warn, got %v", levels[BrowserLevelError])
+		}
+	})
+
+	for name, spec := range map[string]string{
+		"missing separator":     "info",
+		"unknown browser level": "trace=debug",
+		"unknown log level":     "info=loud",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("CHROME_CONSOLE_LOG_LEVELS", spec)
+			if _, err := loadConsoleLogLevels(); err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestConsoleAPISeverity(t *testing.T) {
+	tests := map[runtime.APIType]string{
+		runtime.APITypeLog:     BrowserLevelInfo,
+		runtime.APITypeInfo:    BrowserLevelInfo,
+		runtime.APITypeDebug:   BrowserLevelVerbose,
+		runtime.APITypeWarning: BrowserLevelWarning,
+		runtime.APITypeError:   BrowserLevelError,
+		runtime.APITypeAssert:  BrowserLevelError,
+		runtime.APITypeTable:   BrowserLevelInfo,
+	}
+	for apiType, expected := range tests {
+		if got := consoleAPISeverity(apiType); got != expected {
+			t.Errorf("%s: expected %q, got %q", apiType, expected, got)
+		}
+	}
+}
+
+func TestRemoteObjectString(t *testing.T) {
+	tests := []struct {
+		name     string
+		obj      *runtime.RemoteObject
+		expected string
+	}{
+		{"Nil", nil, ""},
+		{"String Value", &runtime.RemoteObject{Type: runtime.TypeString, Value: []byte(`"hello \"world\""`)}, `hello "world"`},
+		{"Number Value", &runtime.RemoteObject{Type: runtime.TypeNumber, Value: []byte(`42`)}, "42"},
+		{"Unserializable", &runtime.RemoteObject{Type: runtime.TypeNumber, UnserializableValue: "NaN"}, "NaN"},
+		{"Object Description", &runtime.RemoteObject{Type: runtime.TypeObject, Description: "Error: boom"}, "Error: boom"},
+		{"Type Fallback", &runtime.RemoteObject{Type: runtime.TypeUndefined}, "undefined"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := remoteObjectString(tc.obj); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
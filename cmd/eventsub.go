@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default seconds a stream.offline notification waits for a stream.online before
+	// restarting the stream; our own restarts take the channel offline briefly too
+	DefaultEventSubOfflineGrace = 10
+)
+
+// streamEventHandler restarts the stream when Twitch reports the channel offline,
+// unless it comes back online within the grace period, the encoder has reconnected
+// since, or a restart is already under way.
+type streamEventHandler struct {
+	ctx     context.Context
+	grace   time.Duration
+	restart func()
+	// lastEncoderStart returns when FFmpeg last started publishing
+	lastEncoderStart func() time.Time
+	// restarting reports whether the stream is down and being restarted already
+	restarting func() bool
+
+	mu      sync.Mutex
+	pending *time.Timer
+	// liveEncoderStart is when the encoder run the last stream.online reported started;
+	// zero until a stream.online has been seen
+	liveEncoderStart time.Time
+	// restartUnlessSince skips the pending restart if the encoder started after it
+	restartUnlessSince time.Time
+}
+
+func newStreamEventHandler(ctx context.Context, config *Config, grace time.Duration) *streamEventHandler {
+	logger := utils.GetLoggerFromContext(ctx)
+	return &streamEventHandler{
+		ctx:   ctx,
+		grace: grace,
+		restart: func() {
+			logger.Warn("Stream is still offline, restarting...")
+			if err := RestartStream(ctx, config); err != nil {
+				logger.Error("Failed to restart stream", zap.Error(err))
+			}
+		},
+		lastEncoderStart: globalStreamState.lastFFmpegStart,
+		restarting:       func() bool { return !globalStreamState.isStreamRunning() },
+	}
+}
+
+// handle reacts to a stream.online or stream.offline notification.
+func (h *streamEventHandler) handle(event twitch.EventSubEvent) {
+	logger := utils.GetLoggerFromContext(h.ctx)
+	eventSubNotificationsTotal.WithLabelValues(event.Type).Inc()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch event.Type {
+	case twitch.EventSubStreamOffline:
+		logger.Warn("Twitch reports the stream offline",
+			zap.String("channel", event.BroadcasterUserLogin), zap.Duration("restartIn", h.grace))
+		if h.pending == nil {
+			// FFmpeg often reconnects before Twitch sends stream.offline, so any encoder
+			// run newer than the one that went live counts. Without a stream.online to go
+			// by, runs started within the grace period before the notification count.
+			h.restartUnlessSince = h.liveEncoderStart
+			if h.restartUnlessSince.IsZero() {
+				h.restartUnlessSince = time.Now().Add(-h.grace)
+			}
+			h.pending = time.AfterFunc(h.grace, h.restartPending)
+		}
+	case twitch.EventSubStreamOnline:
+		logger.Info("Twitch reports the stream live", zap.String("channel", event.BroadcasterUserLogin))
+		h.liveEncoderStart = h.lastEncoderStart()
+		if h.pending != nil && h.pending.Stop() {
+			logger.Info("Stream came back online, restart cancelled")
+		}
+		h.pending = nil
+	}
+}
+
+// restartPending restarts the stream once the grace period after an offline
+// notification is over, unless it was already brought back another way: FFmpeg alone
+// restarted (a failback or crash recovery) or the whole pipeline is restarting.
+func (h *streamEventHandler) restartPending() {
+	logger := utils.GetLoggerFromContext(h.ctx)
+	h.mu.Lock()
+	h.pending = nil
+	since := h.restartUnlessSince
+	h.mu.Unlock()
+
+	if h.restarting() {
+		logger.Info("Stream is already restarting, ignoring offline notification")
+		return
+	}
+	if h.lastEncoderStart().After(since) {
+		logger.Info("Encoder reconnected since the stream went offline, not restarting")
+		return
+	}
+	h.restart()
+}
+
+// setupStreamEventSub subscribes to stream.online and stream.offline for TWITCH_CHANNEL
+// over EventSub so the stream is restarted as soon as Twitch ends it, rather than on
+// the next status check. It needs TWITCH_USER_ACCESS_TOKEN; the status cron keeps
+// running as a fallback either way. Runs in the background until ctx is cancelled.
+func setupStreamEventSub(ctx context.Context, config *Config) {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	twitchChannel := utils.GetEnvOrDefault("TWITCH_CHANNEL", "")
+	if twitchChannel == "" {
+		return
+	}
+	if utils.GetEnvOrDefault("TWITCH_USER_ACCESS_TOKEN", "") == "" {
+		logger.Info("TWITCH_USER_ACCESS_TOKEN not set, stream status is only checked on the cron schedule")
+		return
+	}
+
+	client, err := twitch.NewUserClient(ctx)
+	if err != nil {
+		logger.Error("Failed to create Twitch client for EventSub", zap.Error(err))
+		return
+	}
+	broadcasterID, err := twitch.GetBroadcasterID(client, twitchChannel)
+	if err != nil {
+		logger.Error("Failed to set up EventSub, relying on the status cron", zap.Error(err))
+		return
+	}
+
+	handler := newStreamEventHandler(ctx, config,
+		utils.GetSecondsFromEnv(ctx, "TWITCH_EVENTSUB_OFFLINE_GRACE", DefaultEventSubOfflineGrace))
+	go twitch.RunEventSub(ctx, twitch.EventSubOptions{
+		URL:       utils.GetEnvOrDefault("TWITCH_EVENTSUB_URL", twitch.DefaultEventSubURL),
+		Subscribe: twitch.StreamEventSubscriber(client, broadcasterID),
+		OnEvent:   handler.handle,
+		OnConnected: func(connected bool) {
+			if connected {
+				eventSubConnected.Set(1)
+			} else {
+				eventSubConnected.Set(0)
+			}
+		},
+	})
+	logger.Info("Subscribing to Twitch stream events", zap.String("channel", twitchChannel))
+}
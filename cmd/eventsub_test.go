@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func TestStreamEventHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	// testHandler returns a handler for a running stream whose encoder started before the
+	// test, with restarts sent on the returned channel
+	testHandler := func(grace time.Duration) (*streamEventHandler, chan struct{}) {
+		restarts := make(chan struct{}, 10)
+		h := newStreamEventHandler(ctx, &Config{}, grace)
+		h.restart = func() { restarts <- struct{}{} }
+		encoderStart := time.Now().Add(-time.Minute)
+		h.lastEncoderStart = func() time.Time { return encoderStart }
+		h.restarting = func() bool { return false }
+		return h, restarts
+	}
+	offline := twitch.EventSubEvent{Type: twitch.EventSubStreamOffline, BroadcasterUserLogin: "channel"}
+	online := twitch.EventSubEvent{Type: twitch.EventSubStreamOnline, BroadcasterUserLogin: "channel"}
+
+	t.Run("Restarts When Stream Stays Offline", func(t *testing.T) {
+		h, restarts := testHandler(10 * time.Millisecond)
+
+		h.handle(offline)
+		h.handle(offline)
+		select {
+		case <-restarts:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the stream to be restarted")
+		}
+		select {
+		case <-restarts:
+			t.Error("Expected repeated offline notifications to restart once")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("Restarts Immediately Without Grace", func(t *testing.T) {
+		h, restarts := testHandler(0)
+
+		h.handle(offline)
+		select {
+		case <-restarts:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the stream to be restarted")
+		}
+	})
+
+	t.Run("Online Within Grace Cancels Restart", func(t *testing.T) {
+		h, restarts := testHandler(100 * time.Millisecond)
+
+		h.handle(offline)
+		h.handle(online)
+		select {
+		case <-restarts:
+			t.Error("Expected no restart once the stream came back online")
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("Encoder Reconnect Within Grace Skips Restart", func(t *testing.T) {
+		h, restarts := testHandler(50 * time.Millisecond)
+		reconnected := make(chan time.Time, 1)
+		h.lastEncoderStart = func() time.Time { return <-reconnected }
+
+		h.handle(offline)
+		reconnected <- time.Now().Add(time.Millisecond)
+		select {
+		case <-restarts:
+			t.Error("Expected no restart once the encoder reconnected after the offline notification")
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("Encoder Reconnect Before Offline Skips Restart", func(t *testing.T) {
+		h, restarts := testHandler(20 * time.Millisecond)
+		h.handle(online)
+
+		// FFmpeg crashed and reconnected before Twitch sent stream.offline
+		reconnected := time.Now().Add(-time.Second)
+		h.lastEncoderStart = func() time.Time { return reconnected }
+		h.handle(offline)
+		select {
+		case <-restarts:
+			t.Error("Expected no restart once the encoder reconnected before the offline notification")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Same Encoder Run Still Restarts", func(t *testing.T) {
+		h, restarts := testHandler(20 * time.Millisecond)
+		h.handle(online)
+
+		h.handle(offline)
+		select {
+		case <-restarts:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a restart when the encoder that went live is still the latest run")
+		}
+	})
+
+	t.Run("Restart In Progress Skips Restart", func(t *testing.T) {
+		h, restarts := testHandler(0)
+		h.restarting = func() bool { return true }
+
+		h.handle(offline)
+		select {
+		case <-restarts:
+			t.Error("Expected no restart while the stream is already restarting")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("Online Alone Does Not Restart", func(t *testing.T) {
+		h, restarts := testHandler(0)
+
+		h.handle(online)
+		select {
+		case <-restarts:
+			t.Error("Expected no restart for a stream going live")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// Kinds of fallback source, detected from the FALLBACK_SOURCE file extension
+const (
+	FallbackKindHTML  = "html"
+	FallbackKindImage = "image"
+	FallbackKindVideo = "video"
+)
+
+// fallbackKinds maps supported file extensions to the kind of fallback they are.
+var fallbackKinds = map[string]string{
+	".html": FallbackKindHTML,
+	".htm":  FallbackKindHTML,
+	".png":  FallbackKindImage,
+	".jpg":  FallbackKindImage,
+	".jpeg": FallbackKindImage,
+	".gif":  FallbackKindImage,
+	".webp": FallbackKindImage,
+	".svg":  FallbackKindImage,
+	".mp4":  FallbackKindVideo,
+	".webm": FallbackKindVideo,
+	".mkv":  FallbackKindVideo,
+	".mov":  FallbackKindVideo,
+}
+
+// fallbackMediaTemplate wraps an image or video so it fills the canvas. Video loops
+// with sound so the primary browser keeps feeding the stream's audio track.
+const fallbackMediaTemplate = `<!DOCTYPE html><html><head><style>` +
+	`html,body{margin:0;height:100%%;background:#000;overflow:hidden;}` +
+	`img,video{width:100%%;height:100%%;object-fit:contain;}` +
+	`</style></head><body>%s</body></html>`
+
+// fallbackWrappers caches the generated wrapper page for each media element, so
+// reloading the configuration reuses one file per process instead of leaving a new
+// one in the temp directory every time.
+var fallbackWrappers = struct {
+	mu    sync.Mutex
+	paths map[string]string
+}{paths: make(map[string]string)}
+
+// FallbackSource is a local page, image or video the browsers display (and FFmpeg
+// therefore streams) while the webpage can't be loaded, parsed from FALLBACK_SOURCE.
+type FallbackSource struct {
+	Path string
+	Kind string
+	// URL is what browsers navigate to; images and videos are wrapped in a generated page
+	URL string
+}
+
+// loadFallbackSource reads FALLBACK_SOURCE and prepares it for display. Images and
+// videos get a generated HTML wrapper next to them in the temp directory so the
+// wrapper and media share the file:// origin. Returns nil when no fallback is set.
+func loadFallbackSource() (*FallbackSource, error) {
+	path := utils.GetEnvOrDefault("FALLBACK_SOURCE", "")
+	if path == "" {
+		return nil, nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FALLBACK_SOURCE path: %w", err)
+	}
+	if info, err := os.Stat(absPath); err != nil {
+		return nil, fmt.Errorf("failed to read FALLBACK_SOURCE: %w", err)
+	} else if info.IsDir() {
+		return nil, fmt.Errorf("FALLBACK_SOURCE %s is a directory, expected a file", absPath)
+	}
+
+	kind, ok := fallbackKinds[strings.ToLower(filepath.Ext(absPath))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported FALLBACK_SOURCE file type %q: expected an HTML page, image or video", filepath.Ext(absPath))
+	}
+
+	source := &FallbackSource{Path: absPath, Kind: kind, URL: fileURL(absPath)}
+	if kind == FallbackKindHTML {
+		return source, nil
+	}
+
+	mediaSrc := html.EscapeString(fileURL(absPath))
+	var element string
+	if kind == FallbackKindImage {
+		element = fmt.Sprintf(`<img src="%s">`, mediaSrc)
+	} else {
+		element = fmt.Sprintf(`<video src="%s" autoplay loop playsinline></video>`, mediaSrc)
+	}
+
+	wrapperPath, err := fallbackWrapper(element)
+	if err != nil {
+		return nil, err
+	}
+	source.URL = fileURL(wrapperPath)
+
+	return source, nil
+}
+
+// fallbackWrapper returns the path of a page showing element, writing it to the temp
+// directory the first time it's needed (or if it has since been removed).
+func fallbackWrapper(element string) (string, error) {
+	fallbackWrappers.mu.Lock()
+	defer fallbackWrappers.mu.Unlock()
+	if path, ok := fallbackWrappers.paths[element]; ok {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	wrapper, err := os.CreateTemp("", "stream-webpage-fallback-*.html")
+	if err != nil {
+		return "", fmt.Errorf("failed to create fallback page: %w", err)
+	}
+	defer wrapper.Close()
+	if _, err := fmt.Fprintf(wrapper, fallbackMediaTemplate, element); err != nil {
+		os.Remove(wrapper.Name())
+		return "", fmt.Errorf("failed to write fallback page: %w", err)
+	}
+	fallbackWrappers.paths[element] = wrapper.Name()
+	return wrapper.Name(), nil
+}
+
+// fileURL converts an absolute path into a file:// URL.
+func fileURL(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
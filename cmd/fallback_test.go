@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFallbackSource(t *testing.T) {
+	t.Run("Not Configured", func(t *testing.T) {
+		t.Setenv("FALLBACK_SOURCE", "")
+		source, err := loadFallbackSource()
+		if err != nil || source != nil {
+			t.Errorf("Expected no fallback, got %+v (err %v)", source, err)
+		}
+	})
+
+	t.Run("HTML Page Used Directly", func(t *testing.T) {
+		path := writeTestFile(t, "slate.html", "<html><body>Be right back</body></html>")
+		t.Setenv("FALLBACK_SOURCE", path)
+
+		source, err := loadFallbackSource()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if source.Kind != FallbackKindHTML {
+			t.Errorf("Expected kind %q, got %q", FallbackKindHTML, source.Kind)
+		}
+		if source.URL != "file://"+path {
+			t.Errorf("Expected URL file://%s, got %s", path, source.URL)
+		}
+	})
+
+	for _, tc := range []struct {
+		name    string
+		file    string
+		kind    string
+		element string
+	}{
+		{"Image Wrapped In Page", "slate.PNG", FallbackKindImage, "<img "},
+		{"Video Wrapped In Looping Page", "loop.mp4", FallbackKindVideo, "loop"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TMPDIR", t.TempDir())
+			path := writeTestFile(t, tc.file, "media")
+			t.Setenv("FALLBACK_SOURCE", path)
+
+			source, err := loadFallbackSource()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if source.Kind != tc.kind {
+				t.Errorf("Expected kind %q, got %q", tc.kind, source.Kind)
+			}
+			wrapper, err := os.ReadFile(strings.TrimPrefix(source.URL, "file://"))
+			if err != nil {
+				t.Fatalf("Expected generated wrapper page at %s: %v", source.URL, err)
+			}
+			if !strings.Contains(string(wrapper), "file://"+path) || !strings.Contains(string(wrapper), tc.element) {
+				t.Errorf("Wrapper page doesn't embed the media as expected: %s", wrapper)
+			}
+		})
+	}
+
+	t.Run("Wrapper Page Reused", func(t *testing.T) {
+		tmp := t.TempDir()
+		t.Setenv("TMPDIR", tmp)
+		t.Setenv("FALLBACK_SOURCE", writeTestFile(t, "reused.png", "media"))
+
+		first, err := loadFallbackSource()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		second, err := loadFallbackSource()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if first.URL != second.URL {
+			t.Errorf("Expected the wrapper page to be reused, got %s and %s", first.URL, second.URL)
+		}
+		if entries, _ := os.ReadDir(tmp); len(entries) != 1 {
+			t.Errorf("Expected one wrapper page in the temp directory, got %d", len(entries))
+		}
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		t.Setenv("FALLBACK_SOURCE", filepath.Join(t.TempDir(), "missing.html"))
+		if _, err := loadFallbackSource(); err == nil {
+			t.Error("Expected error for missing fallback file")
+		}
+	})
+
+	t.Run("Unsupported Type", func(t *testing.T) {
+		t.Setenv("FALLBACK_SOURCE", writeTestFile(t, "slate.txt", "text"))
+		if _, err := loadFallbackSource(); err == nil {
+			t.Error("Expected error for unsupported fallback type")
+		}
+	})
+}
+
+func TestNavigationFallbackURL(t *testing.T) {
+	if got := navigationFallbackURL(&Config{}); !strings.HasPrefix(got, "data:text/html") {
+		t.Errorf("Expected built-in slate without a fallback, got %s", got)
+	}
+	config := &Config{Fallback: &FallbackSource{URL: "file:///slate.html"}}
+	if got := navigationFallbackURL(config); got != "file:///slate.html" {
+		t.Errorf("Expected configured fallback URL, got %s", got)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default seconds FFmpeg gets to finish after `q` before it is sent SIGTERM
+	DefaultFFmpegQuitTimeout = 5
+	// Default seconds FFmpeg gets to exit after SIGTERM before it is killed
+	DefaultFFmpegTermTimeout = 5
+	// How long to wait for an Xvfb process to exit after it is killed
+	xvfbStopTimeout = 5 * time.Second
+)
+
+// ffmpegProcess is a running FFmpeg command. Its exit is observed through done, which
+// the goroutine started by start closes after the one and only cmd.Wait call.
+type ffmpegProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	done  chan struct{}
+	// err is the result of cmd.Wait, valid once done is closed
+	err error
+
+	quitTimeout time.Duration
+	termTimeout time.Duration
+}
+
+// startFFmpegProcess starts cmd with a stdin pipe for graceful shutdown and reaps it
+// in the background.
+func startFFmpegProcess(cmd *exec.Cmd, quitTimeout, termTimeout time.Duration) (*ffmpegProcess, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &ffmpegProcess{
+		cmd:         cmd,
+		stdin:       stdin,
+		done:        make(chan struct{}),
+		quitTimeout: quitTimeout,
+		termTimeout: termTimeout,
+	}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// wait blocks until FFmpeg exits and returns its exit error.
+func (p *ffmpegProcess) wait() error {
+	<-p.done
+	return p.err
+}
+
+// shutdown stops FFmpeg as gently as it allows: `q` on stdin lets it flush the FLV
+// trailer, then SIGTERM, then SIGKILL, each after its timeout. Returns once it exited.
+func (p *ffmpegProcess) shutdown(logger *zap.Logger) {
+	if p == nil || p.cmd == nil || p.cmd.Process == nil {
+		return
+	}
+
+	logger.Debug("Asking FFmpeg to quit")
+	if _, err := io.WriteString(p.stdin, "q"); err != nil {
+		logger.Debug("Failed to send quit to FFmpeg", zap.Error(err))
+	}
+	if p.exitsWithin(p.quitTimeout) {
+		return
+	}
+
+	logger.Warn("FFmpeg did not quit in time, sending SIGTERM", zap.Duration("timeout", p.quitTimeout))
+	_ = p.cmd.Process.Signal(syscall.SIGTERM)
+	if p.exitsWithin(p.termTimeout) {
+		return
+	}
+
+	logger.Warn("FFmpeg did not exit after SIGTERM, killing it", zap.Duration("timeout", p.termTimeout))
+	_ = p.cmd.Process.Kill()
+	<-p.done
+}
+
+// exitsWithin reports whether FFmpeg exits within timeout.
+func (p *ffmpegProcess) exitsWithin(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// loadFFmpegShutdownTimeouts reads FFMPEG_QUIT_TIMEOUT and FFMPEG_TERM_TIMEOUT.
+func loadFFmpegShutdownTimeouts(ctx context.Context) (time.Duration, time.Duration) {
+	return utils.GetSecondsFromEnv(ctx, "FFMPEG_QUIT_TIMEOUT", DefaultFFmpegQuitTimeout),
+		utils.GetSecondsFromEnv(ctx, "FFMPEG_TERM_TIMEOUT", DefaultFFmpegTermTimeout)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// startFakeFFmpeg runs a shell script standing in for FFmpeg.
+func startFakeFFmpeg(t *testing.T, script string, quitTimeout, termTimeout time.Duration) *ffmpegProcess {
+	t.Helper()
+	p, err := startFFmpegProcess(exec.Command("sh", "-c", script), quitTimeout, termTimeout)
+	if err != nil {
+		t.Skipf("Cannot start fake FFmpeg: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = p.cmd.Process.Kill()
+		<-p.done
+	})
+	return p
+}
+
+func exitSignal(p *ffmpegProcess) syscall.Signal {
+	if status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal()
+	}
+	return 0
+}
+
+func TestFFmpegProcessShutdown(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	t.Run("Quits On Q", func(t *testing.T) {
+		// Exits cleanly as soon as it reads a byte, like FFmpeg does on `q`
+		p := startFakeFFmpeg(t, "head -c 1 >/dev/null", 5*time.Second, 5*time.Second)
+
+		start := time.Now()
+		p.shutdown(logger)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected shutdown as soon as FFmpeg quits, took %v", elapsed)
+		}
+		if err := p.wait(); err != nil {
+			t.Errorf("Expected clean exit, got %v", err)
+		}
+	})
+
+	t.Run("Escalates To SIGTERM", func(t *testing.T) {
+		p := startFakeFFmpeg(t, "exec sleep 60", 100*time.Millisecond, 5*time.Second)
+
+		start := time.Now()
+		p.shutdown(logger)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected shutdown shortly after the quit timeout, took %v", elapsed)
+		}
+		if sig := exitSignal(p); sig != syscall.SIGTERM {
+			t.Errorf("Expected exit by SIGTERM, got %v", sig)
+		}
+	})
+
+	t.Run("Escalates To Kill", func(t *testing.T) {
+		p := startFakeFFmpeg(t, `trap "" TERM; while :; do sleep 0.05; done`, 100*time.Millisecond, 100*time.Millisecond)
+
+		start := time.Now()
+		p.shutdown(logger)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected shutdown shortly after both timeouts, took %v", elapsed)
+		}
+		if sig := exitSignal(p); sig != syscall.SIGKILL {
+			t.Errorf("Expected exit by SIGKILL, got %v", sig)
+		}
+	})
+
+	t.Run("Nil Process", func(t *testing.T) {
+		var p *ffmpegProcess
+		p.shutdown(logger)
+		(&ffmpegProcess{}).shutdown(logger)
+	})
+}
+
+func TestStopStreamOrdering(t *testing.T) {
+	t.Cleanup(resetGlobalStreamState)
+	logger, _ := zap.NewDevelopment()
+
+	ffmpeg := startFakeFFmpeg(t, "head -c 1 >/dev/null", 5*time.Second, 5*time.Second)
+	xvfb := testDisplayServer(t, xvfbLauncher{})
+
+	ffmpegExitedFirst := false
+	chromeCancel := func() {
+		select {
+		case <-ffmpeg.done:
+			ffmpegExitedFirst = true
+		default:
+		}
+	}
+	streamCtx, streamCancel := context.WithCancel(context.Background())
+
+	state := &StreamState{}
+	state.setStreamRunning(streamCancel, []context.CancelFunc{chromeCancel}, []*displayServer{xvfb}, ffmpeg)
+
+	start := time.Now()
+	state.stopStream(logger)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected stop to take only as long as the processes need, took %v", elapsed)
+	}
+
+	if !ffmpegExitedFirst {
+		t.Error("Expected FFmpeg to have exited before Chrome was closed")
+	}
+	if !xvfb.waitStopped(0) {
+		t.Error("Expected Xvfb to have exited when stopStream returned")
+	}
+	if streamCtx.Err() == nil {
+		t.Error("Expected stream context to be cancelled")
+	}
+	if state.isStreamRunning() {
+		t.Error("Expected stream to be marked stopped")
+	}
+}
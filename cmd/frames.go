@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// Actions taken when a detector's condition lasts longer than its threshold
+const (
+	// Log a warning and count the incident (always done, whatever the action)
+	DetectionActionLog = "log"
+	// Reload the affected page
+	DetectionActionReload = "reload"
+	// Tear down and restart the whole pipeline
+	DetectionActionRestart = "restart"
+)
+
+// Kinds of broken picture recorded on the frame issue metrics
+const (
+	frameIssueBlack  = "black"
+	frameIssueFrozen = "frozen"
+)
+
+const (
+	// Fraction of pixels that must be black for a frame to count as black
+	blackFramePixelRatio = 0.98
+	// Luminance below which a pixel counts as black
+	blackFramePixelThreshold = 0.10
+	// Noise tolerance for two frames to count as identical
+	frozenFrameNoise = "-60dB"
+	// Prefix of the metadata filter instance printing a canvas's detection events
+	frameCheckFilterName = "framecheck"
+)
+
+// frameCheckEventPattern matches detection events printed by a canvas's metadata filter.
+// FFmpeg prefixes a filter's log lines with its instance name, so "metadata@framecheck99"
+// logs e.g. "[framecheck99 @ 0x55d1c0a3e2c0] lavfi.black_start=12.4".
+var frameCheckEventPattern = regexp.MustCompile(`\[` + frameCheckFilterName + `(\d+) @ [^\]]*\] lavfi\.(black_start|black_end|freezedetect\.freeze_start|freezedetect\.freeze_end)=`)
+
+// FrameChecks configures black and frozen picture detection on every canvas.
+type FrameChecks struct {
+	// How long a canvas may stay black before Action is taken; 0 disables black detection
+	BlackThreshold time.Duration
+	// How long a canvas may stay frozen before Action is taken; 0 disables freeze detection
+	FrozenThreshold time.Duration
+	Action          string
+}
+
+// enabled reports whether any frame check is configured.
+func (c FrameChecks) enabled() bool {
+	return c.BlackThreshold > 0 || c.FrozenThreshold > 0
+}
+
+// loadDetectionAction reads a detector action from the environment, defaulting to log.
+func loadDetectionAction(key string, allowed ...string) (string, error) {
+	action := utils.GetEnvOrDefault(key, DetectionActionLog)
+	for _, a := range allowed {
+		if strings.EqualFold(action, a) {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s %q: expected one of %s", key, action, strings.Join(allowed, ", "))
+}
+
+// loadFrameChecks reads BLACK_FRAME_THRESHOLD, FROZEN_FRAME_THRESHOLD and FRAME_CHECK_ACTION.
+func loadFrameChecks(ctx context.Context) (FrameChecks, error) {
+	action, err := loadDetectionAction("FRAME_CHECK_ACTION", DetectionActionLog, DetectionActionReload, DetectionActionRestart)
+	if err != nil {
+		return FrameChecks{}, err
+	}
+	return FrameChecks{
+		BlackThreshold:  utils.GetSecondsFromEnv(ctx, "BLACK_FRAME_THRESHOLD", 0),
+		FrozenThreshold: utils.GetSecondsFromEnv(ctx, "FROZEN_FRAME_THRESHOLD", 0),
+		Action:          action,
+	}, nil
+}
+
+// lineWriter is an io.Writer that hands each complete line of FFmpeg output to a
+// handler. FFmpeg ends progress lines with '\r', so both terminators split lines.
+type lineWriter struct {
+	handle func(line string)
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := strings.IndexAny(string(w.buf), "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := string(w.buf[:i]); line != "" {
+			w.handle(line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+type frameIssueKey struct {
+	display int
+	kind    string
+}
+
+// frameMonitor inserts blackdetect/freezedetect into each canvas's capture chain and
+// acts on the events FFmpeg prints once a black or frozen picture outlasts its threshold.
+type frameMonitor struct {
+	ctx       context.Context
+	config    *Config
+	checks    FrameChecks
+	instances map[int]*chromeInstance
+	logger    *zap.Logger
+	// act runs the configured action; replaceable in tests
+	act func(display int, kind string)
+
+	mu     sync.Mutex
+	timers map[frameIssueKey]*time.Timer
+}
+
+// newFrameMonitor returns a monitor for the pipeline's canvases, or nil when frame
+// checks are disabled. instances maps display numbers to their browsers for reloads.
+func newFrameMonitor(ctx context.Context, config *Config, instances map[int]*chromeInstance) *frameMonitor {
+	if !config.FrameChecks.enabled() {
+		return nil
+	}
+	m := &frameMonitor{
+		ctx:       ctx,
+		config:    config,
+		checks:    config.FrameChecks,
+		instances: instances,
+		logger:    utils.GetLoggerFromContext(ctx),
+		timers:    make(map[frameIssueKey]*time.Timer),
+	}
+	m.act = m.runAction
+	return m
+}
+
+// filterChain returns the filters to run on a canvas's captured video, or "" if none.
+func (m *frameMonitor) filterChain(display int) string {
+	if m == nil {
+		return ""
+	}
+	var filters []string
+	if m.checks.BlackThreshold > 0 {
+		filters = append(filters, fmt.Sprintf("blackdetect=d=0.5:pic_th=%.2f:pix_th=%.2f", blackFramePixelRatio, blackFramePixelThreshold))
+	}
+	if m.checks.FrozenThreshold > 0 {
+		filters = append(filters, fmt.Sprintf("freezedetect=n=%s:d=%g", frozenFrameNoise, m.checks.FrozenThreshold.Seconds()))
+	}
+	// Both detectors tag frames with metadata when a condition starts and ends; printing
+	// it is the only way to see a black period start before it has ended
+	filters = append(filters, fmt.Sprintf("metadata@%s%d=mode=print", frameCheckFilterName, display))
+	return strings.Join(filters, ",")
+}
+
+// writer returns an io.Writer for FFmpeg's log output feeding the monitor.
+func (m *frameMonitor) writer() *lineWriter {
+	return &lineWriter{handle: m.handleLine}
+}
+
+func (m *frameMonitor) handleLine(line string) {
+	match := frameCheckEventPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	display, err := strconv.Atoi(match[1])
+	if err != nil {
+		return
+	}
+	switch match[2] {
+	case "black_start":
+		// blackdetect reports a black period as soon as it starts, so wait out the threshold
+		m.start(display, frameIssueBlack, m.checks.BlackThreshold)
+	case "black_end":
+		m.end(display, frameIssueBlack)
+	case "freezedetect.freeze_start":
+		// freezedetect only reports a freeze once it has lasted the threshold
+		m.start(display, frameIssueFrozen, 0)
+	case "freezedetect.freeze_end":
+		m.end(display, frameIssueFrozen)
+	}
+}
+
+// start begins tracking a broken picture and schedules the action after delay. The
+// action repeats every threshold for as long as the picture stays broken.
+func (m *frameMonitor) start(display int, kind string, delay time.Duration) {
+	key := frameIssueKey{display: display, kind: kind}
+	threshold := m.checks.BlackThreshold
+	if kind == frameIssueFrozen {
+		threshold = m.checks.FrozenThreshold
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, active := m.timers[key]; active {
+		return
+	}
+	m.logger.Debug("Canvas picture issue started", zap.Int("display", display), zap.String("kind", kind))
+
+	var fire func()
+	fire = func() {
+		m.mu.Lock()
+		if _, active := m.timers[key]; !active {
+			m.mu.Unlock()
+			return
+		}
+		m.timers[key] = time.AfterFunc(threshold, fire)
+		m.mu.Unlock()
+
+		labels := []string{strconv.Itoa(display), kind}
+		frameIssuesTotal.WithLabelValues(labels...).Inc()
+		frameIssueActive.WithLabelValues(labels...).Set(1)
+		m.logger.Warn("Canvas picture is broken, taking action",
+			zap.Int("display", display),
+			zap.String("kind", kind),
+			zap.Duration("threshold", threshold),
+			zap.String("action", m.checks.Action))
+		m.act(display, kind)
+	}
+	m.timers[key] = time.AfterFunc(delay, fire)
+}
+
+// end stops tracking a broken picture once FFmpeg reports it recovered.
+func (m *frameMonitor) end(display int, kind string) {
+	key := frameIssueKey{display: display, kind: kind}
+	m.mu.Lock()
+	timer, active := m.timers[key]
+	delete(m.timers, key)
+	m.mu.Unlock()
+	if !active {
+		return
+	}
+	timer.Stop()
+	frameIssueActive.WithLabelValues(strconv.Itoa(display), kind).Set(0)
+	m.logger.Info("Canvas picture recovered", zap.Int("display", display), zap.String("kind", kind))
+}
+
+// stop cancels all pending actions when the pipeline ends.
+func (m *frameMonitor) stop() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, timer := range m.timers {
+		timer.Stop()
+		frameIssueActive.WithLabelValues(strconv.Itoa(key.display), key.kind).Set(0)
+		delete(m.timers, key)
+	}
+}
+
+// runAction performs the configured action for a canvas.
+func (m *frameMonitor) runAction(display int, kind string) {
+	switch m.checks.Action {
+	case DetectionActionReload:
+		instance, ok := m.instances[display]
+		if !ok {
+			return
+		}
+		reloadCtx, cancel := context.WithTimeout(instance.context(), chromeReloadTimeout)
+		defer cancel()
+		if err := chromedp.Run(reloadCtx, chromedp.Reload()); err != nil {
+			m.logger.Error("Failed to reload page with broken picture",
+				zap.Int("display", display), zap.String("kind", kind), zap.Error(err))
+		}
+	case DetectionActionRestart:
+		if err := RestartStream(m.ctx, m.config); err != nil {
+			m.logger.Error("Failed to restart stream", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func testFrameMonitor(t *testing.T, checks FrameChecks) (*frameMonitor, chan frameIssueKey) {
+	t.Helper()
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+	m := newFrameMonitor(ctx, &Config{FrameChecks: checks}, nil)
+	if m == nil {
+		t.Fatal("Expected a frame monitor for enabled checks")
+	}
+	actions := make(chan frameIssueKey, 10)
+	m.act = func(display int, kind string) { actions <- frameIssueKey{display: display, kind: kind} }
+	t.Cleanup(m.stop)
+	return m, actions
+}
+
+func TestLoadFrameChecks(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	t.Run("Disabled By Default", func(t *testing.T) {
+		t.Setenv("BLACK_FRAME_THRESHOLD", "")
+		t.Setenv("FROZEN_FRAME_THRESHOLD", "")
+		t.Setenv("FRAME_CHECK_ACTION", "")
+		checks, err := loadFrameChecks(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if checks.enabled() || checks.Action != DetectionActionLog {
+			t.Errorf("Expected disabled checks with log action, got %+v", checks)
+		}
+		if newFrameMonitor(ctx, &Config{FrameChecks: checks}, nil) != nil {
+			t.Error("Expected no frame monitor when checks are disabled")
+		}
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		t.Setenv("BLACK_FRAME_THRESHOLD", "10")
+		t.Setenv("FROZEN_FRAME_THRESHOLD", "30")
+		t.Setenv("FRAME_CHECK_ACTION", "Reload")
+		checks, err := loadFrameChecks(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if checks.BlackThreshold != 10*time.Second || checks.FrozenThreshold != 30*time.Second || checks.Action != DetectionActionReload {
+			t.Errorf("Unexpected checks: %+v", checks)
+		}
+	})
+
+	t.Run("Invalid Action", func(t *testing.T) {
+		t.Setenv("FRAME_CHECK_ACTION", "reboot")
+		if _, err := loadFrameChecks(ctx); err == nil {
+			t.Error("Expected error for invalid action")
+		}
+	})
+}
+
+func TestFrameMonitorFilterChain(t *testing.T) {
+	var disabled *frameMonitor
+	if chain := disabled.filterChain(99); chain != "" {
+		t.Errorf("Expected no filters without a monitor, got %q", chain)
+	}
+
+	m, _ := testFrameMonitor(t, FrameChecks{BlackThreshold: 5 * time.Second, Action: DetectionActionLog})
+	chain := m.filterChain(99)
+	if !strings.HasPrefix(chain, "blackdetect=") || strings.Contains(chain, "freezedetect") {
+		t.Errorf("Expected only black detection, got %q", chain)
+	}
+	if !strings.HasSuffix(chain, "metadata@framecheck99=mode=print") {
+		t.Errorf("Expected chain to end with the display's metadata printer, got %q", chain)
+	}
+
+	m, _ = testFrameMonitor(t, FrameChecks{FrozenThreshold: 20 * time.Second, Action: DetectionActionLog})
+	if chain := m.filterChain(100); !strings.HasPrefix(chain, "freezedetect=n=-60dB:d=20,") {
+		t.Errorf("Expected freeze detection with threshold as duration, got %q", chain)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{handle: func(line string) { lines = append(lines, line) }}
+
+	w.Write([]byte("first\nframe=  10 fps=30\rframe=  20"))
+	w.Write([]byte(" fps=30\r\nlast"))
+
+	expected := []string{"first", "frame=  10 fps=30", "frame=  20 fps=30"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected lines %q, got %q", expected, lines)
+	}
+}
+
+func TestFrameMonitorEvents(t *testing.T) {
+	blackStart := "[framecheck99 @ 0x55d1c0a3e2c0] lavfi.black_start=12.4"
+	blackEnd := "[framecheck99 @ 0x55d1c0a3e2c0] lavfi.black_end=13.1"
+
+	t.Run("Black Past Threshold Triggers Action", func(t *testing.T) {
+		m, actions := testFrameMonitor(t, FrameChecks{BlackThreshold: 20 * time.Millisecond, Action: DetectionActionLog})
+		m.handleLine(blackStart)
+
+		select {
+		case got := <-actions:
+			if got.display != 99 || got.kind != frameIssueBlack {
+				t.Errorf("Unexpected action target: %+v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected action after black threshold")
+		}
+	})
+
+	t.Run("Black Ending Before Threshold Does Nothing", func(t *testing.T) {
+		m, actions := testFrameMonitor(t, FrameChecks{BlackThreshold: 50 * time.Millisecond, Action: DetectionActionLog})
+		m.handleLine(blackStart)
+		m.handleLine(blackEnd)
+
+		select {
+		case got := <-actions:
+			t.Errorf("Expected no action for a short black period, got %+v", got)
+		case <-time.After(150 * time.Millisecond):
+		}
+	})
+
+	t.Run("Freeze Acts Immediately", func(t *testing.T) {
+		m, actions := testFrameMonitor(t, FrameChecks{FrozenThreshold: time.Hour, Action: DetectionActionLog})
+		m.handleLine("[framecheck100 @ 0x55d1c0a41f80] lavfi.freezedetect.freeze_start=30.2")
+
+		select {
+		case got := <-actions:
+			if got.display != 100 || got.kind != frameIssueFrozen {
+				t.Errorf("Unexpected action target: %+v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected action once freezedetect reports a freeze")
+		}
+	})
+
+	t.Run("Unrelated Lines Ignored", func(t *testing.T) {
+		m, actions := testFrameMonitor(t, FrameChecks{BlackThreshold: time.Millisecond, Action: DetectionActionLog})
+		m.handleLine("[framecheck99 @ 0x55d1c0a3e2c0] frame:120  pts:4000    pts_time:4")
+		m.handleLine("[Parsed_blackdetect_0 @ 0x55d1c0a3c100] black_start:12.4 black_end:13.1 black_duration:0.7")
+
+		select {
+		case got := <-actions:
+			t.Errorf("Expected no action, got %+v", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default number of times a retryable Go Live API failure is retried
+	DefaultGoLiveRetries = 3
+	// Default wait before the first Go Live retry, in seconds; doubles on each retry
+	DefaultGoLiveRetryBackoff = 2
+	// Default interval between attempts to return to Enhanced Broadcasting while
+	// streaming the standard configuration, in seconds
+	DefaultGoLiveReattemptInterval = 300
+	// Default minimum age, in seconds, before the Go Live configuration is re-negotiated
+	// on a stream restart; 0 re-negotiates on every restart
+	DefaultGoLiveConfigTTL = 0
+	// Upper bound on the wait between Go Live retries
+	goLiveMaxRetryBackoff = 30 * time.Second
+)
+
+// Where the current Enhanced Broadcasting configuration came from
+const (
+	goLiveSourceAPI      = "api"
+	goLiveSourceCache    = "cache"
+	goLiveSourceFallback = "fallback"
+)
+
+// goLiveNegotiator obtains the Enhanced Broadcasting configuration from the Go Live
+// API, falling back to the last good response saved on disk and then to the
+// standard configuration.
+type goLiveNegotiator struct {
+	streamKey string
+	opts      twitch.GoLiveOptions
+	retry     twitch.GoLiveRetryPolicy
+	// cacheFile is where the last good response is saved; empty disables the cache
+	cacheFile string
+	// reattemptInterval is how often enhanced mode is retried while on the standard
+	// configuration; 0 disables re-attempts
+	reattemptInterval time.Duration
+	// configTTL is how old the configuration must be before a stream restart
+	// re-negotiates it; 0 re-negotiates on every restart
+	configTTL time.Duration
+
+	mu     sync.Mutex
+	source string
+	// negotiatedAt is when the Go Live API last answered with a usable configuration
+	negotiatedAt time.Time
+}
+
+// newGoLiveNegotiator reads the retry, cache and re-attempt settings from the environment.
+func newGoLiveNegotiator(ctx context.Context, streamKey string, opts twitch.GoLiveOptions) *goLiveNegotiator {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	retries := DefaultGoLiveRetries
+	if retriesStr := utils.GetEnvOrDefault("TWITCH_GO_LIVE_RETRIES", ""); retriesStr != "" {
+		parsed, err := strconv.Atoi(retriesStr)
+		if err != nil || parsed < 0 {
+			logger.Warn("Invalid TWITCH_GO_LIVE_RETRIES value, using default",
+				zap.String("invalidValue", retriesStr), zap.Int("default", DefaultGoLiveRetries))
+		} else {
+			retries = parsed
+		}
+	}
+
+	return &goLiveNegotiator{
+		streamKey: streamKey,
+		opts:      opts,
+		retry: twitch.GoLiveRetryPolicy{
+			Retries:        retries,
+			InitialBackoff: utils.GetSecondsFromEnv(ctx, "TWITCH_GO_LIVE_RETRY_BACKOFF", DefaultGoLiveRetryBackoff),
+			MaxBackoff:     goLiveMaxRetryBackoff,
+		},
+		cacheFile:         utils.GetEnvOrDefault("TWITCH_GO_LIVE_CACHE_FILE", ""),
+		reattemptInterval: utils.GetSecondsFromEnv(ctx, "TWITCH_GO_LIVE_REATTEMPT_INTERVAL", DefaultGoLiveReattemptInterval),
+		configTTL:         utils.GetSecondsFromEnv(ctx, "TWITCH_GO_LIVE_CONFIG_TTL", DefaultGoLiveConfigTTL),
+	}
+}
+
+// currentSource returns where the configuration last applied came from.
+func (n *goLiveNegotiator) currentSource() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.source
+}
+
+func (n *goLiveNegotiator) setSource(source string) {
+	n.mu.Lock()
+	n.source = source
+	n.mu.Unlock()
+	if source == goLiveSourceFallback {
+		goLiveDegraded.Set(1)
+	} else {
+		goLiveDegraded.Set(0)
+	}
+}
+
+// configure applies the Enhanced Broadcasting configuration to config, from the API
+// or else from the cache. It returns false, leaving config untouched, when neither
+// works and the standard configuration has to be streamed.
+func (n *goLiveNegotiator) configure(ctx context.Context, config *Config) bool {
+	if n.fromAPI(ctx, config) {
+		n.setSource(goLiveSourceAPI)
+		return true
+	}
+	if n.fromCache(ctx, config) {
+		n.setSource(goLiveSourceCache)
+		return true
+	}
+	n.setSource(goLiveSourceFallback)
+	return false
+}
+
+// refresh re-negotiates the configuration before a stream restart, returning the
+// configuration to stream next. A configuration younger than the TTL is kept, and so
+// is the current one if the API fails. The standard configuration is left to
+// watchGoLiveFallback.
+func (n *goLiveNegotiator) refresh(ctx context.Context, config *Config) *Config {
+	n.mu.Lock()
+	source, age := n.source, time.Since(n.negotiatedAt)
+	n.mu.Unlock()
+	if source == goLiveSourceFallback || (source == goLiveSourceAPI && age < n.configTTL) {
+		return config
+	}
+
+	logger := utils.GetLoggerFromContext(ctx)
+	logger.Info("Re-negotiating Enhanced Broadcasting configuration", zap.String("source", source))
+	updated := *config
+	if !n.fromAPI(ctx, &updated) {
+		logger.Warn("Failed to refresh Go Live configuration, keeping the previous one",
+			zap.String("source", source))
+		return config
+	}
+	n.setSource(goLiveSourceAPI)
+	return &updated
+}
+
+// fromAPI calls the Go Live API, with retries, and applies its response to config.
+// A good response is saved to the cache file.
+func (n *goLiveNegotiator) fromAPI(ctx context.Context, config *Config) bool {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	resp, err := twitch.CallGoLiveAPIWithRetry(ctx, n.streamKey, n.opts, n.retry)
+	if err != nil {
+		logger.Warn("Go Live API call failed", zap.Error(err))
+		return false
+	}
+	if !n.apply(ctx, config, resp) {
+		return false
+	}
+	n.mu.Lock()
+	n.negotiatedAt = time.Now()
+	n.mu.Unlock()
+
+	if n.cacheFile != "" {
+		if err := twitch.SaveGoLiveResponse(n.cacheFile, n.streamKey, n.opts, resp); err != nil {
+			logger.Warn("Failed to save Go Live response", zap.String("path", n.cacheFile), zap.Error(err))
+		}
+	}
+
+	logger.Info("Enhanced Broadcasting configured from Go Live API",
+		zap.String("configId", resp.Meta.ConfigID),
+		zap.Int("numTracks", len(config.Outputs)),
+		zap.String("rtmpURL", config.RTMPURL))
+	return true
+}
+
+// fromCache applies the last good response saved to the cache file, if there is one
+// for the same stream key and preferences.
+func (n *goLiveNegotiator) fromCache(ctx context.Context, config *Config) bool {
+	if n.cacheFile == "" {
+		return false
+	}
+	logger := utils.GetLoggerFromContext(ctx)
+
+	resp, savedAt, err := twitch.LoadGoLiveResponse(n.cacheFile, n.streamKey, n.opts)
+	if err != nil {
+		logger.Warn("No usable cached Go Live response", zap.String("path", n.cacheFile), zap.Error(err))
+		return false
+	}
+	if !n.apply(ctx, config, resp) {
+		return false
+	}
+
+	logger.Warn("Enhanced Broadcasting configured from cached Go Live response",
+		zap.String("configId", resp.Meta.ConfigID),
+		zap.Duration("age", time.Since(savedAt).Round(time.Second)),
+		zap.Int("numTracks", len(config.Outputs)))
+	return true
+}
+
+// apply converts resp into config, leaving config untouched if the response is unusable.
+func (n *goLiveNegotiator) apply(ctx context.Context, config *Config, resp *twitch.GoLiveResponse) bool {
+	updated := *config
+	if err := applyGoLiveConfig(ctx, &updated, resp); err != nil {
+		utils.GetLoggerFromContext(ctx).Warn("Failed to apply Go Live API configuration", zap.Error(err))
+		return false
+	}
+	*config = updated
+	return true
+}
+
+// configUpdate hands a replacement configuration to the main loop, which picks it up
+// before starting the next stream.
+type configUpdate struct {
+	mu   sync.Mutex
+	next *Config
+}
+
+// set queues config for the next stream start, replacing any queued configuration.
+func (u *configUpdate) set(config *Config) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.next = config
+}
+
+// take returns the queued configuration, if any, and clears it.
+func (u *configUpdate) take() *Config {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	next := u.next
+	u.next = nil
+	return next
+}
+
+// watchGoLiveFallback periodically re-attempts Enhanced Broadcasting while config is
+// the standard configuration it fell back to. Once the Go Live API answers, the
+// enhanced configuration is queued and the stream restarted onto it. Runs until ctx
+// is cancelled or enhanced mode is restored.
+func watchGoLiveFallback(ctx context.Context, config *Config) {
+	n := config.GoLive
+	if n == nil || n.currentSource() != goLiveSourceFallback || n.reattemptInterval == 0 {
+		return
+	}
+	logger := utils.GetLoggerFromContext(ctx)
+	logger.Info("Streaming standard configuration, will re-attempt Enhanced Broadcasting",
+		zap.Duration("interval", n.reattemptInterval))
+
+	ticker := time.NewTicker(n.reattemptInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		updated := *config
+		if !n.fromAPI(ctx, &updated) {
+			logger.Info("Enhanced Broadcasting still unavailable, staying on standard configuration",
+				zap.Duration("retryIn", n.reattemptInterval))
+			continue
+		}
+
+		n.setSource(goLiveSourceAPI)
+		globalConfigUpdate.set(&updated)
+		logger.Info("Enhanced Broadcasting available again, restarting stream")
+		if err := RestartStream(ctx, &updated); err != nil {
+			logger.Error("Failed to restart stream", zap.Error(err))
+		}
+		return
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// newSwitchableGoLiveServer answers like the mock server's success scenario while
+// available is true and with HTTP 503 otherwise. Calls are counted in calls, if set.
+func newSwitchableGoLiveServer(t *testing.T, logger *zap.Logger, available *atomic.Bool, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	mock := twitch.NewMockGoLiveHandler(logger, twitch.MockScenarioSuccess, "rtmp://127.0.0.1:1935/live/{stream_key}")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls != nil {
+			calls.Add(1)
+		}
+		if !available.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testGoLiveNegotiator(url, cacheFile string) *goLiveNegotiator {
+	return &goLiveNegotiator{
+		streamKey:         "live_test_key",
+		opts:              twitch.GoLiveOptions{APIURL: url},
+		retry:             twitch.GoLiveRetryPolicy{Retries: 1, InitialBackoff: time.Millisecond},
+		cacheFile:         cacheFile,
+		reattemptInterval: 10 * time.Millisecond,
+	}
+}
+
+func TestGoLiveNegotiatorConfigure(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	var available atomic.Bool
+	server := newSwitchableGoLiveServer(t, logger, &available, nil)
+	fallbackURL := "rtmp://fallback.example.com/live/stream"
+
+	t.Run("Uses Cached Response When API Fails", func(t *testing.T) {
+		n := testGoLiveNegotiator(server.URL, filepath.Join(t.TempDir(), "golive.json"))
+
+		available.Store(true)
+		if !n.configure(ctx, &Config{RTMPURL: fallbackURL}) {
+			t.Fatal("Expected the API to configure Enhanced Broadcasting")
+		}
+		if n.currentSource() != goLiveSourceAPI {
+			t.Errorf("Expected source %q, got %q", goLiveSourceAPI, n.currentSource())
+		}
+
+		available.Store(false)
+		config := &Config{RTMPURL: fallbackURL}
+		if !n.configure(ctx, config) {
+			t.Fatal("Expected the cached response to configure Enhanced Broadcasting")
+		}
+		if n.currentSource() != goLiveSourceCache {
+			t.Errorf("Expected source %q, got %q", goLiveSourceCache, n.currentSource())
+		}
+		if config.RTMPURL != "rtmp://127.0.0.1:1935/live/live_test_key?clientConfigId=mock-success" {
+			t.Errorf("Expected the cached ingest URL, got %q", config.RTMPURL)
+		}
+		if len(config.Outputs) != 3 {
+			t.Errorf("Expected 3 outputs from the cache, got %d", len(config.Outputs))
+		}
+		if got := testutil.ToFloat64(goLiveDegraded); got != 0 {
+			t.Errorf("Expected degraded gauge 0, got %v", got)
+		}
+	})
+
+	t.Run("Falls Back Without Cache", func(t *testing.T) {
+		n := testGoLiveNegotiator(server.URL, "")
+
+		available.Store(false)
+		config := &Config{RTMPURL: fallbackURL}
+		if n.configure(ctx, config) {
+			t.Fatal("Expected configure to report the fallback")
+		}
+		if n.currentSource() != goLiveSourceFallback {
+			t.Errorf("Expected source %q, got %q", goLiveSourceFallback, n.currentSource())
+		}
+		if config.RTMPURL != fallbackURL || config.Outputs != nil {
+			t.Errorf("Expected config to be left untouched, got %+v", config)
+		}
+		if got := testutil.ToFloat64(goLiveDegraded); got != 1 {
+			t.Errorf("Expected degraded gauge 1, got %v", got)
+		}
+	})
+}
+
+func TestWatchGoLiveFallback(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx, cancel := context.WithCancel(utils.SaveLoggerToContext(context.Background(), logger))
+	defer cancel()
+
+	var available atomic.Bool
+	server := newSwitchableGoLiveServer(t, logger, &available, nil)
+
+	n := testGoLiveNegotiator(server.URL, "")
+	config := &Config{RTMPURL: "rtmp://fallback.example.com/live/stream", GoLive: n}
+	if n.configure(ctx, config) {
+		t.Fatal("Expected configure to report the fallback")
+	}
+	globalConfigUpdate.take()
+
+	done := make(chan struct{})
+	go func() {
+		watchGoLiveFallback(ctx, config)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if next := globalConfigUpdate.take(); next != nil {
+		t.Fatal("Expected no configuration update while the API is unavailable")
+	}
+
+	available.Store(true)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the watcher to return once Enhanced Broadcasting recovered")
+	}
+
+	next := globalConfigUpdate.take()
+	if next == nil {
+		t.Fatal("Expected an updated configuration to be queued")
+	}
+	if len(next.Outputs) != 3 {
+		t.Errorf("Expected 3 outputs, got %d", len(next.Outputs))
+	}
+	if n.currentSource() != goLiveSourceAPI {
+		t.Errorf("Expected source %q, got %q", goLiveSourceAPI, n.currentSource())
+	}
+	if config.RTMPURL != "rtmp://fallback.example.com/live/stream" {
+		t.Errorf("Expected the running configuration to be left untouched, got %q", config.RTMPURL)
+	}
+}
+
+func TestGoLiveNegotiatorRefresh(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	var available atomic.Bool
+	var calls atomic.Int32
+	server := newSwitchableGoLiveServer(t, logger, &available, &calls)
+
+	// negotiated returns a negotiator and the configuration it applied from the API
+	negotiated := func(t *testing.T) (*goLiveNegotiator, *Config) {
+		t.Helper()
+		available.Store(true)
+		n := testGoLiveNegotiator(server.URL, "")
+		config := &Config{RTMPURL: "rtmp://fallback.example.com/live/stream", GoLive: n}
+		if !n.configure(ctx, config) {
+			t.Fatal("Expected the API to configure Enhanced Broadcasting")
+		}
+		calls.Store(0)
+		return n, config
+	}
+
+	t.Run("Re-Negotiates On Every Restart Without TTL", func(t *testing.T) {
+		n, config := negotiated(t)
+
+		next := n.refresh(ctx, config)
+		if calls.Load() != 1 {
+			t.Errorf("Expected 1 Go Live call, got %d", calls.Load())
+		}
+		if next == config {
+			t.Error("Expected a new configuration from the fresh response")
+		}
+		if len(next.Outputs) != 3 || next.RTMPURL != config.RTMPURL {
+			t.Errorf("Expected the outputs and RTMP URL to be rebuilt, got %+v", next)
+		}
+	})
+
+	t.Run("Keeps Configuration Younger Than TTL", func(t *testing.T) {
+		n, config := negotiated(t)
+		n.configTTL = time.Hour
+
+		if next := n.refresh(ctx, config); next != config {
+			t.Error("Expected the current configuration to be kept")
+		}
+		if calls.Load() != 0 {
+			t.Errorf("Expected no Go Live call, got %d", calls.Load())
+		}
+	})
+
+	t.Run("Keeps Configuration When API Fails", func(t *testing.T) {
+		n, config := negotiated(t)
+		available.Store(false)
+
+		if next := n.refresh(ctx, config); next != config {
+			t.Error("Expected the current configuration to be kept")
+		}
+		if n.currentSource() != goLiveSourceAPI {
+			t.Errorf("Expected source %q, got %q", goLiveSourceAPI, n.currentSource())
+		}
+	})
+
+	t.Run("Leaves Standard Configuration To Fallback Watcher", func(t *testing.T) {
+		n := testGoLiveNegotiator(server.URL, "")
+		n.setSource(goLiveSourceFallback)
+		config := &Config{RTMPURL: "rtmp://fallback.example.com/live/stream", GoLive: n}
+		calls.Store(0)
+		available.Store(true)
+
+		if next := n.refresh(ctx, config); next != config {
+			t.Error("Expected the standard configuration to be kept")
+		}
+		if calls.Load() != 0 {
+			t.Errorf("Expected no Go Live call, got %d", calls.Load())
+		}
+	})
+}
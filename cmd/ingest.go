@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default seconds within which an FFmpeg run that fails counts as a failed
+	// connection to the ingest rather than a dropped stream
+	DefaultIngestConnectTimeout = 20
+	// Default number of consecutive failed connections before failing over to the next ingest
+	DefaultIngestFailoverAfter = 3
+	// Default seconds between checks whether the primary ingest is reachable again
+	// while streaming to a backup
+	DefaultIngestFailbackInterval = 60
+	// How long a failback probe waits for the primary ingest to complete the RTMP handshake
+	ingestProbeTimeout = 5 * time.Second
+	// Upper bound for the failback interval once it has been doubled after failed failbacks
+	ingestFailbackMaxInterval = time.Hour
+	// RTMP protocol version sent and expected in the handshake's first byte
+	rtmpVersion = 3
+	// Size of the RTMP handshake's C1 and S1 chunks
+	rtmpHandshakeSize = 1536
+)
+
+// ingestEndpoint is one URL FFmpeg can publish the stream to.
+type ingestEndpoint struct {
+	URL string
+	// Name identifies the endpoint in logs, metrics and status without its stream key
+	Name string
+}
+
+// newIngestEndpoint names rawURL after its scheme and host, which never hold the stream key.
+func newIngestEndpoint(rawURL string) ingestEndpoint {
+	name := "invalid"
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		name = parsed.Scheme + "://" + parsed.Host
+	}
+	return ingestEndpoint{URL: rawURL, Name: name}
+}
+
+// ingestList is the ordered list of endpoints the stream can be published to. FFmpeg
+// publishes to the active one, moving on to the next after failoverAfter consecutive
+// failed connections.
+type ingestList struct {
+	endpoints     []ingestEndpoint
+	failoverAfter int
+
+	mu       sync.Mutex
+	active   int
+	failures int
+	// failingBack is set while FFmpeg is stopped to move it back to the primary
+	failingBack bool
+	// onFailbackTrial is set from a failback until the primary connects or fails over again
+	onFailbackTrial bool
+	// failedFailbacks counts failbacks in a row after which the primary failed over
+	// again; each doubles the failback interval
+	failedFailbacks int
+}
+
+func newIngestList(endpoints []ingestEndpoint, failoverAfter int) *ingestList {
+	if failoverAfter < 1 {
+		failoverAfter = 1
+	}
+	return &ingestList{endpoints: endpoints, failoverAfter: failoverAfter}
+}
+
+// current returns the endpoint FFmpeg should publish to.
+func (l *ingestList) current() ingestEndpoint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.endpoints[l.active]
+}
+
+// connected records that FFmpeg got the stream through to the active endpoint.
+func (l *ingestList) connected() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures = 0
+	if l.active == 0 {
+		l.onFailbackTrial = false
+		l.failedFailbacks = 0
+	}
+}
+
+// connectFailed records a failed connection to the active endpoint. It reports whether
+// that made the list fail over to the next endpoint, and whether every endpoint has
+// now failed, in which case the list starts over from the first.
+func (l *ingestList) connectFailed() (switched bool, exhausted bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures++
+	if l.failures < l.failoverAfter {
+		return false, false
+	}
+	l.failures = 0
+	if l.active == 0 && l.onFailbackTrial {
+		l.onFailbackTrial = false
+		l.failedFailbacks++
+	}
+	l.active++
+	if l.active >= len(l.endpoints) {
+		l.active = 0
+		return false, true
+	}
+	return true, false
+}
+
+// primary returns the first, preferred endpoint.
+func (l *ingestList) primary() ingestEndpoint {
+	return l.endpoints[0]
+}
+
+// onBackup returns whether an endpoint other than the primary is active.
+func (l *ingestList) onBackup() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active != 0
+}
+
+// failBack makes the primary active again, returning false if it already was. The
+// FFmpeg run that ends next is then taken as the switch rather than a failure, so it
+// must only be called while a run is active.
+func (l *ingestList) failBack() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active == 0 {
+		return false
+	}
+	l.active = 0
+	l.failures = 0
+	l.failingBack = true
+	l.onFailbackTrial = true
+	return true
+}
+
+// failbackInterval returns how long to wait before probing the primary again: interval,
+// doubled for every failback in a row that failed over again, up to
+// ingestFailbackMaxInterval (or interval, if that is longer).
+func (l *ingestList) failbackInterval(interval time.Duration) time.Duration {
+	l.mu.Lock()
+	failed := l.failedFailbacks
+	l.mu.Unlock()
+	for ; failed > 0 && interval*2 <= ingestFailbackMaxInterval; failed-- {
+		interval *= 2
+	}
+	return interval
+}
+
+// takeFailBack returns whether a failback is pending, and clears it.
+func (l *ingestList) takeFailBack() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failingBack := l.failingBack
+	l.failingBack = false
+	return failingBack
+}
+
+// loadIngestFailoverAfter reads INGEST_FAILOVER_AFTER.
+func loadIngestFailoverAfter(ctx context.Context) int {
+	value := utils.GetEnvOrDefault("INGEST_FAILOVER_AFTER", "")
+	if value == "" {
+		return DefaultIngestFailoverAfter
+	}
+	failoverAfter, err := strconv.Atoi(value)
+	if err != nil || failoverAfter < 1 {
+		utils.GetLoggerFromContext(ctx).Warn("Invalid INGEST_FAILOVER_AFTER value, using default",
+			zap.String("invalidValue", value), zap.Int("default", DefaultIngestFailoverAfter))
+		return DefaultIngestFailoverAfter
+	}
+	return failoverAfter
+}
+
+// loadBackupIngests reads the comma-separated RTMP_BACKUP_URLS, returning the list of
+// config.RTMPURL followed by the backups, or nil when there are none.
+func loadBackupIngests(ctx context.Context, config *Config) *ingestList {
+	endpoints := []ingestEndpoint{newIngestEndpoint(config.RTMPURL)}
+	for _, backup := range strings.Split(utils.GetEnvOrDefault("RTMP_BACKUP_URLS", ""), ",") {
+		if backup = strings.TrimSpace(backup); backup != "" {
+			endpoints = append(endpoints, newIngestEndpoint(backup))
+		}
+	}
+	if len(endpoints) == 1 {
+		return nil
+	}
+
+	names := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		names[i] = endpoint.Name
+	}
+	utils.GetLoggerFromContext(ctx).Info("Backup RTMP destinations configured",
+		zap.Strings("ingests", names),
+		zap.Int("failoverAfter", config.IngestFailoverAfter))
+	return newIngestList(endpoints, config.IngestFailoverAfter)
+}
+
+// ingestURL returns the URL FFmpeg should publish to: the active ingest endpoint, or
+// RTMPURL when there is no list to choose from.
+func (c *Config) ingestURL() string {
+	if c.Ingests == nil {
+		return c.RTMPURL
+	}
+	return c.Ingests.current().URL
+}
+
+// recordIngest exposes the endpoint FFmpeg is about to publish to on the status and
+// the ingest metric.
+func recordIngest(config *Config) {
+	name := newIngestEndpoint(config.RTMPURL).Name
+	if config.Ingests != nil {
+		name = config.Ingests.current().Name
+	}
+	globalStreamState.setIngest(name)
+	ingestActive.Reset()
+	ingestActive.WithLabelValues(name).Set(1)
+}
+
+// ingestConnectFailed handles an FFmpeg run that failed before connecting, failing
+// over to the next endpoint when due. It returns false once every endpoint failed.
+func ingestConnectFailed(logger *zap.Logger, config *Config, err error) bool {
+	if config.Ingests == nil {
+		return true
+	}
+	from := config.Ingests.current()
+	switched, exhausted := config.Ingests.connectFailed()
+	if exhausted {
+		return false
+	}
+	if switched {
+		to := config.Ingests.current()
+		ingestFailoversTotal.WithLabelValues(from.Name).Inc()
+		logger.Warn("Failed to connect to ingest, failing over to the next one",
+			zap.String("from", from.Name),
+			zap.String("to", to.Name),
+			zap.Error(err))
+	}
+	return true
+}
+
+// probeIngest checks whether the ingest at rawURL answers an RTMP handshake, over TLS
+// for rtmps. A server can still refuse to publish, which the failback hold-down in
+// ingestList covers.
+func probeIngest(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "1935"
+		if parsed.Scheme == "rtmps" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(parsed.Hostname(), port)
+
+	dialer := &net.Dialer{Timeout: ingestProbeTimeout}
+	var conn net.Conn
+	if parsed.Scheme == "rtmps" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: parsed.Hostname()}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(ingestProbeTimeout)); err != nil {
+		return err
+	}
+
+	// C0 is the version; C1 is a zero timestamp, zero bytes and random filler
+	c0c1 := make([]byte, 1+rtmpHandshakeSize)
+	c0c1[0] = rtmpVersion
+	rand.Read(c0c1[9:])
+	if _, err := conn.Write(c0c1); err != nil {
+		return err
+	}
+	s0s1 := make([]byte, 1+rtmpHandshakeSize)
+	if _, err := io.ReadFull(conn, s0s1); err != nil {
+		return fmt.Errorf("incomplete RTMP handshake: %w", err)
+	}
+	if s0s1[0] != rtmpVersion {
+		return fmt.Errorf("unexpected RTMP version %d", s0s1[0])
+	}
+	return nil
+}
+
+// watchIngestFailback periodically probes the primary ingest while FFmpeg publishes
+// to a backup, and restarts FFmpeg onto the primary once it completes a handshake
+// again. The interval doubles after each failback that failed over again. Runs until
+// ctx is cancelled; INGEST_FAILBACK_INTERVAL=0 disables it.
+func watchIngestFailback(ctx context.Context, config *Config) {
+	if config.Ingests == nil || config.IngestFailbackInterval == 0 {
+		return
+	}
+	logger := utils.GetLoggerFromContext(ctx)
+	primary := config.Ingests.primary()
+
+	for {
+		if !sleepContext(ctx, config.Ingests.failbackInterval(config.IngestFailbackInterval)) {
+			return
+		}
+		if !config.Ingests.onBackup() {
+			continue
+		}
+		if err := probeIngest(ctx, primary.URL); err != nil {
+			logger.Debug("Primary ingest still unreachable", zap.String("ingest", primary.Name), zap.Error(err))
+			continue
+		}
+		// Only fail back while a run is active to be stopped, or the next genuine
+		// failure would be mistaken for the switch
+		if !globalStreamState.stopFFmpeg(logger, func() bool {
+			if !config.Ingests.failBack() {
+				return false
+			}
+			ingestFailbacksTotal.Inc()
+			logger.Info("Primary ingest reachable again, failing back", zap.String("ingest", primary.Name))
+			return true
+		}) {
+			logger.Debug("No FFmpeg run to fail back, retrying later", zap.String("ingest", primary.Name))
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func testIngestList(failoverAfter int) *ingestList {
+	return newIngestList([]ingestEndpoint{
+		newIngestEndpoint("rtmp://primary.example.com/app/live_key"),
+		newIngestEndpoint("rtmps://backup.example.com:443/app/live_key"),
+	}, failoverAfter)
+}
+
+func TestNewIngestEndpoint(t *testing.T) {
+	endpoint := newIngestEndpoint("rtmps://sea02.contribute.live-video.net:443/app/live_secret?clientConfigId=abc")
+	if endpoint.Name != "rtmps://sea02.contribute.live-video.net:443" {
+		t.Errorf("Expected the name to be the scheme and host, got %q", endpoint.Name)
+	}
+	if strings.Contains(endpoint.Name, "live_secret") {
+		t.Errorf("Expected the name not to contain the stream key, got %q", endpoint.Name)
+	}
+	if got := newIngestEndpoint("not a url").Name; got != "invalid" {
+		t.Errorf("Expected an unparseable URL to be named invalid, got %q", got)
+	}
+}
+
+func TestIngestList(t *testing.T) {
+	t.Run("Fails Over After Consecutive Failures", func(t *testing.T) {
+		list := testIngestList(2)
+
+		if switched, exhausted := list.connectFailed(); switched || exhausted {
+			t.Errorf("Expected no failover after one failure, got switched=%v exhausted=%v", switched, exhausted)
+		}
+		if switched, _ := list.connectFailed(); !switched {
+			t.Error("Expected a failover after two failures")
+		}
+		if list.current().Name != "rtmps://backup.example.com:443" {
+			t.Errorf("Expected the backup to be active, got %q", list.current().Name)
+		}
+	})
+
+	t.Run("Connection Resets Failure Count", func(t *testing.T) {
+		list := testIngestList(2)
+
+		list.connectFailed()
+		list.connected()
+		if switched, _ := list.connectFailed(); switched {
+			t.Error("Expected a successful connection to reset the failure count")
+		}
+	})
+
+	t.Run("Failed Failbacks Double The Interval", func(t *testing.T) {
+		list := testIngestList(1)
+		list.connectFailed()
+
+		for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+			if got := list.failbackInterval(time.Minute); got != want {
+				t.Errorf("Expected failback interval %v, got %v", want, got)
+			}
+			list.failBack()
+			list.takeFailBack()
+			list.connectFailed()
+		}
+
+		list.failBack()
+		list.connected()
+		if got := list.failbackInterval(time.Minute); got != time.Minute {
+			t.Errorf("Expected a connected failback to reset the interval, got %v", got)
+		}
+		list.failedFailbacks = 10
+		if got := list.failbackInterval(time.Minute); got != 32*time.Minute {
+			t.Errorf("Expected the interval to be capped below %v, got %v", ingestFailbackMaxInterval, got)
+		}
+	})
+
+	t.Run("Starts Over Once Every Endpoint Failed", func(t *testing.T) {
+		list := testIngestList(1)
+
+		list.connectFailed()
+		switched, exhausted := list.connectFailed()
+		if switched || !exhausted {
+			t.Errorf("Expected the list to be exhausted, got switched=%v exhausted=%v", switched, exhausted)
+		}
+		if list.current().Name != "rtmp://primary.example.com" {
+			t.Errorf("Expected the first endpoint to be active again, got %q", list.current().Name)
+		}
+	})
+}
+
+func TestApplyGoLiveConfigIngests(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	resp := &twitch.GoLiveResponse{
+		Meta: twitch.GoLiveMeta{ConfigID: "cfg"},
+		IngestEndpoints: []twitch.GoLiveIngestEndpoint{
+			{Protocol: "SRT", URLTemplate: "srt://sea02.contribute.live-video.net:4000?streamid={stream_key}", Authentication: "key"},
+			{Protocol: "RTMP", URLTemplate: "rtmp://sea02.contribute.live-video.net/app/{stream_key}", Authentication: "key"},
+			{Protocol: "RTMPS", URLTemplate: "rtmps://sea02.contribute.live-video.net:443/app/{stream_key}", Authentication: "key"},
+		},
+		EncoderConfigurations: []twitch.GoLiveEncoderConfiguration{
+			{Type: "obs_x264", Width: 1920, Height: 1080, Settings: twitch.GoLiveEncoderSettings{Bitrate: 6000}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		preferRTMPS bool
+		expected    []string
+	}{
+		{
+			name: "Prefers RTMP By Default",
+			expected: []string{
+				"rtmp://sea02.contribute.live-video.net/app/key?clientConfigId=cfg",
+				"rtmps://sea02.contribute.live-video.net:443/app/key?clientConfigId=cfg",
+			},
+		},
+		{
+			name:        "Prefers RTMPS When Configured",
+			preferRTMPS: true,
+			expected: []string{
+				"rtmps://sea02.contribute.live-video.net:443/app/key?clientConfigId=cfg",
+				"rtmp://sea02.contribute.live-video.net/app/key?clientConfigId=cfg",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{PreferRTMPS: tt.preferRTMPS}
+			if err := applyGoLiveConfig(ctx, config, resp); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if config.RTMPURL != tt.expected[0] {
+				t.Errorf("Expected RTMP URL %q, got %q", tt.expected[0], config.RTMPURL)
+			}
+			if len(config.Ingests.endpoints) != len(tt.expected) {
+				t.Fatalf("Expected %d ingest endpoints, got %d", len(tt.expected), len(config.Ingests.endpoints))
+			}
+			for i, endpoint := range config.Ingests.endpoints {
+				if endpoint.URL != tt.expected[i] {
+					t.Errorf("Expected ingest %d to be %q, got %q", i, tt.expected[i], endpoint.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestSuperviseFFmpegIngestFailover(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+	t.Cleanup(resetGlobalStreamState)
+
+	pipeline := newFakePipeline()
+	config := testPipelineConfig()
+	config.Ingests = testIngestList(1)
+	// Every exit counts as a failed connection
+	config.IngestConnectTimeout = time.Hour
+	failovers := testutil.ToFloat64(ingestFailoversTotal.WithLabelValues("rtmp://primary.example.com"))
+	result := pipeline.start(ctx, config)
+
+	pipeline.nextEncoder(t).crash(errors.New("connection refused"))
+	pipeline.nextEncoder(t)
+
+	if got := config.ingestURL(); got != "rtmps://backup.example.com:443/app/live_key" {
+		t.Errorf("Expected FFmpeg to publish to the backup, got %q", got)
+	}
+	if got := globalStreamState.activeIngest(); got != "rtmps://backup.example.com:443" {
+		t.Errorf("Expected the status to report the backup, got %q", got)
+	}
+	if got := testutil.ToFloat64(ingestFailoversTotal.WithLabelValues("rtmp://primary.example.com")); got != failovers+1 {
+		t.Errorf("Expected one failover to be counted, got %v", got-failovers)
+	}
+	if got := testutil.ToFloat64(ingestActive.WithLabelValues("rtmps://backup.example.com:443")); got != 1 {
+		t.Errorf("Expected the backup to be the active ingest, got %v", got)
+	}
+	if n := pipeline.events.count("display start :99"); n != 1 {
+		t.Errorf("Expected the display to keep running, started %d times", n)
+	}
+
+	StopCurrentStream(ctx)
+	if err := waitForResult(t, result); err != nil {
+		t.Errorf("Expected no error after a deliberate stop, got %v", err)
+	}
+}
+
+func TestSuperviseFFmpegIngestsExhausted(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+	t.Cleanup(resetGlobalStreamState)
+
+	pipeline := newFakePipeline()
+	config := testPipelineConfig()
+	config.Ingests = testIngestList(1)
+	config.IngestConnectTimeout = time.Hour
+	result := pipeline.start(ctx, config)
+
+	pipeline.nextEncoder(t).crash(errors.New("connection refused"))
+	pipeline.nextEncoder(t).crash(errors.New("connection refused"))
+
+	err := waitForResult(t, result)
+	if err == nil || !strings.Contains(err.Error(), "failed to connect to every ingest endpoint") {
+		t.Errorf("Expected the exhausted ingests error, got %v", err)
+	}
+	if config.Ingests.current().Name != "rtmp://primary.example.com" {
+		t.Errorf("Expected the primary to be active for the next attempt, got %q", config.Ingests.current().Name)
+	}
+}
+
+func TestLoadIngestFailoverAfter(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected int
+	}{
+		{"Unset Uses Default", "", DefaultIngestFailoverAfter},
+		{"Valid Value", "1", 1},
+		{"Zero Uses Default", "0", DefaultIngestFailoverAfter},
+		{"Invalid Uses Default", "often", DefaultIngestFailoverAfter},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("INGEST_FAILOVER_AFTER", tc.value)
+			if got := loadIngestFailoverAfter(ctx); got != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadBackupIngests(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	t.Run("No Backups Disables Failover", func(t *testing.T) {
+		t.Setenv("RTMP_BACKUP_URLS", "")
+		if list := loadBackupIngests(ctx, &Config{RTMPURL: "rtmp://primary.example.com/live/key"}); list != nil {
+			t.Errorf("Expected no ingest list, got %+v", list.endpoints)
+		}
+	})
+
+	t.Run("Backups Follow The Primary In Order", func(t *testing.T) {
+		t.Setenv("RTMP_BACKUP_URLS", " rtmp://backup1.example.com/live/key, ,rtmps://backup2.example.com/live/key")
+		config := &Config{RTMPURL: "rtmp://primary.example.com/live/key", IngestFailoverAfter: 2}
+
+		list := loadBackupIngests(ctx, config)
+		if list == nil {
+			t.Fatal("Expected an ingest list")
+		}
+		expected := []string{
+			"rtmp://primary.example.com/live/key",
+			"rtmp://backup1.example.com/live/key",
+			"rtmps://backup2.example.com/live/key",
+		}
+		if len(list.endpoints) != len(expected) {
+			t.Fatalf("Expected %d ingest endpoints, got %d", len(expected), len(list.endpoints))
+		}
+		for i, endpoint := range list.endpoints {
+			if endpoint.URL != expected[i] {
+				t.Errorf("Expected ingest %d to be %q, got %q", i, expected[i], endpoint.URL)
+			}
+		}
+		if list.failoverAfter != 2 {
+			t.Errorf("Expected failover after 2 failures, got %d", list.failoverAfter)
+		}
+	})
+}
+
+// serveRTMPHandshake answers the server side of an RTMP handshake on every connection
+// accepted from listener until it is closed.
+func serveRTMPHandshake(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			c0c1 := make([]byte, 1+rtmpHandshakeSize)
+			if _, err := io.ReadFull(conn, c0c1); err != nil {
+				return
+			}
+			s0s1s2 := make([]byte, 1+2*rtmpHandshakeSize)
+			s0s1s2[0] = rtmpVersion
+			copy(s0s1s2[1+rtmpHandshakeSize:], c0c1[1:])
+			conn.Write(s0s1s2)
+		}()
+	}
+}
+
+func TestProbeIngest(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RTMP Server", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer listener.Close()
+		go serveRTMPHandshake(listener)
+
+		if err := probeIngest(ctx, "rtmp://"+listener.Addr().String()+"/live/key"); err != nil {
+			t.Errorf("Expected the handshake to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Server Closing Without Handshake", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+
+		if err := probeIngest(ctx, "rtmp://"+listener.Addr().String()+"/live/key"); err == nil {
+			t.Error("Expected a probe error for a server that accepts but doesn't speak RTMP")
+		}
+	})
+}
+
+func TestStopFFmpegWithoutRun(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	t.Cleanup(resetGlobalStreamState)
+	list := testIngestList(1)
+	list.connectFailed()
+
+	if globalStreamState.stopFFmpeg(logger, list.failBack) {
+		t.Error("Expected no run to be stopped")
+	}
+	if !list.onBackup() || list.takeFailBack() {
+		t.Error("Expected no failback without an active FFmpeg run")
+	}
+}
+
+func TestWatchIngestFailback(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+	t.Cleanup(resetGlobalStreamState)
+
+	// Reserve a port for the primary, unreachable until it is listened on again
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	pipeline := newFakePipeline()
+	config := testPipelineConfig()
+	config.Ingests = newIngestList([]ingestEndpoint{
+		newIngestEndpoint("rtmp://" + addr + "/live/key"),
+		newIngestEndpoint("rtmp://backup.example.com/live/key"),
+	}, 1)
+	config.IngestConnectTimeout = time.Hour
+	config.IngestFailbackInterval = 10 * time.Millisecond
+	failbacks := testutil.ToFloat64(ingestFailbacksTotal)
+	result := pipeline.start(ctx, config)
+
+	pipeline.nextEncoder(t).crash(errors.New("connection refused"))
+	pipeline.nextEncoder(t)
+	if !config.Ingests.onBackup() {
+		t.Fatal("Expected FFmpeg to publish to the backup")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if !config.Ingests.onBackup() {
+		t.Fatal("Expected no failback while the primary is unreachable")
+	}
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("Cannot listen on %s again: %v", addr, err)
+	}
+	defer listener.Close()
+	go serveRTMPHandshake(listener)
+
+	pipeline.nextEncoder(t)
+	if config.Ingests.onBackup() {
+		t.Error("Expected FFmpeg to publish to the primary again")
+	}
+	if got := globalStreamState.activeIngest(); got != "rtmp://"+addr {
+		t.Errorf("Expected the status to report the primary, got %q", got)
+	}
+	if got := testutil.ToFloat64(ingestFailbacksTotal); got != failbacks+1 {
+		t.Errorf("Expected one failback to be counted, got %v", got-failbacks)
+	}
+	if n := pipeline.events.count("encoder shutdown"); n != 1 {
+		t.Errorf("Expected the backup encoder to be shut down once, got %d", n)
+	}
+
+	StopCurrentStream(ctx)
+	if err := waitForResult(t, result); err != nil {
+		t.Errorf("Expected no error after a deliberate stop, got %v", err)
+	}
+}
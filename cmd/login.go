@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default timeout applied to each login step that doesn't set its own
+	DefaultLoginStepTimeout = 30 * time.Second
+	// How often the current URL is checked while waiting for a waitURL step
+	loginURLPollInterval = 250 * time.Millisecond
+)
+
+// Supported login step actions
+const (
+	LoginActionNavigate    = "navigate"
+	LoginActionWaitVisible = "waitVisible"
+	LoginActionType        = "type"
+	LoginActionClick       = "click"
+	LoginActionWaitURL     = "waitURL"
+)
+
+// LoginStep is a single step of the scripted login flow parsed from WEBPAGE_LOGIN_STEPS JSON.
+type LoginStep struct {
+	Action   string `json:"action"`
+	URL      string `json:"url,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	// Text is typed as-is; use SecretFile instead for anything sensitive.
+	Text string `json:"text,omitempty"`
+	// SecretFile is a path whose contents (trailing newline trimmed) are typed into Selector.
+	SecretFile     string `json:"secretFile,omitempty"`
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty"`
+	// secret holds the SecretFile contents, read once at load time and never logged
+	secret string
+}
+
+// LoginError reports which login step failed so the restart loop can surface it clearly.
+type LoginError struct {
+	Step   int
+	Action string
+	Err    error
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("webpage login failed at step %d (%s): %v", e.Step, e.Action, e.Err)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// timeout returns the step's configured timeout or the default.
+func (s LoginStep) timeout() time.Duration {
+	if s.TimeoutSeconds > 0 {
+		return time.Duration(s.TimeoutSeconds) * time.Second
+	}
+	return DefaultLoginStepTimeout
+}
+
+// loadLoginSteps parses and validates WEBPAGE_LOGIN_STEPS, reading any referenced
+// secret files up front so a missing secret fails at startup rather than mid-stream.
+func loadLoginSteps() ([]LoginStep, error) {
+	stepsJSON := utils.GetEnvOrDefault("WEBPAGE_LOGIN_STEPS", "")
+	if stepsJSON == "" {
+		return nil, nil
+	}
+
+	var steps []LoginStep
+	if err := json.Unmarshal([]byte(stepsJSON), &steps); err != nil {
+		return nil, fmt.Errorf("failed to parse WEBPAGE_LOGIN_STEPS JSON: %w", err)
+	}
+
+	for i := range steps {
+		step := &steps[i]
+		switch step.Action {
+		case LoginActionNavigate, LoginActionWaitURL:
+			if step.URL == "" {
+				return nil, fmt.Errorf("login step %d (%s): url is required", i, step.Action)
+			}
+		case LoginActionWaitVisible, LoginActionClick:
+			if step.Selector == "" {
+				return nil, fmt.Errorf("login step %d (%s): selector is required", i, step.Action)
+			}
+		case LoginActionType:
+			if step.Selector == "" {
+				return nil, fmt.Errorf("login step %d (%s): selector is required", i, step.Action)
+			}
+			if step.SecretFile != "" {
+				data, err := os.ReadFile(step.SecretFile)
+				if err != nil {
+					return nil, fmt.Errorf("login step %d (%s): failed to read secret file: %w", i, step.Action, err)
+				}
+				step.secret = strings.TrimRight(string(data), "\r\n")
+			} else if step.Text == "" {
+				return nil, fmt.Errorf("login step %d (%s): text or secretFile is required", i, step.Action)
+			}
+		default:
+			return nil, fmt.Errorf("login step %d: unsupported action %q", i, step.Action)
+		}
+	}
+
+	return steps, nil
+}
+
+// action converts the step into the chromedp action that performs it.
+func (s LoginStep) action() chromedp.Action {
+	switch s.Action {
+	case LoginActionNavigate:
+		return chromedp.Navigate(s.URL)
+	case LoginActionWaitVisible:
+		return chromedp.WaitVisible(s.Selector, chromedp.ByQuery)
+	case LoginActionType:
+		text := s.Text
+		if s.SecretFile != "" {
+			text = s.secret
+		}
+		return chromedp.SendKeys(s.Selector, text, chromedp.ByQuery)
+	case LoginActionClick:
+		return chromedp.Click(s.Selector, chromedp.ByQuery)
+	case LoginActionWaitURL:
+		return chromedp.ActionFunc(func(ctx context.Context) error {
+			ticker := time.NewTicker(loginURLPollInterval)
+			defer ticker.Stop()
+			for {
+				var current string
+				if err := chromedp.Location(&current).Do(ctx); err != nil {
+					return err
+				}
+				if strings.Contains(current, s.URL) {
+					return nil
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return fmt.Errorf("timed out waiting for URL containing %q: %w", s.URL, ctx.Err())
+				}
+			}
+		})
+	}
+	return chromedp.ActionFunc(func(context.Context) error {
+		return fmt.Errorf("unsupported action %q", s.Action)
+	})
+}
+
+// runLoginSteps executes the scripted login flow in the given Chrome context, giving
+// each step its own timeout. Step values are deliberately left out of the logs.
+func runLoginSteps(ctx context.Context, chromeCtx context.Context, steps []LoginStep, display int) error {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	for i, step := range steps {
+		logger.Debug("Running webpage login step",
+			zap.Int("display", display),
+			zap.Int("step", i),
+			zap.String("action", step.Action))
+
+		stepCtx, cancel := context.WithTimeout(chromeCtx, step.timeout())
+		err := chromedp.Run(stepCtx, step.action())
+		cancel()
+		if err != nil {
+			return &LoginError{Step: i, Action: step.Action, Err: err}
+		}
+	}
+
+	if len(steps) > 0 {
+		logger.Info("Webpage login completed", zap.Int("display", display), zap.Int("numSteps", len(steps)))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadLoginSteps(t *testing.T) {
+	t.Run("Not Configured", func(t *testing.T) {
+		t.Setenv("WEBPAGE_LOGIN_STEPS", "")
+
+		steps, err := loadLoginSteps()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if steps != nil {
+			t.Errorf("Expected no steps, got %+v", steps)
+		}
+	})
+
+	t.Run("Full Login Flow With Secret", func(t *testing.T) {
+		secretPath := writeTestFile(t, "password", "hunter2\n")
+		t.Setenv("WEBPAGE_LOGIN_STEPS", fmt.Sprintf(`[
+			{"action":"navigate","url":"https://dash.example.com/login"},
+			{"action":"waitVisible","selector":"#username","timeoutSeconds":5},
+			{"action":"type","selector":"#username","text":"viewer"},
+			{"action":"type","selector":"#password","secretFile":%q},
+			{"action":"click","selector":"button[type=submit]"},
+			{"action":"waitURL","url":"/dashboard"}
+		]`, secretPath))
+
+		steps, err := loadLoginSteps()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(steps) != 6 {
+			t.Fatalf("Expected 6 steps, got %d", len(steps))
+		}
+		if steps[3].secret != "hunter2" {
+			t.Errorf("Expected secret to be read and trimmed, got %q", steps[3].secret)
+		}
+		if steps[1].timeout() != 5*time.Second {
+			t.Errorf("Expected 5s timeout, got %v", steps[1].timeout())
+		}
+		if steps[0].timeout() != DefaultLoginStepTimeout {
+			t.Errorf("Expected default timeout, got %v", steps[0].timeout())
+		}
+	})
+
+	t.Run("Invalid Steps", func(t *testing.T) {
+		cases := map[string]string{
+			"invalid json":        `not json`,
+			"unknown action":      `[{"action":"hover","selector":"#x"}]`,
+			"navigate no url":     `[{"action":"navigate"}]`,
+			"click no selector":   `[{"action":"click"}]`,
+			"type no text":        `[{"action":"type","selector":"#x"}]`,
+			"missing secret file": fmt.Sprintf(`[{"action":"type","selector":"#x","secretFile":%q}]`, filepath.Join(t.TempDir(), "missing")),
+		}
+		for name, stepsJSON := range cases {
+			t.Run(name, func(t *testing.T) {
+				t.Setenv("WEBPAGE_LOGIN_STEPS", stepsJSON)
+				if _, err := loadLoginSteps(); err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+			})
+		}
+	})
+}
+
+func TestLoginError(t *testing.T) {
+	cause := errors.New("context deadline exceeded")
+	wrapped := fmt.Errorf("failed to start Chrome for output 0: %w", &LoginError{Step: 2, Action: LoginActionClick, Err: cause})
+
+	var loginErr *LoginError
+	if !errors.As(wrapped, &loginErr) {
+		t.Fatal("Expected errors.As to find the LoginError")
+	}
+	if loginErr.Step != 2 || loginErr.Action != LoginActionClick {
+		t.Errorf("Unexpected login error fields: %+v", loginErr)
+	}
+	if !errors.Is(wrapped, cause) {
+		t.Error("Expected LoginError to unwrap to its cause")
+	}
+}
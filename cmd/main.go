@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,6 +25,7 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapio"
 
+	"github.com/Zozman/stream-webpage-container/ffmpeg"
 	"github.com/Zozman/stream-webpage-container/twitch"
 	"github.com/Zozman/stream-webpage-container/utils"
 )
@@ -61,6 +65,51 @@ type Config struct {
 	WebpageURL string
 	RTMPURL    string
 	Outputs    []StreamOutput
+	// PageAuth holds headers/cookies/basic-auth for the captured page; never logged.
+	PageAuth PageAuth
+	// LoginSteps is an optional scripted login run before the webpage is loaded.
+	LoginSteps []LoginStep
+	// ChromeProfileDir, when set, is the base directory for persistent per-canvas Chrome profiles.
+	ChromeProfileDir string
+	// ReadyCondition decides when a loaded page can be captured; nil uses a fixed settle delay.
+	ReadyCondition *ReadyCondition
+	// ConsoleLogLevels maps browser console/log severities to application log levels.
+	ConsoleLogLevels ConsoleLogLevels
+	// CriticalResources are URL substrings of resources the page can't work without.
+	CriticalResources []string
+	// CriticalResourcesReload reloads the page when a critical resource fails instead of
+	// only counting and logging the failure.
+	CriticalResourcesReload bool
+	// NavigationRetries is how many times the webpage is loaded before the stream restarts
+	// (or, with a Fallback, before the fallback is streamed while retrying in the background).
+	NavigationRetries int
+	// Fallback is an optional local page, image or video streamed while the webpage is unreachable.
+	Fallback *FallbackSource
+	// FrameChecks configures black and frozen picture detection on the captured canvases.
+	FrameChecks FrameChecks
+	// ComponentMaxRestarts caps restarts of FFmpeg or one Xvfb within a window before
+	// the whole pipeline is restarted instead.
+	ComponentMaxRestarts int
+	// FFmpegQuitTimeout and FFmpegTermTimeout bound each step of FFmpeg's graceful
+	// shutdown (`q` on stdin, then SIGTERM) before escalating.
+	FFmpegQuitTimeout time.Duration
+	FFmpegTermTimeout time.Duration
+	// SilenceCheck configures silence detection on the audio track.
+	SilenceCheck SilenceCheck
+	// GoLive negotiates the Enhanced Broadcasting configuration; nil when it is disabled.
+	GoLive *goLiveNegotiator
+	// Ingests are the endpoints FFmpeg fails over between; nil publishes to RTMPURL only.
+	Ingests *ingestList
+	// IngestFailoverAfter is how many consecutive failed connections fail over to the next ingest.
+	IngestFailoverAfter int
+	// IngestFailbackInterval is how often the primary ingest is probed while on a backup;
+	// 0 disables failing back.
+	IngestFailbackInterval time.Duration
+	// PreferRTMPS orders the Go Live API's RTMPS ingest endpoints before its RTMP ones.
+	PreferRTMPS bool
+	// IngestConnectTimeout is how long FFmpeg must run before its exit no longer
+	// counts as a failed connection to the ingest.
+	IngestConnectTimeout time.Duration
 }
 
 // StreamState represents the current state of the stream, tracking all processes
@@ -70,8 +119,12 @@ type StreamState struct {
 	isRunning     bool
 	cancelFunc    context.CancelFunc
 	chromeCancels []context.CancelFunc
-	xvfbCmds      []*exec.Cmd
-	ffmpegCmd     *exec.Cmd
+	xvfbServers   []*displayServer
+	ffmpeg        encoder
+	// ingest names the endpoint FFmpeg last published to
+	ingest string
+	// ffmpegStarted is when the latest FFmpeg run started connecting to the ingest
+	ffmpegStarted time.Time
 }
 
 // Health response structure
@@ -79,6 +132,11 @@ type Health struct {
 	Uptime  time.Duration
 	Message string
 	Date    time.Time
+	// State is the restart supervisor's state: starting, running, backoff or failed
+	State     string
+	LastError string `json:",omitempty"`
+	// Ingest is the endpoint FFmpeg is publishing to, without the stream key
+	Ingest string `json:",omitempty"`
 }
 
 var (
@@ -86,21 +144,58 @@ var (
 	globalStreamState = &StreamState{}
 	// When the application started; used for health checks
 	startTime = time.Now()
+	// Restart supervisor for the main loop; set in main before the HTTP server and
+	// restart triggers start, and never replaced afterwards
+	globalRestartSupervisor *restartSupervisor
+	// Replacement configuration for the next stream start, e.g. after Enhanced Broadcasting recovers
+	globalConfigUpdate = &configUpdate{}
 )
 
 // setStreamRunning marks the stream as running and saves all process handles for later teardown.
-func (s *StreamState) setStreamRunning(cancelFunc context.CancelFunc, chromeCancels []context.CancelFunc, xvfbCmds []*exec.Cmd, ffmpegCmd *exec.Cmd) {
+func (s *StreamState) setStreamRunning(cancelFunc context.CancelFunc, chromeCancels []context.CancelFunc, xvfbServers []*displayServer, ffmpeg encoder) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.isRunning = true
 	s.cancelFunc = cancelFunc
 	s.chromeCancels = chromeCancels
-	s.xvfbCmds = xvfbCmds
-	s.ffmpegCmd = ffmpegCmd
+	s.xvfbServers = xvfbServers
+	s.ffmpeg = ffmpeg
 }
 
-// stopStream ends the current stream if it's running: cancels Chrome contexts,
-// terminates FFmpeg gracefully, then kills all Xvfb processes.
+// setFFmpeg records the FFmpeg process currently serving a running stream, which
+// changes whenever FFmpeg alone is restarted.
+func (s *StreamState) setFFmpeg(ffmpeg encoder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isRunning {
+		s.ffmpeg = ffmpeg
+		if ffmpeg != nil {
+			s.ffmpegStarted = time.Now()
+		}
+	}
+}
+
+// lastFFmpegStart returns when the latest FFmpeg run started, or the zero time if none has.
+func (s *StreamState) lastFFmpegStart() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ffmpegStarted
+}
+
+// clear forgets the stream's process handles once the pipeline has exited.
+func (s *StreamState) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isRunning = false
+	s.cancelFunc = nil
+	s.chromeCancels = nil
+	s.xvfbServers = nil
+	s.ffmpeg = nil
+}
+
+// stopStream ends the current stream if it's running: quits FFmpeg so it flushes
+// the stream, closes the browsers, then kills Xvfb. Each step waits for the processes
+// to actually exit, so a new stream can start as soon as this returns.
 func (s *StreamState) stopStream(logger *zap.Logger) {
 	s.mu.Lock()
 
@@ -111,19 +206,25 @@ func (s *StreamState) stopStream(logger *zap.Logger) {
 
 	// Capture handles and clear state under lock, then release before slow work
 	chromeCancels := s.chromeCancels
-	ffmpegCmd := s.ffmpegCmd
-	xvfbCmds := s.xvfbCmds
+	ffmpeg := s.ffmpeg
+	xvfbServers := s.xvfbServers
 	cancelFunc := s.cancelFunc
 
 	s.isRunning = false
 	s.cancelFunc = nil
 	s.chromeCancels = nil
-	s.xvfbCmds = nil
-	s.ffmpegCmd = nil
+	s.xvfbServers = nil
+	s.ffmpeg = nil
 	s.mu.Unlock()
 
 	logger.Info("Stopping existing stream...")
 
+	// FFmpeg goes first so it stops capturing before the browsers and displays vanish
+	if ffmpeg != nil {
+		ffmpeg.shutdown(logger)
+	}
+
+	// Chrome cancel functions return once the browser process has exited
 	for i, cancel := range chromeCancels {
 		if cancel != nil {
 			logger.Debug("Cancelling Chrome context", zap.Int("index", i))
@@ -131,22 +232,13 @@ func (s *StreamState) stopStream(logger *zap.Logger) {
 		}
 	}
 
-	if ffmpegCmd != nil && ffmpegCmd.Process != nil {
-		logger.Debug("Sending SIGTERM to FFmpeg process")
-		_ = ffmpegCmd.Process.Signal(syscall.SIGTERM)
-
-		// Give FFmpeg a moment to flush and exit, then force-kill.
-		// We don't call Wait() here because startFFmpegStream owns that.
-		time.Sleep(5 * time.Second)
-		// If the process is still running, force-kill it
-		_ = ffmpegCmd.Process.Kill()
-	}
-
-	for i, cmd := range xvfbCmds {
-		if cmd != nil && cmd.Process != nil {
-			logger.Debug("Killing Xvfb process", zap.Int("display", BaseDisplayNumber+i))
-			_ = cmd.Process.Kill()
-			go func(c *exec.Cmd) { _, _ = c.Process.Wait() }(cmd)
+	for _, server := range xvfbServers {
+		if server != nil {
+			logger.Debug("Killing Xvfb process", zap.Int("display", server.output.Display))
+			server.stop()
+			if !server.waitStopped(xvfbStopTimeout) {
+				logger.Warn("Xvfb did not exit in time", zap.Int("display", server.output.Display))
+			}
 		}
 	}
 
@@ -158,6 +250,36 @@ func (s *StreamState) stopStream(logger *zap.Logger) {
 	logger.Info("Existing stream stopped")
 }
 
+// stopFFmpeg shuts down the current FFmpeg process without ending the stream, so
+// superviseFFmpeg starts a new one. prepare runs first, before a run that ends
+// meanwhile can be cleared, and calls the stop off by returning false. It reports
+// whether a run was stopped.
+func (s *StreamState) stopFFmpeg(logger *zap.Logger, prepare func() bool) bool {
+	s.mu.RLock()
+	ffmpeg := s.ffmpeg
+	if ffmpeg == nil || !prepare() {
+		s.mu.RUnlock()
+		return false
+	}
+	s.mu.RUnlock()
+	ffmpeg.shutdown(logger)
+	return true
+}
+
+// setIngest records the endpoint FFmpeg is publishing to.
+func (s *StreamState) setIngest(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ingest = name
+}
+
+// activeIngest returns the endpoint FFmpeg last published to, if any.
+func (s *StreamState) activeIngest() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ingest
+}
+
 // isStreamRunning returns whether the stream is currently active.
 func (s *StreamState) isStreamRunning() bool {
 	s.mu.RLock()
@@ -188,6 +310,13 @@ func main() {
 	logger := utils.GetLogger()
 	ctx := utils.SaveLoggerToContext(context.Background(), logger)
 
+	if len(os.Args) > 1 && os.Args[1] == mockGoLiveCommand {
+		if err := runMockGoLive(ctx, os.Args[2:]); err != nil {
+			logger.Fatal("Go Live mock server failed", zap.Error(err))
+		}
+		return
+	}
+
 	config, err := loadConfig(ctx)
 	if err != nil {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
@@ -211,6 +340,9 @@ func main() {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	supervisor := newRestartSupervisor(loadRestartPolicy(ctx))
+	globalRestartSupervisor = supervisor
+
 	serverPort := utils.GetEnvOrDefault("PORT", "8080")
 	serverAddress := "0.0.0.0:" + serverPort
 	logger.Info("Starting HTTP server", zap.String("address", serverAddress))
@@ -228,6 +360,9 @@ func main() {
 	}()
 
 	cronScheduler := setupStreamStatusChecker(ctx, config)
+	setupStreamEventSub(ctx, config)
+
+	go watchGoLiveFallback(ctx, config)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -247,32 +382,70 @@ func main() {
 		cancel()
 	}()
 
+	// The configuration from loadConfig is fresh for the first start
+	restarting := false
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Info("Context cancelled, exiting...")
 			return
 		default:
+			if next := globalConfigUpdate.take(); next != nil {
+				config = next
+				logger.Info("Applying updated stream configuration", zap.Int("numOutputs", len(config.Outputs)))
+			} else if restarting && config.GoLive != nil {
+				// Twitch may change its recommended tracks, and config IDs expire
+				config = config.GoLive.refresh(ctx, config)
+			}
+			restarting = true
 			logger.Info("Starting/restarting stream...")
-			if err := streamWebpage(ctx, config); err != nil {
-				if ctx.Err() != nil {
-					logger.Info("Stream stopped due to context cancellation")
-					return
+			supervisor.runStarted()
+			err := streamWebpage(ctx, config)
+			if ctx.Err() != nil {
+				logger.Info("Stream stopped due to context cancellation")
+				return
+			}
+			delay := supervisor.runEnded(err)
+			if err != nil {
+				state, _ := supervisor.status()
+				var loginErr *LoginError
+				if state == SupervisorStateFailed {
+					logger.Error("Stream keeps failing, restart circuit breaker open",
+						zap.Duration("retryIn", delay), zap.Error(err))
+				} else if errors.As(err, &loginErr) {
+					logger.Error("Webpage login failed, will restart",
+						zap.Int("step", loginErr.Step),
+						zap.String("action", loginErr.Action),
+						zap.Duration("retryIn", delay),
+						zap.Error(loginErr.Err))
+				} else {
+					logger.Info("Stream ended, will restart", zap.Duration("retryIn", delay), zap.Error(err))
 				}
-				logger.Info("Stream ended, will restart in 5 seconds", zap.Error(err))
-				time.Sleep(5 * time.Second)
+			}
+			if !waitForRestart(ctx, delay) {
+				logger.Info("Context cancelled, exiting...")
+				return
 			}
 		}
 	}
 }
 
-// getHealthResponse returns the health of the application.
+// getHealthResponse returns the health of the application. It responds with 503 while
+// the restart circuit breaker reports the stream as failed.
 func getHealthResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	state, lastError := globalRestartSupervisor.status()
 	data := Health{
-		Uptime:  time.Since(startTime),
-		Message: "OK",
-		Date:    time.Now(),
+		Uptime:    time.Since(startTime),
+		Message:   "OK",
+		Date:      time.Now(),
+		State:     state,
+		LastError: lastError,
+		Ingest:    globalStreamState.activeIngest(),
+	}
+	if state == SupervisorStateFailed {
+		data.Message = "Stream is failing repeatedly"
+		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 	json.NewEncoder(w).Encode(data)
 }
@@ -334,9 +507,80 @@ func loadConfig(ctx context.Context) (*Config, error) {
 	logger := utils.GetLoggerFromContext(ctx)
 
 	config := &Config{
-		WebpageURL: utils.GetEnvOrDefault("WEBPAGE_URL", DefaultWebpageURL),
-		RTMPURL:    utils.GetEnvOrDefault("RTMP_URL", DefaultRTMPURL),
+		WebpageURL:       utils.GetEnvOrDefault("WEBPAGE_URL", DefaultWebpageURL),
+		RTMPURL:          utils.GetEnvOrDefault("RTMP_URL", DefaultRTMPURL),
+		ChromeProfileDir: utils.GetEnvOrDefault("CHROME_PROFILE_DIR", ""),
+	}
+
+	pageAuth, err := loadPageAuth()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webpage credentials: %w", err)
+	}
+	config.PageAuth = pageAuth
+	if !pageAuth.isEmpty() {
+		logger.Info("Webpage credentials loaded",
+			zap.Int("numHeaders", len(pageAuth.Headers)),
+			zap.Int("numCookies", len(pageAuth.Cookies)),
+			zap.Bool("basicAuth", pageAuth.BasicAuth != nil))
+	}
+
+	loginSteps, err := loadLoginSteps()
+	if err != nil {
+		return nil, err
 	}
+	config.LoginSteps = loginSteps
+
+	readyCondition, err := loadReadyCondition()
+	if err != nil {
+		return nil, err
+	}
+	config.ReadyCondition = readyCondition
+
+	consoleLogLevels, err := loadConsoleLogLevels()
+	if err != nil {
+		return nil, err
+	}
+	config.ConsoleLogLevels = consoleLogLevels
+
+	config.CriticalResources = parseCriticalResources(utils.GetEnvOrDefault("WEBPAGE_CRITICAL_RESOURCES", ""))
+	config.CriticalResourcesReload = strings.EqualFold(utils.GetEnvOrDefault("WEBPAGE_CRITICAL_RESOURCES_RELOAD", "false"), "true")
+	config.NavigationRetries = DefaultNavigationRetries
+	if retriesStr := utils.GetEnvOrDefault("WEBPAGE_NAVIGATION_RETRIES", ""); retriesStr != "" {
+		retries, err := strconv.Atoi(retriesStr)
+		if err != nil || retries <= 0 {
+			logger.Warn("Invalid WEBPAGE_NAVIGATION_RETRIES value, using default",
+				zap.String("invalidValue", retriesStr), zap.Int("default", DefaultNavigationRetries))
+		} else {
+			config.NavigationRetries = retries
+		}
+	}
+
+	fallback, err := loadFallbackSource()
+	if err != nil {
+		return nil, err
+	}
+	if fallback != nil {
+		logger.Info("Fallback source configured", zap.String("path", fallback.Path), zap.String("kind", fallback.Kind))
+	}
+	config.Fallback = fallback
+
+	frameChecks, err := loadFrameChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config.FrameChecks = frameChecks
+
+	silenceCheck, err := loadSilenceCheck(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config.SilenceCheck = silenceCheck
+	config.ComponentMaxRestarts = loadComponentMaxRestarts(ctx)
+	config.FFmpegQuitTimeout, config.FFmpegTermTimeout = loadFFmpegShutdownTimeouts(ctx)
+	config.IngestConnectTimeout = utils.GetSecondsFromEnv(ctx, "INGEST_CONNECT_TIMEOUT", DefaultIngestConnectTimeout)
+	config.IngestFailoverAfter = loadIngestFailoverAfter(ctx)
+	config.IngestFailbackInterval = utils.GetSecondsFromEnv(ctx, "INGEST_FAILBACK_INTERVAL", DefaultIngestFailbackInterval)
+	config.Ingests = loadBackupIngests(ctx, config)
 
 	// Twitch Enhanced Broadcasting mode: call Go Live API for server-provided config.
 	// STREAM_OUTPUTS is parsed first (if set) to derive canvas preferences for the API request,
@@ -348,8 +592,24 @@ func loadConfig(ctx context.Context) (*Config, error) {
 			return nil, fmt.Errorf("TWITCH_ENHANCED_BROADCASTING is enabled but TWITCH_STREAM_KEY is not set")
 		}
 
+		config.PreferRTMPS = strings.EqualFold(utils.GetEnvOrDefault("TWITCH_PREFER_RTMPS", "false"), "true")
+
 		opts := twitch.GoLiveOptions{
 			ClientName: utils.GetEnvOrDefault("TWITCH_CLIENT_NAME", ""),
+			APIURL:     utils.GetEnvOrDefault("TWITCH_GO_LIVE_URL", ""),
+		}
+		if opts.APIURL != "" {
+			logger.Info("Using custom Go Live API endpoint", zap.String("url", opts.APIURL))
+		}
+		opts.SchemaVersion = utils.GetEnvOrDefault("TWITCH_GO_LIVE_SCHEMA", "")
+		if opts.SchemaVersion != "" && !slices.Contains(twitch.GoLiveSchemaVersions(), opts.SchemaVersion) {
+			return nil, fmt.Errorf("invalid TWITCH_GO_LIVE_SCHEMA %q, expected one of: %s",
+				opts.SchemaVersion, strings.Join(twitch.GoLiveSchemaVersions(), ", "))
+		}
+		opts.GPU = utils.GetEnvOrDefault("TWITCH_GO_LIVE_GPU", "")
+		if opts.GPU != "" && !slices.Contains(twitch.GoLiveGPUProfiles(), opts.GPU) {
+			return nil, fmt.Errorf("invalid TWITCH_GO_LIVE_GPU %q, expected one of: %s",
+				opts.GPU, strings.Join(twitch.GoLiveGPUProfiles(), ", "))
 		}
 
 		// Derive canvas preferences from STREAM_OUTPUTS if available
@@ -407,29 +667,20 @@ func loadConfig(ctx context.Context) (*Config, error) {
 			}
 		}
 
+		loadGoLiveLimits(ctx, streamKey, &opts)
 
 		logger.Info("Enhanced Broadcasting enabled, calling Twitch Go Live API...",
 			zap.Intp("maxTracks", opts.MaxTracks),
+			zap.Intp("maxAggregateBitrate", opts.MaxAggregateBitrate),
 			zap.Int("canvasWidth", opts.CanvasWidth),
 			zap.Int("canvasHeight", opts.CanvasHeight),
 			zap.Int("framerate", opts.Framerate),
 			zap.Bool("portrait", opts.PortraitCanvas != nil))
-		goLiveResp, err := twitch.CallGoLiveAPI(ctx, streamKey, opts)
-		if err != nil {
-			logger.Warn("Go Live API call failed, falling back to standard configuration",
-				zap.Error(err))
-		} else {
-			if err := applyGoLiveConfig(ctx, config, goLiveResp); err != nil {
-				logger.Warn("Failed to apply Go Live API configuration, falling back",
-					zap.Error(err))
-			} else {
-				logger.Info("Enhanced Broadcasting configured from Go Live API",
-					zap.String("configId", goLiveResp.Meta.ConfigID),
-					zap.Int("numTracks", len(config.Outputs)),
-					zap.String("rtmpURL", config.RTMPURL))
-				return config, nil
-			}
+		config.GoLive = newGoLiveNegotiator(ctx, streamKey, opts)
+		if config.GoLive.configure(ctx, config) {
+			return config, nil
 		}
+		logger.Warn("Enhanced Broadcasting unavailable, falling back to standard configuration")
 	}
 
 	streamOutputsJSON := utils.GetEnvOrDefault("STREAM_OUTPUTS", "")
@@ -521,6 +772,20 @@ func loadConfig(ctx context.Context) (*Config, error) {
 	return config, nil
 }
 
+// goLiveIngestURL builds an endpoint's publish URL: {stream_key} replaced with its
+// authentication token and the clientConfigId appended.
+func goLiveIngestURL(endpoint twitch.GoLiveIngestEndpoint, configID string) string {
+	ingestURL := strings.Replace(endpoint.URLTemplate, "{stream_key}", endpoint.Authentication, 1)
+	if configID != "" {
+		if strings.Contains(ingestURL, "?") {
+			ingestURL += "&clientConfigId=" + configID
+		} else {
+			ingestURL += "?clientConfigId=" + configID
+		}
+	}
+	return ingestURL
+}
+
 // applyGoLiveConfig converts a Go Live API response into the app's Config,
 // setting the RTMP URL and output tracks from the server-provided configuration.
 func applyGoLiveConfig(ctx context.Context, config *Config, resp *twitch.GoLiveResponse) error {
@@ -533,28 +798,24 @@ func applyGoLiveConfig(ctx context.Context, config *Config, resp *twitch.GoLiveR
 		return fmt.Errorf("Go Live API returned no encoder configurations")
 	}
 
-	// Find the first RTMP endpoint
-	var endpoint *twitch.GoLiveIngestEndpoint
-	for i := range resp.IngestEndpoints {
-		if strings.EqualFold(resp.IngestEndpoints[i].Protocol, "RTMP") {
-			endpoint = &resp.IngestEndpoints[i]
-			break
-		}
-	}
-	if endpoint == nil {
-		return fmt.Errorf("Go Live API returned no RTMP ingest endpoint")
+	// Collect the RTMP and RTMPS endpoints, preferred protocol first, to fail over between
+	preferred, other := "RTMP", "RTMPS"
+	if config.PreferRTMPS {
+		preferred, other = other, preferred
 	}
-
-	// Build the RTMP URL: replace {stream_key} with authentication token, append clientConfigId
-	rtmpURL := strings.Replace(endpoint.URLTemplate, "{stream_key}", endpoint.Authentication, 1)
-	if resp.Meta.ConfigID != "" {
-		if strings.Contains(rtmpURL, "?") {
-			rtmpURL += "&clientConfigId=" + resp.Meta.ConfigID
-		} else {
-			rtmpURL += "?clientConfigId=" + resp.Meta.ConfigID
+	var endpoints []ingestEndpoint
+	for _, protocol := range []string{preferred, other} {
+		for _, endpoint := range resp.IngestEndpoints {
+			if strings.EqualFold(endpoint.Protocol, protocol) {
+				endpoints = append(endpoints, newIngestEndpoint(goLiveIngestURL(endpoint, resp.Meta.ConfigID)))
+			}
 		}
 	}
-	config.RTMPURL = rtmpURL
+	if len(endpoints) == 0 {
+		return fmt.Errorf("Go Live API returned no RTMP or RTMPS ingest endpoint")
+	}
+	config.RTMPURL = endpoints[0].URL
+	config.Ingests = newIngestList(endpoints, config.IngestFailoverAfter)
 
 	// Convert encoder configurations to StreamOutputs, grouping by canvas.
 	// The largest track per canvas gets its own Chrome+Xvfb instance (primary).
@@ -674,19 +935,30 @@ func startXvfb(ctx context.Context, output StreamOutput) (*exec.Cmd, error) {
 // and Chrome browser per canvas (primary tracks), then starts FFmpeg to capture
 // and scale into all output tracks for streaming.
 func streamWebpage(ctx context.Context, config *Config) error {
+	return runPipeline(ctx, config, defaultRunner)
+}
+
+// runPipeline runs one stream using the runner's launchers; see streamWebpage.
+func runPipeline(ctx context.Context, config *Config, runner pipelineRunner) error {
 	logger := utils.GetLoggerFromContext(ctx)
 
 	if globalStreamState.isStreamRunning() {
 		logger.Info("Stream is already running, stopping existing stream before restart")
 		globalStreamState.stopStream(logger)
-		time.Sleep(2 * time.Second)
 	}
 
-	streamCtx, streamCancel := context.WithCancel(ctx)
+	// Component supervisors cancel the stream with a cause when they give up, so the
+	// main loop restarts the whole pipeline with backoff
+	streamCtx, cancelStream := context.WithCancelCause(ctx)
+	streamCancel := func() { cancelStream(nil) }
 	defer streamCancel()
 
-	xvfbCmds := make([]*exec.Cmd, 0, len(config.Outputs))
+	xvfbServers := make([]*displayServer, 0, len(config.Outputs))
 	chromeCancels := make([]context.CancelFunc, 0, len(config.Outputs))
+	chromeInstances := make(map[int]*chromeInstance, len(config.Outputs))
+	// The primary browser produces the stream's audio
+	var primaryInstance *chromeInstance
+	primaryDisplay := 0
 
 	cleanup := func() {
 		for _, cancel := range chromeCancels {
@@ -694,11 +966,8 @@ func streamWebpage(ctx context.Context, config *Config) error {
 				cancel()
 			}
 		}
-		for _, cmd := range xvfbCmds {
-			if cmd != nil && cmd.Process != nil {
-				_ = cmd.Process.Kill()
-				go func(c *exec.Cmd) { _, _ = c.Process.Wait() }(cmd)
-			}
+		for _, server := range xvfbServers {
+			server.stop()
 		}
 	}
 
@@ -719,20 +988,29 @@ func streamWebpage(ctx context.Context, config *Config) error {
 		}
 		startedDisplays[output.Display] = true
 
-		xvfbCmd, err := startXvfb(streamCtx, output)
+		xvfb, err := startDisplayServer(streamCtx, runner.displays, output)
 		if err != nil {
 			cleanup()
 			return fmt.Errorf("failed to start Xvfb for output %d: %w", i, err)
 		}
-		xvfbCmds = append(xvfbCmds, xvfbCmd)
+		xvfbServers = append(xvfbServers, xvfb)
 
 		isPrimary := len(chromeCancels) == 0
-		chromeCancel, err := startChrome(streamCtx, config, output, isPrimary)
+		instance, err := runner.browsers.startBrowser(streamCtx, config, output, isPrimary)
 		if err != nil {
 			cleanup()
 			return fmt.Errorf("failed to start Chrome for output %d: %w", i, err)
 		}
-		chromeCancels = append(chromeCancels, chromeCancel)
+		chromeCancels = append(chromeCancels, instance.stop)
+		chromeInstances[output.Display] = instance
+		if isPrimary {
+			primaryInstance = instance
+			primaryDisplay = output.Display
+		}
+
+		go xvfb.supervise(streamCtx, config.ComponentMaxRestarts,
+			func() error { return runner.browsers.recreateBrowser(streamCtx, config, output, isPrimary, instance) },
+			cancelStream)
 	}
 
 	logger.Info("Capture instances started",
@@ -750,14 +1028,69 @@ func streamWebpage(ctx context.Context, config *Config) error {
 		}
 	}
 
-	err := startFFmpegStream(streamCtx, config, streamCancel, chromeCancels, xvfbCmds)
+	globalStreamState.setStreamRunning(streamCancel, chromeCancels, xvfbServers, nil)
+	defer globalStreamState.clear()
+
+	go watchIngestFailback(streamCtx, config)
+
+	frames := newFrameMonitor(streamCtx, config, chromeInstances)
+	audio := newAudioMonitor(streamCtx, config, primaryInstance, primaryDisplay)
+	err := superviseFFmpeg(streamCtx, config, runner.encoders, frames, audio)
 	cleanup()
+	if cause := context.Cause(streamCtx); err == nil && cause != nil && ctx.Err() == nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
 	return err
 }
 
-// startChrome launches a Chrome instance bound to the output's Xvfb display.
+// startChrome launches a Chrome instance bound to the output's Xvfb display and
+// starts its refresh loop and crash/hang watchdog. The returned cancel function
+// stops whichever browser is current, including one recreated by the watchdog.
 // The primary instance produces audio; non-primary instances are muted.
-func startChrome(ctx context.Context, config *Config, output StreamOutput, isPrimary bool) (context.CancelFunc, error) {
+func startChrome(ctx context.Context, config *Config, output StreamOutput, isPrimary bool) (*chromeInstance, error) {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	monitor := newNetworkMonitor(ctx, config, output)
+	chromeCtx, chromeCancel, err := launchChrome(ctx, config, output, isPrimary, monitor)
+	if err != nil {
+		return nil, err
+	}
+	instance := newChromeInstance(chromeCtx, chromeCancel)
+	instance.network = monitor
+
+	refreshIntervalStr := utils.GetEnvOrDefault("WEBPAGE_REFRESH_INTERVAL", "")
+	if refreshIntervalStr != "" {
+		refreshInterval, err := strconv.Atoi(refreshIntervalStr)
+		if err == nil && refreshInterval > 0 {
+			go func() {
+				ticker := time.NewTicker(time.Duration(refreshInterval) * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if err := chromedp.Run(instance.context(), chromedp.Reload()); err != nil {
+							logger.Error("Failed to refresh browser page",
+								zap.Int("display", output.Display), zap.Error(err))
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+	}
+
+	go watchChrome(ctx, config, output, isPrimary, instance)
+	go superviseNavigation(ctx, config, output, instance)
+
+	logger.Debug("Chrome started successfully", zap.Int("display", output.Display))
+	return instance, nil
+}
+
+// launchChrome starts a browser on the output's display, applies credentials and the
+// login flow, loads the webpage (retrying failed loads) and waits for it to be ready.
+// The returned context drives the page; cancelling the returned function closes the browser.
+func launchChrome(ctx context.Context, config *Config, output StreamOutput, isPrimary bool, monitor *networkMonitor) (context.Context, context.CancelFunc, error) {
 	logger := utils.GetLoggerFromContext(ctx)
 	displayStr := fmt.Sprintf(":%d", output.Display)
 
@@ -796,6 +1129,16 @@ func startChrome(ctx context.Context, config *Config, output StreamOutput, isPri
 		chromedp.WindowSize(output.Width, output.Height),
 	)
 
+	// Without a persistent profile chromedp uses a fresh temporary user-data-dir,
+	// so logins and storage are lost on every restart.
+	if profileDir := chromeProfileDir(config.ChromeProfileDir, output); profileDir != "" {
+		if err := prepareChromeProfile(profileDir); err != nil {
+			return nil, nil, err
+		}
+		logger.Debug("Using persistent Chrome profile", zap.Int("display", output.Display), zap.String("profileDir", profileDir))
+		opts = append(opts, chromedp.UserDataDir(profileDir))
+	}
+
 	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, opts...)
 	chromeCtx, chromeCancel := chromedp.NewContext(allocCtx)
 
@@ -804,239 +1147,113 @@ func startChrome(ctx context.Context, config *Config, output StreamOutput, isPri
 		allocCancel()
 	}
 
-	if err := chromedp.Run(chromeCtx,
-		chromedp.Navigate(config.WebpageURL),
-		chromedp.WaitVisible("body", chromedp.ByQuery),
-	); err != nil {
+	forwardBrowserLogs(ctx, chromeCtx, config.ConsoleLogLevels, output)
+	monitor.attach(chromeCtx)
+	listenForPageAuth(ctx, chromeCtx, config.PageAuth, config.WebpageURL, output.Display)
+
+	if err := chromedp.Run(chromeCtx, pageAuthActions(config.PageAuth)); err != nil {
 		combinedCancel()
-		return nil, fmt.Errorf("failed to navigate to webpage on display :%d: %w", output.Display, err)
+		return nil, nil, fmt.Errorf("failed to apply webpage credentials on display :%d: %w", output.Display, err)
 	}
 
-	time.Sleep(3 * time.Second)
-
-	refreshIntervalStr := utils.GetEnvOrDefault("WEBPAGE_REFRESH_INTERVAL", "")
-	if refreshIntervalStr != "" {
-		refreshInterval, err := strconv.Atoi(refreshIntervalStr)
-		if err == nil && refreshInterval > 0 {
-			go func() {
-				ticker := time.NewTicker(time.Duration(refreshInterval) * time.Second)
-				defer ticker.Stop()
-				for {
-					select {
-					case <-ticker.C:
-						if err := chromedp.Run(chromeCtx, chromedp.Reload()); err != nil {
-							logger.Error("Failed to refresh browser page",
-								zap.Int("display", output.Display), zap.Error(err))
-						}
-					case <-ctx.Done():
-						return
-					}
-				}
-			}()
-		}
+	if err := runLoginSteps(ctx, chromeCtx, config.LoginSteps, output.Display); err != nil {
+		combinedCancel()
+		return nil, nil, fmt.Errorf("display :%d: %w", output.Display, err)
 	}
 
-	logger.Debug("Chrome started successfully", zap.Int("display", output.Display))
-	return combinedCancel, nil
-}
+	readiness := newPageReadiness(chromeCtx, config.ReadyCondition)
+	defer readiness.stopTracking()
+	navigateStart := time.Now()
 
-// extractNumberFromBitrate extracts the numeric value from a bitrate string (e.g., "3000k" -> 3000).
-func extractNumberFromBitrate(bitrate string) int {
-	numStr := strings.TrimSuffix(bitrate, "k")
-	num, err := strconv.Atoi(numStr)
-	if err != nil {
-		return 3000
+	if err := chromedp.Run(chromeCtx, readiness.beforeNavigate()); err != nil {
+		combinedCancel()
+		return nil, nil, fmt.Errorf("failed to prepare readiness check on display :%d: %w", output.Display, err)
 	}
-	return num
-}
-
-// startFFmpegStream builds and runs the FFmpeg command that captures Xvfb
-// displays (one x11grab input per canvas, not per track) plus one audio input,
-// applies scale filters for secondary tracks, and muxes everything into a
-// single Enhanced RTMP multitrack FLV stream.
-func startFFmpegStream(ctx context.Context, config *Config, streamCancel context.CancelFunc, chromeCancels []context.CancelFunc, xvfbCmds []*exec.Cmd) error {
-	logger := utils.GetLoggerFromContext(ctx)
-	logger.Info("Starting FFmpeg stream", zap.Int("numTracks", len(config.Outputs)))
-
-	var args []string
 
-	// Build x11grab inputs — one per unique display (primary tracks only)
-	displayToInputIdx := make(map[int]int)
-	inputIdx := 0
-	for _, output := range config.Outputs {
-		if _, exists := displayToInputIdx[output.Display]; exists {
-			continue
-		}
-		// Find the primary output for this display to get capture dimensions
-		var captureWidth, captureHeight, captureFPS int
-		for _, o := range config.Outputs {
-			if o.Display == output.Display && o.SourceDisplay == 0 {
-				captureWidth = o.Width
-				captureHeight = o.Height
-				captureFPS = o.Framerate
-				break
-			}
-		}
-		if captureWidth == 0 {
-			captureWidth = output.Width
-			captureHeight = output.Height
-			captureFPS = output.Framerate
+	if err := navigateWithRetry(ctx, chromeCtx, config, monitor, output.Display, config.NavigationRetries); err != nil {
+		// With a fallback configured keep the canvas streaming it; the navigation
+		// supervisor keeps retrying the webpage and switches back once it loads
+		if config.Fallback == nil || chromeCtx.Err() != nil {
+			combinedCancel()
+			return nil, nil, fmt.Errorf("failed to navigate to webpage on display :%d: %w", output.Display, err)
 		}
-
-		args = append(args,
-			"-thread_queue_size", "512",
-			"-f", "x11grab",
-			"-draw_mouse", "0",
-			"-video_size", fmt.Sprintf("%dx%d", captureWidth, captureHeight),
-			"-framerate", strconv.Itoa(captureFPS),
-			"-i", fmt.Sprintf(":%d+0,0", output.Display),
-		)
-		displayToInputIdx[output.Display] = inputIdx
-		inputIdx++
-	}
-
-	// Audio input
-	args = append(args,
-		"-thread_queue_size", "512",
-		"-f", "alsa",
-		"-i", "default",
-	)
-	audioInputIdx := inputIdx
-
-	// Build filter_complex for scaling secondary tracks.
-	// When an input feeds both a primary and secondary track, we use split to
-	// duplicate the stream — one copy passes through as-is, the other gets scaled.
-	var filterParts []string
-	streamLabels := make([]string, len(config.Outputs))
-	needsFilter := false
-
-	// First pass: determine which inputs need splitting
-	inputNeedsFilter := make(map[int]bool)
-	for _, output := range config.Outputs {
-		if output.SourceDisplay != 0 {
-			srcInput := displayToInputIdx[output.Display]
-			inputNeedsFilter[srcInput] = true
-			needsFilter = true
+		if err := showNavigationFallback(chromeCtx, config, output.Display); err != nil {
+			combinedCancel()
+			return nil, nil, fmt.Errorf("failed to show fallback on display :%d: %w", output.Display, err)
 		}
+		logger.Warn("Webpage unreachable, streaming fallback until it loads",
+			zap.Int("display", output.Display),
+			zap.String("fallback", config.Fallback.Path),
+			zap.Error(err))
+		monitor.signal()
+		return chromeCtx, combinedCancel, nil
 	}
 
-	if needsFilter {
-		// Count how many outputs each input feeds (for split count)
-		inputOutputCount := make(map[int]int)
-		for _, output := range config.Outputs {
-			srcInput := displayToInputIdx[output.Display]
-			inputOutputCount[srcInput]++
-		}
-
-		// Track which split output index we're at for each input
-		inputSplitIdx := make(map[int]int)
-
-		for i, output := range config.Outputs {
-			srcInput := displayToInputIdx[output.Display]
-
-			if !inputNeedsFilter[srcInput] {
-				// This input has no secondaries — pass through directly
-				streamLabels[i] = fmt.Sprintf("%d:v", srcInput)
-			} else {
-				splitIdx := inputSplitIdx[srcInput]
-				inputSplitIdx[srcInput] = splitIdx + 1
-				label := fmt.Sprintf("v%d", i)
-
-				if splitIdx == 0 {
-					// First output for this input — add the split filter
-					splitCount := inputOutputCount[srcInput]
-					splitLabels := make([]string, splitCount)
-					for s := 0; s < splitCount; s++ {
-						splitLabels[s] = fmt.Sprintf("[in%d_%d]", srcInput, s)
-					}
-					filterParts = append(filterParts,
-						fmt.Sprintf("[%d:v]split=%d%s", srcInput, splitCount, strings.Join(splitLabels, "")))
-				}
-
-				splitPadLabel := fmt.Sprintf("[in%d_%d]", srcInput, splitIdx)
-
-				if output.SourceDisplay == 0 {
-					// Primary track — just rename the split output
-					filterParts = append(filterParts,
-						fmt.Sprintf("%snull[%s]", splitPadLabel, label))
-				} else {
-					// Secondary track — scale from split output
-					filterParts = append(filterParts,
-						fmt.Sprintf("%sscale=%d:%d[%s]", splitPadLabel, output.Width, output.Height, label))
-				}
-				streamLabels[i] = fmt.Sprintf("[%s]", label)
-			}
-		}
+	timeToReady, err := waitPageReady(chromeCtx, readiness, navigateStart, output.Display)
+	if err != nil {
+		combinedCancel()
+		return nil, nil, fmt.Errorf("display :%d: %w", output.Display, err)
 	}
+	logger.Info("Webpage ready", zap.Int("display", output.Display), zap.Duration("timeToReady", timeToReady))
 
-	if needsFilter {
-		args = append(args, "-filter_complex", strings.Join(filterParts, ";"))
-	}
+	return chromeCtx, combinedCancel, nil
+}
 
-	// Map video streams
-	for i := range config.Outputs {
-		if needsFilter && inputNeedsFilter[displayToInputIdx[config.Outputs[i].Display]] {
-			args = append(args, "-map", streamLabels[i])
-		} else {
-			srcInput := displayToInputIdx[config.Outputs[i].Display]
-			args = append(args, "-map", fmt.Sprintf("%d:v", srcInput))
+// ffmpegCommand describes the FFmpeg command for the configured tracks, running the
+// frame and silence detectors' filters when they are enabled.
+func ffmpegCommand(config *Config, frames *frameMonitor, audio *audioMonitor) ffmpeg.Command {
+	tracks := make([]ffmpeg.Track, len(config.Outputs))
+	for i, output := range config.Outputs {
+		tracks[i] = ffmpeg.Track{
+			Width:        output.Width,
+			Height:       output.Height,
+			Framerate:    output.Framerate,
+			VideoBitrate: output.VideoBitrate,
+			Display:      output.Display,
+			Secondary:    output.SourceDisplay != 0,
 		}
 	}
-	// Map audio
-	args = append(args, "-map", fmt.Sprintf("%d:a", audioInputIdx))
-
-	encoderPreset := utils.GetEnvOrDefault("ENCODER_PRESET", "ultrafast")
-	numOutputs := len(config.Outputs)
-	threadsPerEncoder := 4
-	if numOutputs > 0 {
-		numCPU := runtime.NumCPU()
-		threadsPerEncoder = numCPU / numOutputs
-		if threadsPerEncoder < 2 {
-			threadsPerEncoder = 2
-		}
-		if threadsPerEncoder > 8 {
-			threadsPerEncoder = 8
-		}
+	return ffmpeg.Command{
+		Tracks:            tracks,
+		Preset:            utils.GetEnvOrDefault("ENCODER_PRESET", "ultrafast"),
+		ThreadsPerEncoder: ffmpeg.ThreadsPerEncoder(runtime.NumCPU(), len(tracks)),
+		CanvasFilter:      frames.filterChain,
+		AudioFilter:       audio.filterGraph,
+		URL:               config.ingestURL(),
 	}
+}
 
-	args = append(args,
-		"-c:v", "libx264",
-		"-preset", encoderPreset,
-		"-pix_fmt", "yuv420p",
-	)
-
-	for i, output := range config.Outputs {
-		bitrate := output.VideoBitrate
-		bufsize := fmt.Sprintf("%dk", extractNumberFromBitrate(bitrate)*2)
-		gopSize := output.Framerate * 2
-
-		args = append(args,
-			fmt.Sprintf("-threads:v:%d", i), strconv.Itoa(threadsPerEncoder),
-			fmt.Sprintf("-b:v:%d", i), bitrate,
-			fmt.Sprintf("-maxrate:v:%d", i), bitrate,
-			fmt.Sprintf("-bufsize:v:%d", i), bufsize,
-			fmt.Sprintf("-g:v:%d", i), strconv.Itoa(gopSize),
-		)
-	}
+// startEncoder starts FFmpeg with the stream's command line, feeding its log output
+// to the frame and silence monitors.
+func (ffmpegLauncher) startEncoder(ctx context.Context, config *Config, frames *frameMonitor, audio *audioMonitor) (encoder, error) {
+	logger := utils.GetLoggerFromContext(ctx)
+	logger.Info("Starting FFmpeg stream", zap.Int("numTracks", len(config.Outputs)))
 
-	args = append(args,
-		"-c:a", "aac",
-		"-b:a", "160k",
-		"-ar", "44100",
-		"-f", "flv",
-		config.RTMPURL,
-	)
+	args := ffmpegCommand(config, frames, audio).Args()
 
 	zapWriter := &zapio.Writer{Log: logger, Level: zap.DebugLevel}
+	// Stdout and stderr share one writer so exec never calls it concurrently
+	writers := []io.Writer{zapWriter}
+	if frames != nil {
+		writers = append(writers, frames.writer())
+	}
+	if audio != nil {
+		writers = append(writers, audio.writer())
+	}
+	var outputWriter io.Writer = zapWriter
+	if len(writers) > 1 {
+		outputWriter = io.MultiWriter(writers...)
+	}
 
 	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	cmd.Stdout = zapWriter
-	cmd.Stderr = zapWriter
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
 
 	logger.Debug("Starting FFmpeg with command", zap.Strings("args", args))
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	process, err := startFFmpegProcess(cmd, config.FFmpegQuitTimeout, config.FFmpegTermTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
 
 	go func() {
@@ -1045,32 +1262,33 @@ func startFFmpegStream(ctx context.Context, config *Config, streamCancel context
 		for {
 			select {
 			case <-ticker.C:
-				if cmd.Process != nil && cmd.ProcessState == nil {
-					zapWriter.Sync()
-				} else {
-					return
-				}
+				zapWriter.Sync()
+			case <-process.done:
+				return
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 
-	globalStreamState.setStreamRunning(streamCancel, chromeCancels, xvfbCmds, cmd)
+	return process, nil
+}
 
-	logger.Debug("FFmpeg started successfully, streaming...")
+// startFFmpegStream starts the encoder and blocks until it exits, recording it on
+// the stream state meanwhile so stopStream can shut it down.
+func startFFmpegStream(ctx context.Context, config *Config, encoders encoderLauncher, frames *frameMonitor, audio *audioMonitor) error {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	ffmpeg, err := encoders.startEncoder(ctx, config, frames, audio)
+	if err != nil {
+		return err
+	}
+	globalStreamState.setFFmpeg(ffmpeg)
 
-	err := cmd.Wait()
+	logger.Debug("FFmpeg started successfully, streaming...")
 
-	defer func() {
-		globalStreamState.mu.Lock()
-		globalStreamState.isRunning = false
-		globalStreamState.cancelFunc = nil
-		globalStreamState.chromeCancels = nil
-		globalStreamState.xvfbCmds = nil
-		globalStreamState.ffmpegCmd = nil
-		globalStreamState.mu.Unlock()
-	}()
+	err = ffmpeg.wait()
+	globalStreamState.setFFmpeg(nil)
 
 	if ctx.Err() != nil {
 		logger.Info("Stream stopped due to context cancellation")
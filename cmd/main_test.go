@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os/exec"
 	"testing"
 
 	"go.uber.org/zap"
@@ -19,8 +18,9 @@ func resetGlobalStreamState() {
 	globalStreamState.isRunning = false
 	globalStreamState.cancelFunc = nil
 	globalStreamState.chromeCancels = nil
-	globalStreamState.xvfbCmds = nil
-	globalStreamState.ffmpegCmd = nil
+	globalStreamState.xvfbServers = nil
+	globalStreamState.ffmpeg = nil
+	globalStreamState.ingest = ""
 }
 
 func TestRestartStream(t *testing.T) {
@@ -66,8 +66,8 @@ func TestIsStreamRunning(t *testing.T) {
 		_, chromeCancel := context.WithCancel(context.Background())
 		defer chromeCancel()
 
-		mockCmd := &exec.Cmd{}
-		globalStreamState.setStreamRunning(cancel, []context.CancelFunc{chromeCancel}, nil, mockCmd)
+		mockFFmpeg := &ffmpegProcess{}
+		globalStreamState.setStreamRunning(cancel, []context.CancelFunc{chromeCancel}, nil, mockFFmpeg)
 
 		if !IsStreamRunning() {
 			t.Error("Expected stream to be running after setting global state")
@@ -84,8 +84,8 @@ func TestStopCurrentStream(t *testing.T) {
 
 		_, cancel := context.WithCancel(context.Background())
 		_, chromeCancel := context.WithCancel(context.Background())
-		mockCmd := &exec.Cmd{}
-		globalStreamState.setStreamRunning(cancel, []context.CancelFunc{chromeCancel}, nil, mockCmd)
+		mockFFmpeg := &ffmpegProcess{}
+		globalStreamState.setStreamRunning(cancel, []context.CancelFunc{chromeCancel}, nil, mockFFmpeg)
 
 		if !globalStreamState.isRunning {
 			t.Fatal("Expected stream to be running before stopping")
@@ -386,6 +386,10 @@ func TestDeriveBitrate(t *testing.T) {
 }
 
 func TestGetHealthResponse(t *testing.T) {
+	original := globalRestartSupervisor
+	defer func() { globalRestartSupervisor = original }()
+	globalRestartSupervisor = newRestartSupervisor(testRestartPolicy)
+
 	t.Run("Health Response Structure", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/health", nil)
 		w := httptest.NewRecorder()
@@ -419,34 +423,3 @@ func TestGetHealthResponse(t *testing.T) {
 		}
 	})
 }
-
-func TestExtractNumberFromBitrate(t *testing.T) {
-	t.Run("Valid Bitrate Strings", func(t *testing.T) {
-		testCases := []struct {
-			input    string
-			expected int
-		}{
-			{"3000k", 3000},
-			{"4500k", 4500},
-			{"6000k", 6000},
-			{"8500k", 8500},
-			{"1000k", 1000},
-		}
-
-		for _, tc := range testCases {
-			t.Run("Bitrate "+tc.input, func(t *testing.T) {
-				result := extractNumberFromBitrate(tc.input)
-				if result != tc.expected {
-					t.Errorf("Expected %d, got %d", tc.expected, result)
-				}
-			})
-		}
-	})
-
-	t.Run("Invalid Bitrate String", func(t *testing.T) {
-		result := extractNumberFromBitrate("invalidk")
-		if result != 3000 {
-			t.Errorf("Expected default value 3000, got %d", result)
-		}
-	})
-}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Application metrics, exposed on /metrics alongside the default Go collectors.
+// Per-canvas metrics are labelled by X display number.
+var (
+	// Time from starting navigation until the page's readiness condition is met
+	pageReadySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stream_webpage_page_ready_seconds",
+		Help:    "Time from navigation start until the webpage was considered ready to capture.",
+		Buckets: []float64{0.5, 1, 2, 3, 5, 10, 20, 30, 60, 120},
+	}, []string{"display"})
+
+	// Chrome crashes (Inspector.targetCrashed) and hangs (missed heartbeats) detected by the watchdog
+	chromeFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_chrome_failures_total",
+		Help: "Number of Chrome renderer crashes or hangs detected, by reason.",
+	}, []string{"display", "reason"})
+
+	// Successful in-place Chrome recoveries, by whether a reload was enough or the browser was recreated
+	chromeRecoveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_chrome_recoveries_total",
+		Help: "Number of successful in-place Chrome recoveries, by action taken.",
+	}, []string{"display", "action"})
+
+	// Uncaught JavaScript exceptions (Runtime.exceptionThrown) raised by the captured page
+	pageExceptionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_page_exceptions_total",
+		Help: "Number of uncaught JavaScript exceptions thrown by the webpage.",
+	}, []string{"display"})
+
+	// HTTP errors and network failures for the main document and critical resources
+	pageLoadFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_page_load_failures_total",
+		Help: "Number of failed loads of the webpage's main document or critical resources, by HTTP status or network error.",
+	}, []string{"display", "resource", "status"})
+
+	// Whether a canvas is currently showing the fallback page instead of the webpage
+	fallbackActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stream_webpage_fallback_active",
+		Help: "Whether the canvas is showing the fallback page (1) or the webpage (0).",
+	}, []string{"display"})
+
+	// Black or frozen pictures that outlasted their threshold, counted each time the action runs
+	frameIssuesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_frame_issues_total",
+		Help: "Number of times a canvas stayed black or frozen past its threshold, by kind.",
+	}, []string{"display", "kind"})
+
+	// Whether a canvas is currently black or frozen past its threshold
+	frameIssueActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stream_webpage_frame_issue_active",
+		Help: "Whether the canvas is currently black or frozen past its threshold (1) or not (0), by kind.",
+	}, []string{"display", "kind"})
+
+	// RMS level of the outgoing audio track, sampled once per second while silence detection is enabled
+	audioLevelDBFS = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_webpage_audio_level_dbfs",
+		Help: "RMS level of the outgoing audio track over the last second, in dBFS.",
+	})
+
+	// How long the audio track has currently been silent
+	audioSilenceSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_webpage_audio_silence_seconds",
+		Help: "How long the outgoing audio track has been silent, or 0 while audio is playing.",
+	})
+
+	// Silences that outlasted the threshold, counted each time the action runs
+	audioSilencesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "stream_webpage_audio_silences_total",
+		Help: "Number of times the audio track stayed silent past its threshold.",
+	})
+
+	// Stream attempts that ended with an error and were restarted with backoff
+	restartFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "stream_webpage_restart_failures_total",
+		Help: "Number of stream attempts that ended with an error.",
+	})
+
+	// Whether the restart circuit breaker is open (too many failures, waiting out the cooldown)
+	circuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_webpage_restart_circuit_open",
+		Help: "Whether the restart circuit breaker is open (1) or closed (0).",
+	})
+
+	// FFmpeg or Xvfb restarts done without restarting the rest of the pipeline
+	componentRestartsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_component_restarts_total",
+		Help: "Number of individual pipeline component restarts, by component (display is empty for FFmpeg).",
+	}, []string{"component", "display"})
+
+	// Whether Enhanced Broadcasting is enabled but the Go Live API and cache both failed
+	goLiveDegraded = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_webpage_golive_degraded",
+		Help: "Whether Enhanced Broadcasting fell back to the standard configuration (1) or not (0).",
+	})
+
+	// The ingest endpoint FFmpeg is publishing to
+	ingestActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stream_webpage_ingest_active",
+		Help: "Ingest endpoint FFmpeg is publishing to (1), by scheme and host.",
+	}, []string{"ingest"})
+
+	// Failovers to the next ingest endpoint after failed connections
+	ingestFailoversTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_ingest_failovers_total",
+		Help: "Number of failovers away from an ingest endpoint FFmpeg failed to connect to.",
+	}, []string{"ingest"})
+
+	// Switches back to the primary ingest once it is reachable again
+	ingestFailbacksTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "stream_webpage_ingest_failbacks_total",
+		Help: "Number of times FFmpeg was moved from a backup back to the primary ingest.",
+	})
+
+	// Whether the EventSub WebSocket is connected and subscribed to the channel's stream events
+	eventSubConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_webpage_eventsub_connected",
+		Help: "Whether the Twitch EventSub connection is subscribed (1) or not (0).",
+	})
+
+	// Stream notifications received over EventSub
+	eventSubNotificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_webpage_eventsub_notifications_total",
+		Help: "Number of Twitch EventSub notifications received, by type.",
+	}, []string{"type"})
+)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// mockGoLiveCommand is the subcommand that runs the Go Live mock server instead of a stream.
+const mockGoLiveCommand = "mock-golive"
+
+// runMockGoLive serves canned Go Live responses so Enhanced Broadcasting can be
+// rehearsed without Twitch. Point TWITCH_GO_LIVE_URL at it.
+func runMockGoLive(ctx context.Context, args []string) error {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	flags := flag.NewFlagSet(mockGoLiveCommand, flag.ContinueOnError)
+	addr := flags.String("addr", ":8081", "address to listen on")
+	scenario := flags.String("scenario", twitch.MockScenarioSuccess,
+		"scenario for requests whose path doesn't name one ("+strings.Join(twitch.MockGoLiveScenarios(), ", ")+")")
+	ingest := flags.String("ingest", twitch.DefaultMockIngestURL, "ingest URL template handed out, containing {stream_key}")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if _, ok := twitch.MockGoLiveResponse(*scenario, *ingest, ""); !ok {
+		return fmt.Errorf("unknown scenario %q, expected one of: %s", *scenario, strings.Join(twitch.MockGoLiveScenarios(), ", "))
+	}
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: twitch.NewMockGoLiveHandler(logger, *scenario, *ingest),
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Starting Go Live mock server",
+		zap.String("address", *addr),
+		zap.String("defaultScenario", *scenario),
+		zap.String("ingest", *ingest))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
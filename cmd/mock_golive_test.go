@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/twitch"
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func TestLoadConfigWithGoLiveMock(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	server := httptest.NewServer(twitch.NewMockGoLiveHandler(logger, twitch.MockScenarioSuccess, "rtmp://127.0.0.1:1935/live/{stream_key}"))
+	t.Cleanup(server.Close)
+
+	setup := func(t *testing.T, scenario string) {
+		t.Setenv("TWITCH_ENHANCED_BROADCASTING", "true")
+		t.Setenv("TWITCH_STREAM_KEY", "live_test_key")
+		t.Setenv("TWITCH_GO_LIVE_URL", server.URL+"/"+scenario)
+		t.Setenv("RTMP_URL", "rtmp://fallback.example.com/live/stream")
+		t.Setenv("STREAM_OUTPUTS", "")
+	}
+
+	t.Run("Portrait Scenario Configures Both Canvases", func(t *testing.T) {
+		setup(t, twitch.MockScenarioPortrait)
+
+		config, err := loadConfig(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if config.RTMPURL != "rtmp://127.0.0.1:1935/live/live_test_key?clientConfigId=mock-portrait" {
+			t.Errorf("Expected the mock ingest URL, got %q", config.RTMPURL)
+		}
+		if len(config.Outputs) != 4 {
+			t.Fatalf("Expected 4 outputs, got %d", len(config.Outputs))
+		}
+		displays := make(map[int]bool)
+		for _, output := range config.Outputs {
+			displays[output.Display] = true
+		}
+		if len(displays) != 2 {
+			t.Errorf("Expected a landscape and a portrait canvas, got displays %v", displays)
+		}
+	})
+
+	t.Run("Newer Schema Falls Back On Bad Request", func(t *testing.T) {
+		setup(t, twitch.MockScenarioLegacySchema)
+		t.Setenv("TWITCH_GO_LIVE_SCHEMA", twitch.GoLiveSchemaVersion2025)
+
+		config, err := loadConfig(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if config.RTMPURL != "rtmp://127.0.0.1:1935/live/live_test_key?clientConfigId=mock-legacy-schema" {
+			t.Errorf("Expected the mock ingest URL, got %q", config.RTMPURL)
+		}
+	})
+
+	t.Run("Unknown Schema Is Rejected", func(t *testing.T) {
+		setup(t, twitch.MockScenarioSuccess)
+		t.Setenv("TWITCH_GO_LIVE_SCHEMA", "2023-05-10")
+
+		if _, err := loadConfig(ctx); err == nil {
+			t.Error("Expected an error for an unknown TWITCH_GO_LIVE_SCHEMA")
+		}
+	})
+
+	t.Run("Unknown GPU Profile Is Rejected", func(t *testing.T) {
+		setup(t, twitch.MockScenarioSuccess)
+		t.Setenv("TWITCH_GO_LIVE_GPU", "voodoo")
+
+		if _, err := loadConfig(ctx); err == nil {
+			t.Error("Expected an error for an unknown TWITCH_GO_LIVE_GPU")
+		}
+	})
+
+	t.Run("Error Scenario Falls Back To RTMP_URL", func(t *testing.T) {
+		setup(t, twitch.MockScenarioError)
+
+		config, err := loadConfig(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if config.RTMPURL != "rtmp://fallback.example.com/live/stream" {
+			t.Errorf("Expected fallback RTMP URL, got %q", config.RTMPURL)
+		}
+	})
+
+	t.Run("No RTMP Scenario Falls Back To RTMP_URL", func(t *testing.T) {
+		setup(t, twitch.MockScenarioNoRTMP)
+
+		config, err := loadConfig(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if config.RTMPURL != "rtmp://fallback.example.com/live/stream" {
+			t.Errorf("Expected fallback RTMP URL, got %q", config.RTMPURL)
+		}
+	})
+}
+
+func TestRunMockGoLiveRejectsUnknownScenario(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	if err := runMockGoLive(ctx, []string{"-scenario", "bogus"}); err == nil {
+		t.Error("Expected an error for an unknown scenario")
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default number of attempts to load the webpage before giving up and restarting the stream
+	DefaultNavigationRetries = 3
+	// First delay between navigation retries; doubles after every failed attempt
+	navigationRetryBaseDelay = 2 * time.Second
+	// Upper bound for the delay between navigation retries
+	navigationRetryMaxDelay = 60 * time.Second
+	// How long the HTTP check made before each navigation may take
+	webpageCheckTimeout = 10 * time.Second
+)
+
+// Resource kinds recorded on the page load failure metric
+const (
+	resourceDocument = "document"
+	resourceCritical = "critical"
+)
+
+// navigationFallbackHTML is shown in the browser while the webpage is failing to load
+// so viewers see a holding slate instead of a browser or server error page.
+const navigationFallbackHTML = `<!DOCTYPE html><html><head><style>` +
+	`html,body{margin:0;height:100%;background:#0e0e10;color:#efeff1;font-family:sans-serif;}` +
+	`body{display:flex;align-items:center;justify-content:center;font-size:4vmin;}` +
+	`</style></head><body>Stream will resume shortly</body></html>`
+
+// PageLoadError reports an HTTP error or network failure for the webpage's main
+// document or one of its configured critical resources.
+type PageLoadError struct {
+	Resource string
+	URL      string
+	// Status is the HTTP status code, or the network error text when no response arrived
+	Status string
+}
+
+func (e *PageLoadError) Error() string {
+	return fmt.Sprintf("%s %s failed to load: %s", e.Resource, e.URL, e.Status)
+}
+
+// parseCriticalResources splits WEBPAGE_CRITICAL_RESOURCES into URL substrings.
+func parseCriticalResources(value string) []string {
+	var resources []string
+	for _, r := range strings.Split(value, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+// networkMonitor watches a display's browser for failed loads of the main document
+// and critical resources. It outlives individual browsers: attach it to every
+// chromedp context created for the display.
+type networkMonitor struct {
+	display  int
+	critical []string
+	// reloadOnCritical makes critical resource failures fail the page like the main
+	// document does; otherwise they are only counted and logged
+	reloadOnCritical bool
+	logger           *zap.Logger
+
+	mu sync.Mutex
+	// URLs of in-flight requests we care about, so loadingFailed can be attributed
+	tracked map[network.RequestID]trackedRequest
+	// First failure since the last reset
+	failure *PageLoadError
+	// Signalled whenever a failure is recorded, for the navigation supervisor
+	failures chan struct{}
+}
+
+type trackedRequest struct {
+	resource string
+	url      string
+}
+
+func newNetworkMonitor(ctx context.Context, config *Config, output StreamOutput) *networkMonitor {
+	return &networkMonitor{
+		display:          output.Display,
+		critical:         config.CriticalResources,
+		reloadOnCritical: config.CriticalResourcesReload,
+		logger:           utils.GetLoggerFromContext(ctx),
+		tracked:          make(map[network.RequestID]trackedRequest),
+		failures:         make(chan struct{}, 1),
+	}
+}
+
+// classify returns which kind of monitored resource a request is, or "" if it isn't monitored.
+func (m *networkMonitor) classify(resourceType network.ResourceType, frameID, mainFrameID cdp.FrameID, requestURL string) string {
+	if resourceType == network.ResourceTypeDocument && frameID == mainFrameID {
+		return resourceDocument
+	}
+	for _, c := range m.critical {
+		if strings.Contains(requestURL, c) {
+			return resourceCritical
+		}
+	}
+	return ""
+}
+
+// attach starts monitoring the browser behind chromeCtx. It must be called before
+// the first navigation so the main document request is seen.
+func (m *networkMonitor) attach(chromeCtx context.Context) {
+	chromedp.ListenTarget(chromeCtx, func(ev any) {
+		switch e := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			// For page targets the main frame ID is the target ID
+			mainFrameID := cdp.FrameID(chromedp.FromContext(chromeCtx).Target.TargetID)
+			if resource := m.classify(e.Type, e.FrameID, mainFrameID, e.Request.URL); resource != "" {
+				m.mu.Lock()
+				m.tracked[e.RequestID] = trackedRequest{resource: resource, url: e.Request.URL}
+				m.mu.Unlock()
+			}
+		case *network.EventResponseReceived:
+			m.mu.Lock()
+			req, ok := m.tracked[e.RequestID]
+			m.mu.Unlock()
+			if ok && e.Response != nil && e.Response.Status >= 400 {
+				m.record(&PageLoadError{Resource: req.resource, URL: req.url, Status: strconv.FormatInt(e.Response.Status, 10)})
+			}
+		case *network.EventLoadingFailed:
+			m.mu.Lock()
+			req, ok := m.tracked[e.RequestID]
+			delete(m.tracked, e.RequestID)
+			m.mu.Unlock()
+			// Cancelled requests are usually our own navigation replacing the page
+			if ok && !e.Canceled {
+				m.record(&PageLoadError{Resource: req.resource, URL: req.url, Status: e.ErrorText})
+			}
+		case *network.EventLoadingFinished:
+			m.mu.Lock()
+			delete(m.tracked, e.RequestID)
+			m.mu.Unlock()
+		}
+	})
+}
+
+// count counts and logs a failure.
+func (m *networkMonitor) count(failure *PageLoadError) {
+	pageLoadFailuresTotal.WithLabelValues(strconv.Itoa(m.display), failure.Resource, failure.Status).Inc()
+	m.logger.Warn("Webpage resource failed to load",
+		zap.Int("display", m.display),
+		zap.String("resource", failure.Resource),
+		zap.String("url", failure.URL),
+		zap.String("status", failure.Status))
+}
+
+// record counts and logs a failure, remembers it, and wakes the navigation supervisor.
+// Critical resource failures are only counted unless reloadOnCritical is set.
+func (m *networkMonitor) record(failure *PageLoadError) {
+	m.count(failure)
+	if failure.Resource == resourceCritical && !m.reloadOnCritical {
+		return
+	}
+
+	m.mu.Lock()
+	if m.failure == nil {
+		m.failure = failure
+	}
+	m.mu.Unlock()
+
+	m.signal()
+}
+
+// reset forgets earlier failures before a new navigation attempt.
+func (m *networkMonitor) reset() {
+	m.mu.Lock()
+	m.failure = nil
+	m.mu.Unlock()
+	select {
+	case <-m.failures:
+	default:
+	}
+}
+
+// err returns the first failure since the last reset, if any.
+func (m *networkMonitor) err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failure == nil {
+		return nil
+	}
+	return m.failure
+}
+
+// signal wakes the navigation supervisor without recording a failure, e.g. when the
+// initial navigation gave up and the browser is left showing the fallback.
+func (m *networkMonitor) signal() {
+	select {
+	case m.failures <- struct{}{}:
+	default:
+	}
+}
+
+// navigationFallbackURL returns the configured FALLBACK_SOURCE page, or the built-in
+// holding slate when none is set.
+func navigationFallbackURL(config *Config) string {
+	if config.Fallback != nil {
+		return config.Fallback.URL
+	}
+	return "data:text/html;charset=utf-8," + url.PathEscape(navigationFallbackHTML)
+}
+
+// showNavigationFallback replaces whatever the browser shows with the fallback page
+// and marks the canvas as showing it.
+func showNavigationFallback(chromeCtx context.Context, config *Config, display int) error {
+	fallbackActive.WithLabelValues(strconv.Itoa(display)).Set(1)
+	return chromedp.Run(chromeCtx, chromedp.Navigate(navigationFallbackURL(config)))
+}
+
+// checkWebpage requests the webpage from Go, with the browser's cookies and the
+// configured headers and basic auth, so a failing server is detected without its error
+// page being rendered on the canvas. Only http and https webpages are checked.
+func checkWebpage(ctx context.Context, chromeCtx context.Context, config *Config) *PageLoadError {
+	parsed, err := url.Parse(config.WebpageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, webpageCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(checkCtx, http.MethodGet, config.WebpageURL, nil)
+	if err != nil {
+		return &PageLoadError{Resource: resourceDocument, URL: config.WebpageURL, Status: err.Error()}
+	}
+	for name, value := range config.PageAuth.Headers {
+		req.Header.Set(name, value)
+	}
+	if basic := config.PageAuth.BasicAuth; basic != nil {
+		req.SetBasicAuth(basic.Username, basic.Password)
+	}
+	// Cookies come from the browser so sessions from WEBPAGE_LOGIN_STEPS are included
+	var cookies []*network.Cookie
+	if err := chromedp.Run(chromeCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		cookies, err = network.GetCookies().WithURLs([]string{config.WebpageURL}).Do(ctx)
+		return err
+	})); err != nil {
+		utils.GetLoggerFromContext(ctx).Debug("Failed to read browser cookies for webpage check", zap.Error(err))
+	}
+	for _, c := range cookies {
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+
+	resp, err := webpageCheckClient(config).Do(req)
+	if err != nil {
+		return &PageLoadError{Resource: resourceDocument, URL: config.WebpageURL, Status: err.Error()}
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &PageLoadError{Resource: resourceDocument, URL: config.WebpageURL, Status: strconv.Itoa(resp.StatusCode)}
+	}
+	return nil
+}
+
+// webpageCheckClient returns the client checkWebpage uses. Redirects are followed, but
+// the configured headers, basic auth and cookies are dropped once a redirect leaves
+// the webpage's origin, like the browser does with listenForPageAuth.
+func webpageCheckClient(config *Config) *http.Client {
+	origin := urlOrigin(config.WebpageURL)
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if urlOrigin(req.URL.String()) != origin {
+				for name := range config.PageAuth.Headers {
+					req.Header.Del(name)
+				}
+				req.Header.Del("Authorization")
+				req.Header.Del("Cookie")
+			}
+			return nil
+		},
+	}
+}
+
+// nextNavigationDelay doubles the retry delay up to navigationRetryMaxDelay.
+func nextNavigationDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > navigationRetryMaxDelay {
+		return navigationRetryMaxDelay
+	}
+	return delay
+}
+
+// navigateWithRetry loads the webpage until the main document and critical resources
+// load without errors, showing the fallback slate between attempts and backing off
+// exponentially. The canvas still counts as showing the fallback until waitPageReady
+// passes. Each attempt first checks the webpage with checkWebpage and only
+// navigates the canvas once that passes, so error pages stay off screen.
+// maxAttempts <= 0 retries until chromeCtx is cancelled.
+func navigateWithRetry(ctx context.Context, chromeCtx context.Context, config *Config, monitor *networkMonitor, display int, maxAttempts int) error {
+	logger := utils.GetLoggerFromContext(ctx)
+	delay := navigationRetryBaseDelay
+	onFallback := false
+
+	for attempt := 1; ; attempt++ {
+		monitor.reset()
+		var err error
+		if loadErr := checkWebpage(ctx, chromeCtx, config); loadErr != nil {
+			monitor.count(loadErr)
+			err = loadErr
+		} else {
+			onFallback = false
+			err = chromedp.Run(chromeCtx,
+				chromedp.Navigate(config.WebpageURL),
+				chromedp.WaitVisible("body", chromedp.ByQuery),
+			)
+			if err == nil {
+				err = monitor.err()
+			}
+			if err == nil {
+				return nil
+			}
+		}
+		if chromeCtx.Err() != nil || (maxAttempts > 0 && attempt >= maxAttempts) {
+			return err
+		}
+
+		logger.Warn("Webpage failed to load, showing fallback page and retrying",
+			zap.Int("display", display),
+			zap.Int("attempt", attempt),
+			zap.Duration("retryIn", delay),
+			zap.Error(err))
+		if !onFallback {
+			if err := showNavigationFallback(chromeCtx, config, display); err != nil {
+				logger.Debug("Failed to show navigation fallback page", zap.Int("display", display), zap.Error(err))
+			} else {
+				onFallback = true
+			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-chromeCtx.Done():
+			return chromeCtx.Err()
+		}
+		delay = nextNavigationDelay(delay)
+	}
+}
+
+// waitPageReady waits for a freshly loaded page to meet its ready condition. Only then
+// is the canvas marked as off the fallback and the time since navigateStart recorded.
+func waitPageReady(chromeCtx context.Context, readiness *pageReadiness, navigateStart time.Time, display int) (time.Duration, error) {
+	if err := readiness.wait(chromeCtx); err != nil {
+		return 0, err
+	}
+	timeToReady := time.Since(navigateStart)
+	fallbackActive.WithLabelValues(strconv.Itoa(display)).Set(0)
+	pageReadySeconds.WithLabelValues(strconv.Itoa(display)).Observe(timeToReady.Seconds())
+	return timeToReady, nil
+}
+
+// superviseNavigation re-navigates a running browser whenever its main document (or,
+// with CriticalResourcesReload, a critical resource) fails to load, for example a 502
+// after a refresh. It retries until the page loads again and meets its ready
+// condition, keeping the fallback on screen until then. Runs until ctx is cancelled or
+// the instance is stopped.
+func superviseNavigation(ctx context.Context, config *Config, output StreamOutput, instance *chromeInstance) {
+	logger := utils.GetLoggerFromContext(ctx)
+	monitor := instance.network
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-monitor.failures:
+		}
+		if instance.isStopped() {
+			return
+		}
+
+		logger.Warn("Webpage failed while streaming, reloading with retries", zap.Int("display", output.Display))
+		timeToReady, err := reloadUntilReady(ctx, instance.context(), config, monitor, output.Display)
+		if err != nil {
+			if ctx.Err() != nil || instance.isStopped() {
+				return
+			}
+			logger.Warn("Webpage recovery failed, retrying", zap.Int("display", output.Display), zap.Error(err))
+			continue
+		}
+		logger.Info("Webpage recovered", zap.Int("display", output.Display), zap.Duration("timeToReady", timeToReady))
+	}
+}
+
+// reloadUntilReady loads the webpage again with navigateWithRetry and waits for its
+// ready condition, putting the fallback back on screen and re-arming the supervisor
+// if the page loads but never becomes ready. The readiness hooks from beforeNavigate
+// are not installed again: launchChrome added them to this browser, and they last
+// for the life of its page.
+func reloadUntilReady(ctx context.Context, chromeCtx context.Context, config *Config, monitor *networkMonitor, display int) (time.Duration, error) {
+	readiness := newPageReadiness(chromeCtx, config.ReadyCondition)
+	defer readiness.stopTracking()
+	navigateStart := time.Now()
+
+	if err := navigateWithRetry(ctx, chromeCtx, config, monitor, display, 0); err != nil {
+		return 0, err
+	}
+	timeToReady, err := waitPageReady(chromeCtx, readiness, navigateStart, display)
+	if err != nil {
+		if err := showNavigationFallback(chromeCtx, config, display); err != nil {
+			utils.GetLoggerFromContext(ctx).Debug("Failed to show navigation fallback page", zap.Int("display", display), zap.Error(err))
+		}
+		monitor.signal()
+		return 0, err
+	}
+	return timeToReady, nil
+}
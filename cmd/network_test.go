@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+func testNetworkMonitor(t *testing.T, critical []string) *networkMonitor {
+	t.Helper()
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+	return newNetworkMonitor(ctx, &Config{CriticalResources: critical, CriticalResourcesReload: true}, StreamOutput{Display: 100})
+}
+
+func TestParseCriticalResources(t *testing.T) {
+	got := parseCriticalResources(" /api/overlay , ,cdn.example.com/app.js,")
+	if len(got) != 2 || got[0] != "/api/overlay" || got[1] != "cdn.example.com/app.js" {
+		t.Errorf("Unexpected critical resources: %q", got)
+	}
+	if parseCriticalResources("") != nil {
+		t.Error("Expected no critical resources for empty value")
+	}
+}
+
+func TestNetworkMonitorClassify(t *testing.T) {
+	m := testNetworkMonitor(t, []string{"/api/overlay"})
+
+	tests := []struct {
+		name         string
+		resourceType network.ResourceType
+		frameID      string
+		url          string
+		expected     string
+	}{
+		{"Main Document", network.ResourceTypeDocument, "main", "https://dash.example.com/", resourceDocument},
+		{"Iframe Document", network.ResourceTypeDocument, "child", "https://ads.example.com/", ""},
+		{"Critical XHR", network.ResourceTypeXHR, "main", "https://dash.example.com/api/overlay?id=1", resourceCritical},
+		{"Other Resource", network.ResourceTypeImage, "main", "https://dash.example.com/logo.png", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := m.classify(tc.resourceType, cdp.FrameID(tc.frameID), cdp.FrameID("main"), tc.url); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNetworkMonitorRecordAndReset(t *testing.T) {
+	m := testNetworkMonitor(t, nil)
+
+	if m.err() != nil {
+		t.Fatal("Expected no failure before anything is recorded")
+	}
+
+	m.record(&PageLoadError{Resource: resourceDocument, URL: "https://dash.example.com/", Status: "502"})
+	m.record(&PageLoadError{Resource: resourceCritical, URL: "https://dash.example.com/api", Status: "net::ERR_CONNECTION_REFUSED"})
+
+	var loadErr *PageLoadError
+	if !errors.As(m.err(), &loadErr) || loadErr.Status != "502" {
+		t.Fatalf("Expected first failure (502) to be kept, got %v", m.err())
+	}
+	select {
+	case <-m.failures:
+	default:
+		t.Error("Expected the failure to be signalled")
+	}
+
+	m.record(&PageLoadError{Resource: resourceDocument, URL: "https://dash.example.com/", Status: "503"})
+	m.reset()
+	if m.err() != nil {
+		t.Error("Expected reset to clear the failure")
+	}
+	select {
+	case <-m.failures:
+		t.Error("Expected reset to drain pending failure signals")
+	default:
+	}
+}
+
+func TestNetworkMonitorCriticalWithoutReload(t *testing.T) {
+	m := testNetworkMonitor(t, []string{"/api"})
+	m.reloadOnCritical = false
+
+	m.record(&PageLoadError{Resource: resourceCritical, URL: "https://dash.example.com/api", Status: "500"})
+	if m.err() != nil {
+		t.Errorf("Expected critical failure to only be counted, got %v", m.err())
+	}
+	select {
+	case <-m.failures:
+		t.Error("Expected no reload to be signalled for a critical failure")
+	default:
+	}
+
+	m.record(&PageLoadError{Resource: resourceDocument, URL: "https://dash.example.com/", Status: "502"})
+	if m.err() == nil {
+		t.Error("Expected document failure to be recorded")
+	}
+}
+
+func TestCheckWebpage(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	status := http.StatusOK
+	var gotHeader, gotUser string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Token")
+		gotUser, _, _ = r.BasicAuth()
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		WebpageURL: server.URL,
+		PageAuth: PageAuth{
+			Headers:   map[string]string{"X-Token": "abc123"},
+			BasicAuth: &BasicAuthCredentials{Username: "user", Password: "pass"},
+		},
+	}
+
+	t.Run("Healthy Page", func(t *testing.T) {
+		if err := checkWebpage(ctx, context.Background(), config); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if gotHeader != "abc123" || gotUser != "user" {
+			t.Errorf("Expected headers and basic auth to be sent, got header %q and user %q", gotHeader, gotUser)
+		}
+	})
+
+	t.Run("HTTP Error", func(t *testing.T) {
+		status = http.StatusBadGateway
+		err := checkWebpage(ctx, context.Background(), config)
+		if err == nil || err.Status != "502" || err.Resource != resourceDocument {
+			t.Errorf("Expected a 502 document failure, got %v", err)
+		}
+	})
+
+	t.Run("Redirect To Another Origin Drops Credentials", func(t *testing.T) {
+		var leaked []string
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, name := range []string{"X-Token", "Authorization", "Cookie"} {
+				if r.Header.Get(name) != "" {
+					leaked = append(leaked, name)
+				}
+			}
+		}))
+		defer other.Close()
+		redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		}))
+		defer redirecting.Close()
+
+		redirectConfig := *config
+		redirectConfig.WebpageURL = redirecting.URL
+		if err := checkWebpage(ctx, context.Background(), &redirectConfig); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(leaked) > 0 {
+			t.Errorf("Expected no credentials to reach the other origin, got %v", leaked)
+		}
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		unreachable := &Config{WebpageURL: "http://127.0.0.1:1/"}
+		if err := checkWebpage(ctx, context.Background(), unreachable); err == nil {
+			t.Error("Expected an error for an unreachable webpage")
+		}
+	})
+
+	t.Run("Non HTTP Webpage Is Not Checked", func(t *testing.T) {
+		if err := checkWebpage(ctx, context.Background(), &Config{WebpageURL: "file:///srv/overlay.html"}); err != nil {
+			t.Errorf("Expected no check for a file URL, got %v", err)
+		}
+	})
+}
+
+func TestWaitPageReady(t *testing.T) {
+	const display = 101
+	fallbackActive.WithLabelValues("101").Set(1)
+
+	notReady := &pageReadiness{
+		cond:         &ReadyCondition{Type: ReadyConditionNetworkIdle, Timeout: 50 * time.Millisecond},
+		inFlight:     map[network.RequestID]bool{"1": true, "2": true, "3": true},
+		lastActivity: time.Now(),
+		stopTracking: func() {},
+	}
+	if _, err := waitPageReady(context.Background(), notReady, time.Now(), display); err == nil {
+		t.Fatal("Expected an error when the page does not become ready")
+	}
+	if got := testutil.ToFloat64(fallbackActive.WithLabelValues("101")); got != 1 {
+		t.Errorf("Expected the fallback to stay active until the page is ready, got %v", got)
+	}
+
+	ready := &pageReadiness{
+		cond:         &ReadyCondition{Type: ReadyConditionNetworkIdle, Timeout: time.Second},
+		inFlight:     make(map[network.RequestID]bool),
+		lastActivity: time.Now().Add(-time.Minute),
+		stopTracking: func() {},
+	}
+	if _, err := waitPageReady(context.Background(), ready, time.Now(), display); err != nil {
+		t.Fatalf("Expected the page to be ready, got %v", err)
+	}
+	if got := testutil.ToFloat64(fallbackActive.WithLabelValues("101")); got != 0 {
+		t.Errorf("Expected the fallback to be cleared once the page is ready, got %v", got)
+	}
+}
+
+func TestNextNavigationDelay(t *testing.T) {
+	if got := nextNavigationDelay(navigationRetryBaseDelay); got != 2*navigationRetryBaseDelay {
+		t.Errorf("Expected delay to double, got %v", got)
+	}
+	if got := nextNavigationDelay(45 * time.Second); got != navigationRetryMaxDelay {
+		t.Errorf("Expected delay to be capped at %v, got %v", navigationRetryMaxDelay, got)
+	}
+}
+
+func TestPageLoadErrorMessage(t *testing.T) {
+	err := &PageLoadError{Resource: resourceDocument, URL: "https://dash.example.com/", Status: "502"}
+	if err.Error() != "document https://dash.example.com/ failed to load: 502" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+}
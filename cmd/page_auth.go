@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// PageAuth holds credentials applied to the captured page before it is loaded.
+// Every value is read from a file (e.g. a Docker or Kubernetes secret) so it
+// never has to be passed through the environment, and none of it is ever logged.
+type PageAuth struct {
+	Headers   map[string]string
+	Cookies   []PageCookie
+	BasicAuth *BasicAuthCredentials
+}
+
+// PageCookie is a cookie pre-seeded into Chrome before navigation, parsed from WEBPAGE_COOKIES_FILE.
+type PageCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+}
+
+// BasicAuthCredentials answers HTTP basic-auth challenges raised by the captured page.
+type BasicAuthCredentials struct {
+	Username string
+	Password string
+}
+
+// isEmpty reports whether no page credentials are configured.
+func (a PageAuth) isEmpty() bool {
+	return len(a.Headers) == 0 && len(a.Cookies) == 0 && a.BasicAuth == nil
+}
+
+// loadPageAuth reads extra HTTP headers, cookies and basic-auth credentials from the
+// files referenced by WEBPAGE_HEADERS_FILE, WEBPAGE_COOKIES_FILE and WEBPAGE_BASIC_AUTH_FILE.
+// Unset variables are skipped; unreadable or malformed files are an error.
+func loadPageAuth() (PageAuth, error) {
+	var auth PageAuth
+
+	if path := utils.GetEnvOrDefault("WEBPAGE_HEADERS_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return auth, fmt.Errorf("failed to read WEBPAGE_HEADERS_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, &auth.Headers); err != nil {
+			return auth, fmt.Errorf("failed to parse WEBPAGE_HEADERS_FILE as a JSON object: %w", err)
+		}
+	}
+
+	if path := utils.GetEnvOrDefault("WEBPAGE_COOKIES_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return auth, fmt.Errorf("failed to read WEBPAGE_COOKIES_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, &auth.Cookies); err != nil {
+			return auth, fmt.Errorf("failed to parse WEBPAGE_COOKIES_FILE as a JSON array: %w", err)
+		}
+		for i, c := range auth.Cookies {
+			if c.Name == "" {
+				return auth, fmt.Errorf("cookie %d: name is required", i)
+			}
+			// Chrome needs either a domain or a URL to scope the cookie
+			if c.Domain == "" && c.URL == "" {
+				return auth, fmt.Errorf("cookie %d (%s): domain or url is required", i, c.Name)
+			}
+		}
+	}
+
+	if path := utils.GetEnvOrDefault("WEBPAGE_BASIC_AUTH_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return auth, fmt.Errorf("failed to read WEBPAGE_BASIC_AUTH_FILE: %w", err)
+		}
+		// Only the first line is used so trailing newlines from editors/secret stores are ignored
+		line := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)[0]
+		username, password, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok || username == "" {
+			return auth, fmt.Errorf("WEBPAGE_BASIC_AUTH_FILE must contain credentials in the form username:password")
+		}
+		auth.BasicAuth = &BasicAuthCredentials{Username: username, Password: password}
+	}
+
+	return auth, nil
+}
+
+// pageAuthActions returns the chromedp actions that apply cookies and enable the
+// Fetch interception listenForPageAuth uses to add headers and answer auth
+// challenges. They must run before the first navigation.
+func pageAuthActions(auth PageAuth) chromedp.Tasks {
+	var tasks chromedp.Tasks
+	if auth.isEmpty() {
+		return tasks
+	}
+
+	tasks = append(tasks, network.Enable())
+
+	if len(auth.Cookies) > 0 {
+		cookies := make([]*network.CookieParam, 0, len(auth.Cookies))
+		for _, c := range auth.Cookies {
+			cookies = append(cookies, &network.CookieParam{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				URL:      c.URL,
+				Path:     c.Path,
+				Secure:   c.Secure,
+				HTTPOnly: c.HTTPOnly,
+			})
+		}
+		tasks = append(tasks, network.SetCookies(cookies))
+	}
+
+	// Headers are added per request rather than with network.SetExtraHTTPHeaders,
+	// which would send them to every origin the page loads from. Enabling Fetch
+	// pauses every request, which listenForPageAuth then resumes.
+	if len(auth.Headers) > 0 || auth.BasicAuth != nil {
+		tasks = append(tasks, fetch.Enable().WithHandleAuthRequests(auth.BasicAuth != nil))
+	}
+
+	return tasks
+}
+
+// authChallengeMemory is how long an answered auth challenge is remembered; a
+// rejected answer is challenged again well within it.
+const authChallengeMemory = time.Minute
+
+// listenForPageAuth resumes requests paused by Fetch interception, adding the
+// configured headers to requests for the webpage's origin, and answers basic-auth
+// challenges from that origin with the configured credentials. Challenges from other
+// origins (third-party frames, subresources, proxies) are cancelled so the
+// credentials never leave the webpage. A challenge is only answered once per request
+// so bad credentials cancel instead of looping forever.
+func listenForPageAuth(ctx context.Context, chromeCtx context.Context, auth PageAuth, webpageURL string, display int) {
+	if len(auth.Headers) == 0 && auth.BasicAuth == nil {
+		return
+	}
+	logger := utils.GetLoggerFromContext(ctx)
+	origin := urlOrigin(webpageURL)
+	answered := make(map[fetch.RequestID]time.Time)
+
+	chromedp.ListenTarget(chromeCtx, func(ev any) {
+		switch e := ev.(type) {
+		case *fetch.EventRequestPaused:
+			continueRequest := fetch.ContinueRequest(e.RequestID)
+			if len(auth.Headers) > 0 && urlOrigin(e.Request.URL) == origin {
+				continueRequest = continueRequest.WithHeaders(withPageHeaders(e.Request.Headers, auth.Headers))
+			}
+			go func() {
+				if err := chromedp.Run(chromeCtx, continueRequest); err != nil && chromeCtx.Err() == nil {
+					logger.Debug("Failed to continue paused request", zap.Int("display", display), zap.Error(err))
+				}
+			}()
+		case *fetch.EventAuthRequired:
+			now := time.Now()
+			for id, at := range answered {
+				if now.Sub(at) > authChallengeMemory {
+					delete(answered, id)
+				}
+			}
+
+			response := &fetch.AuthChallengeResponse{
+				Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+				Username: auth.BasicAuth.Username,
+				Password: auth.BasicAuth.Password,
+			}
+			switch {
+			case e.AuthChallenge.Source == fetch.AuthChallengeSourceProxy || urlOrigin(e.AuthChallenge.Origin) != origin:
+				logger.Warn("Refusing basic auth challenge from another origin",
+					zap.Int("display", display), zap.String("origin", e.AuthChallenge.Origin))
+				response = &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseCancelAuth}
+			case !answered[e.RequestID].IsZero():
+				logger.Warn("Basic auth credentials were rejected by the webpage", zap.Int("display", display))
+				response = &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseCancelAuth}
+				delete(answered, e.RequestID)
+			default:
+				answered[e.RequestID] = now
+			}
+			go func() {
+				if err := chromedp.Run(chromeCtx, fetch.ContinueWithAuth(e.RequestID, response)); err != nil && chromeCtx.Err() == nil {
+					logger.Debug("Failed to answer auth challenge", zap.Int("display", display), zap.Error(err))
+				}
+			}()
+		}
+	})
+}
+
+// urlOrigin returns the scheme://host[:port] origin of rawURL, leaving out default
+// ports, or "" if it has none.
+func urlOrigin(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	if port := parsed.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host
+}
+
+// withPageHeaders returns the request's headers with extra added, replacing any
+// header of the same name.
+func withPageHeaders(request network.Headers, extra map[string]string) []*fetch.HeaderEntry {
+	entries := make([]*fetch.HeaderEntry, 0, len(request)+len(extra))
+	for name, value := range request {
+		if _, replaced := lookupHeader(extra, name); replaced {
+			continue
+		}
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+	}
+	for name, value := range extra {
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+	}
+	return entries
+}
+
+// lookupHeader finds name in headers, ignoring case.
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
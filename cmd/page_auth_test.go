@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func writeTestFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return path
+}
+
+func TestLoadPageAuth(t *testing.T) {
+	t.Run("Nothing Configured", func(t *testing.T) {
+		t.Setenv("WEBPAGE_HEADERS_FILE", "")
+		t.Setenv("WEBPAGE_COOKIES_FILE", "")
+		t.Setenv("WEBPAGE_BASIC_AUTH_FILE", "")
+
+		auth, err := loadPageAuth()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !auth.isEmpty() {
+			t.Errorf("Expected empty page auth, got %+v", auth)
+		}
+		if len(pageAuthActions(auth)) != 0 {
+			t.Error("Expected no chromedp actions for empty page auth")
+		}
+	})
+
+	t.Run("Headers, Cookies And Basic Auth", func(t *testing.T) {
+		t.Setenv("WEBPAGE_HEADERS_FILE", writeTestFile(t, "headers.json", `{"Authorization":"Bearer abc123"}`))
+		t.Setenv("WEBPAGE_COOKIES_FILE", writeTestFile(t, "cookies.json", `[{"name":"session","value":"xyz","domain":"dash.example.com","secure":true}]`))
+		t.Setenv("WEBPAGE_BASIC_AUTH_FILE", writeTestFile(t, "basic", "viewer:p@ss:word\n"))
+
+		auth, err := loadPageAuth()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if auth.Headers["Authorization"] != "Bearer abc123" {
+			t.Errorf("Expected Authorization header, got %v", auth.Headers)
+		}
+		if len(auth.Cookies) != 1 || auth.Cookies[0].Name != "session" || !auth.Cookies[0].Secure {
+			t.Errorf("Unexpected cookies: %+v", auth.Cookies)
+		}
+		if auth.BasicAuth == nil || auth.BasicAuth.Username != "viewer" || auth.BasicAuth.Password != "p@ss:word" {
+			t.Errorf("Unexpected basic auth: %+v", auth.BasicAuth)
+		}
+		// network.Enable + cookies + fetch.Enable; headers are added by listenForPageAuth
+		if got := len(pageAuthActions(auth)); got != 3 {
+			t.Errorf("Expected 3 chromedp actions, got %d", got)
+		}
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		t.Setenv("WEBPAGE_HEADERS_FILE", filepath.Join(t.TempDir(), "does-not-exist.json"))
+
+		if _, err := loadPageAuth(); err == nil {
+			t.Fatal("Expected error for missing headers file, got nil")
+		}
+	})
+
+	t.Run("Invalid Headers JSON", func(t *testing.T) {
+		t.Setenv("WEBPAGE_HEADERS_FILE", writeTestFile(t, "headers.json", `["not","an","object"]`))
+
+		if _, err := loadPageAuth(); err == nil {
+			t.Fatal("Expected error for invalid headers JSON, got nil")
+		}
+	})
+
+	t.Run("Cookie Without Domain Or URL", func(t *testing.T) {
+		t.Setenv("WEBPAGE_HEADERS_FILE", "")
+		t.Setenv("WEBPAGE_COOKIES_FILE", writeTestFile(t, "cookies.json", `[{"name":"session","value":"xyz"}]`))
+
+		if _, err := loadPageAuth(); err == nil {
+			t.Fatal("Expected error for cookie without domain, got nil")
+		}
+	})
+
+	t.Run("Malformed Basic Auth", func(t *testing.T) {
+		t.Setenv("WEBPAGE_HEADERS_FILE", "")
+		t.Setenv("WEBPAGE_COOKIES_FILE", "")
+		t.Setenv("WEBPAGE_BASIC_AUTH_FILE", writeTestFile(t, "basic", "no-separator"))
+
+		if _, err := loadPageAuth(); err == nil {
+			t.Fatal("Expected error for malformed basic auth, got nil")
+		}
+	})
+}
+
+func TestURLOrigin(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/page?x=1", "https://example.com"},
+		{"HTTPS://Example.com:443/", "https://example.com"},
+		{"http://example.com:80", "http://example.com"},
+		{"http://example.com:8080/a", "http://example.com:8080"},
+		{"https://[::1]:8443/", "https://[::1]:8443"},
+		{"https://[::1]/", "https://[::1]"},
+		{"not a url", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := urlOrigin(tt.url); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	if urlOrigin("https://example.com/") == urlOrigin("https://example.com.evil.test/") {
+		t.Error("Expected different hosts to have different origins")
+	}
+}
+
+func TestWithPageHeaders(t *testing.T) {
+	entries := withPageHeaders(
+		network.Headers{"Accept": "text/html", "authorization": "old"},
+		map[string]string{"Authorization": "Bearer abc123"},
+	)
+
+	got := make(map[string]string)
+	for _, e := range entries {
+		got[e.Name] = e.Value
+	}
+	want := map[string]string{"Accept": "text/html", "Authorization": "Bearer abc123"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected headers %v, got %v", want, got)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("Expected %s: %q, got %q", name, value, got[name])
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Files Chrome uses to guard a user-data-dir against concurrent use. They are
+// symlinks that point at the old hostname/PID, so after a SIGKILL or a container
+// restart they make Chrome refuse to start with "profile in use".
+var chromeProfileLockFiles = []string{"SingletonLock", "SingletonSocket", "SingletonCookie"}
+
+// chromeProfileDir returns the persistent user-data-dir for an output's Chrome
+// instance, or "" when persistent profiles are disabled. Each canvas is keyed by
+// its display number so every Chrome keeps its own logins and storage.
+func chromeProfileDir(baseDir string, output StreamOutput) string {
+	if baseDir == "" {
+		return ""
+	}
+	return filepath.Join(baseDir, fmt.Sprintf("display-%d", output.Display))
+}
+
+// prepareChromeProfile makes sure the profile directory exists and removes stale
+// lock files left behind by a previous Chrome that didn't shut down cleanly.
+func prepareChromeProfile(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create Chrome profile directory %s: %w", dir, err)
+	}
+	for _, name := range chromeProfileLockFiles {
+		// Lstat so dangling symlinks (the usual case) are still found
+		path := filepath.Join(dir, name)
+		if _, err := os.Lstat(path); err == nil {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChromeProfileDir(t *testing.T) {
+	t.Run("Disabled When No Base Dir", func(t *testing.T) {
+		if dir := chromeProfileDir("", StreamOutput{Display: 100}); dir != "" {
+			t.Errorf("Expected empty profile dir, got %q", dir)
+		}
+	})
+
+	t.Run("Per Display Directory", func(t *testing.T) {
+		dir := chromeProfileDir("/data/profiles", StreamOutput{Display: 101})
+		if dir != "/data/profiles/display-101" {
+			t.Errorf("Expected /data/profiles/display-101, got %q", dir)
+		}
+	})
+}
+
+func TestPrepareChromeProfile(t *testing.T) {
+	t.Run("Creates Missing Directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "profiles", "display-100")
+
+		if err := prepareChromeProfile(dir); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Fatalf("Expected profile directory to exist, got %v", err)
+		}
+	})
+
+	t.Run("Removes Stale Locks And Keeps Profile Data", func(t *testing.T) {
+		dir := t.TempDir()
+		// Chrome's locks are symlinks to a hostname-PID that no longer exists
+		if err := os.Symlink("old-container-12345", filepath.Join(dir, "SingletonLock")); err != nil {
+			t.Fatalf("Failed to create lock symlink: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "SingletonCookie"), []byte("x"), 0o600); err != nil {
+			t.Fatalf("Failed to create cookie file: %v", err)
+		}
+		if err := os.Mkdir(filepath.Join(dir, "Default"), 0o700); err != nil {
+			t.Fatalf("Failed to create profile data: %v", err)
+		}
+
+		if err := prepareChromeProfile(dir); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		for _, name := range chromeProfileLockFiles {
+			if _, err := os.Lstat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be removed", name)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "Default")); err != nil {
+			t.Errorf("Expected profile data to be kept, got %v", err)
+		}
+	})
+}
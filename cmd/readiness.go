@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default time allowed for a readiness condition to be met
+	DefaultReadyTimeout = 30 * time.Second
+	// Settle time used after "body" is visible when no readiness condition is configured
+	legacyReadySettle = 3 * time.Second
+	// How long there must be no more than networkIdleMaxInFlight requests in flight
+	// before the network counts as idle
+	networkIdleQuietPeriod = 500 * time.Millisecond
+	// Requests that may stay in flight on an idle network, like Puppeteer's networkidle2,
+	// so long-polls and streaming fetches don't keep the page from ever being ready
+	networkIdleMaxInFlight = 2
+	// How often readiness predicates are re-evaluated
+	readyPollInterval = 100 * time.Millisecond
+	// Window flag set by the injected listener for event readiness conditions
+	readyEventFlag = "__streamWebpageReady"
+)
+
+// Supported readiness condition types for WEBPAGE_READY_CONDITION
+const (
+	ReadyConditionSelector    = "selector"
+	ReadyConditionJS          = "js"
+	ReadyConditionNetworkIdle = "networkIdle"
+	ReadyConditionEvent       = "event"
+)
+
+// ReadyCondition describes when a loaded page is considered rendered and ready
+// to be captured, parsed from WEBPAGE_READY_CONDITION and WEBPAGE_READY_TIMEOUT.
+type ReadyCondition struct {
+	Type    string
+	Value   string
+	Timeout time.Duration
+}
+
+// String returns the condition in the same form it is configured, for logging.
+func (c ReadyCondition) String() string {
+	if c.Value == "" {
+		return c.Type
+	}
+	return c.Type + ":" + c.Value
+}
+
+// loadReadyCondition parses WEBPAGE_READY_CONDITION ("selector:<css>", "js:<expression>",
+// "networkIdle" or "event:<name>") and WEBPAGE_READY_TIMEOUT (seconds). Returns nil when
+// no condition is configured so the legacy fixed wait is used.
+func loadReadyCondition() (*ReadyCondition, error) {
+	spec := strings.TrimSpace(utils.GetEnvOrDefault("WEBPAGE_READY_CONDITION", ""))
+	if spec == "" {
+		return nil, nil
+	}
+
+	condType, value, _ := strings.Cut(spec, ":")
+	value = strings.TrimSpace(value)
+	cond := &ReadyCondition{Value: value, Timeout: DefaultReadyTimeout}
+
+	switch strings.ToLower(condType) {
+	case strings.ToLower(ReadyConditionSelector):
+		cond.Type = ReadyConditionSelector
+	case strings.ToLower(ReadyConditionJS):
+		cond.Type = ReadyConditionJS
+	case strings.ToLower(ReadyConditionEvent):
+		cond.Type = ReadyConditionEvent
+	case strings.ToLower(ReadyConditionNetworkIdle):
+		cond.Type = ReadyConditionNetworkIdle
+		cond.Value = ""
+	default:
+		return nil, fmt.Errorf("unsupported WEBPAGE_READY_CONDITION type %q", condType)
+	}
+	if cond.Type != ReadyConditionNetworkIdle && cond.Value == "" {
+		return nil, fmt.Errorf("WEBPAGE_READY_CONDITION %q requires a value (e.g. %s:<value>)", cond.Type, cond.Type)
+	}
+
+	if timeoutStr := utils.GetEnvOrDefault("WEBPAGE_READY_TIMEOUT", ""); timeoutStr != "" {
+		seconds, err := strconv.Atoi(timeoutStr)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid WEBPAGE_READY_TIMEOUT %q: must be a positive number of seconds", timeoutStr)
+		}
+		cond.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	return cond, nil
+}
+
+// pageReadiness waits for a page to satisfy its ReadyCondition. Some conditions need
+// hooks installed before navigation, so it is created before Navigate and waited on after.
+type pageReadiness struct {
+	cond *ReadyCondition
+
+	mu           sync.Mutex
+	inFlight     map[network.RequestID]bool
+	lastActivity time.Time
+	// stopTracking removes the network listener once the condition is met
+	stopTracking context.CancelFunc
+}
+
+// newPageReadiness registers any event listeners the condition needs on chromeCtx.
+func newPageReadiness(chromeCtx context.Context, cond *ReadyCondition) *pageReadiness {
+	r := &pageReadiness{
+		cond:         cond,
+		inFlight:     make(map[network.RequestID]bool),
+		lastActivity: time.Now(),
+		stopTracking: func() {},
+	}
+	if cond == nil || cond.Type != ReadyConditionNetworkIdle {
+		return r
+	}
+
+	listenCtx, cancel := context.WithCancel(chromeCtx)
+	r.stopTracking = cancel
+	chromedp.ListenTarget(listenCtx, func(ev any) {
+		switch e := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			// EventSource connections stay open for the life of the page
+			if e.Type == network.ResourceTypeEventSource {
+				return
+			}
+			r.track(e.RequestID, true)
+		case *network.EventLoadingFinished:
+			r.track(e.RequestID, false)
+		case *network.EventLoadingFailed:
+			r.track(e.RequestID, false)
+		}
+	})
+	return r
+}
+
+// track records a request starting or ending. Activity only restarts the quiet period
+// while more than networkIdleMaxInFlight requests are, or just were, in flight.
+func (r *pageReadiness) track(id network.RequestID, started bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !started && !r.inFlight[id] {
+		return
+	}
+	before := len(r.inFlight)
+	if started {
+		r.inFlight[id] = true
+	} else {
+		delete(r.inFlight, id)
+	}
+	if before > networkIdleMaxInFlight || len(r.inFlight) > networkIdleMaxInFlight {
+		r.lastActivity = time.Now()
+	}
+}
+
+// beforeNavigate returns the actions that must run before navigation for the condition to be observable.
+func (r *pageReadiness) beforeNavigate() chromedp.Tasks {
+	if r.cond == nil {
+		return nil
+	}
+	switch r.cond.Type {
+	case ReadyConditionNetworkIdle:
+		return chromedp.Tasks{network.Enable()}
+	case ReadyConditionEvent:
+		name, _ := json.Marshal(r.cond.Value)
+		script := fmt.Sprintf("window.addEventListener(%s, () => { window.%s = true; });", name, readyEventFlag)
+		return chromedp.Tasks{chromedp.ActionFunc(func(ctx context.Context) error {
+			_, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx)
+			return err
+		})}
+	}
+	return nil
+}
+
+// isNetworkIdle reports whether no more than networkIdleMaxInFlight requests have been
+// in flight for the quiet period.
+func (r *pageReadiness) isNetworkIdle(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.inFlight) <= networkIdleMaxInFlight && now.Sub(r.lastActivity) >= networkIdleQuietPeriod
+}
+
+// waitNetworkIdle polls until the network has been idle for the quiet period, then
+// stops tracking requests.
+func (r *pageReadiness) waitNetworkIdle(ctx context.Context) error {
+	defer r.stopTracking()
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	for !r.isNetworkIdle(time.Now()) {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// wait blocks until the condition is met or its timeout expires. With no condition it
+// keeps the legacy behaviour of a fixed settle delay after "body" is visible.
+func (r *pageReadiness) wait(chromeCtx context.Context) error {
+	if r.cond == nil {
+		select {
+		case <-time.After(legacyReadySettle):
+			return nil
+		case <-chromeCtx.Done():
+			return chromeCtx.Err()
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(chromeCtx, r.cond.Timeout)
+	defer cancel()
+
+	var err error
+	switch r.cond.Type {
+	case ReadyConditionSelector:
+		err = chromedp.Run(waitCtx, chromedp.WaitVisible(r.cond.Value, chromedp.ByQuery))
+	case ReadyConditionJS:
+		var res any
+		err = chromedp.Run(waitCtx, chromedp.Poll(r.cond.Value, &res,
+			chromedp.WithPollingInterval(readyPollInterval),
+			chromedp.WithPollingTimeout(r.cond.Timeout)))
+	case ReadyConditionEvent:
+		var res any
+		err = chromedp.Run(waitCtx, chromedp.Poll("window."+readyEventFlag+" === true", &res,
+			chromedp.WithPollingInterval(readyPollInterval),
+			chromedp.WithPollingTimeout(r.cond.Timeout)))
+	case ReadyConditionNetworkIdle:
+		err = r.waitNetworkIdle(waitCtx)
+	}
+
+	if err != nil {
+		return fmt.Errorf("page did not become ready (%s) within %s: %w", r.cond, r.cond.Timeout, err)
+	}
+	return nil
+}
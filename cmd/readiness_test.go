@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestLoadReadyCondition(t *testing.T) {
+	t.Run("Not Configured", func(t *testing.T) {
+		t.Setenv("WEBPAGE_READY_CONDITION", "")
+
+		cond, err := loadReadyCondition()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if cond != nil {
+			t.Errorf("Expected nil condition, got %+v", cond)
+		}
+	})
+
+	tests := []struct {
+		spec          string
+		timeout       string
+		expectedType  string
+		expectedValue string
+		expectedTTL   time.Duration
+	}{
+		{"selector:#overlay.loaded", "", ReadyConditionSelector, "#overlay.loaded", DefaultReadyTimeout},
+		{"js:window.overlay && window.overlay.ready === true", "", ReadyConditionJS, "window.overlay && window.overlay.ready === true", DefaultReadyTimeout},
+		{"networkIdle", "45", ReadyConditionNetworkIdle, "", 45 * time.Second},
+		{"NETWORKIDLE", "", ReadyConditionNetworkIdle, "", DefaultReadyTimeout},
+		{"event:overlay-ready", "10", ReadyConditionEvent, "overlay-ready", 10 * time.Second},
+	}
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			t.Setenv("WEBPAGE_READY_CONDITION", tc.spec)
+			t.Setenv("WEBPAGE_READY_TIMEOUT", tc.timeout)
+
+			cond, err := loadReadyCondition()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if cond.Type != tc.expectedType || cond.Value != tc.expectedValue || cond.Timeout != tc.expectedTTL {
+				t.Errorf("Expected %s/%q/%v, got %s/%q/%v", tc.expectedType, tc.expectedValue, tc.expectedTTL, cond.Type, cond.Value, cond.Timeout)
+			}
+		})
+	}
+
+	invalid := map[string][2]string{
+		"unknown type":     {"xpath://div", ""},
+		"missing selector": {"selector:", ""},
+		"missing event":    {"event", ""},
+		"bad timeout":      {"networkIdle", "soon"},
+		"zero timeout":     {"networkIdle", "0"},
+	}
+	for name, env := range invalid {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("WEBPAGE_READY_CONDITION", env[0])
+			t.Setenv("WEBPAGE_READY_TIMEOUT", env[1])
+			if _, err := loadReadyCondition(); err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestPageReadinessNetworkIdle(t *testing.T) {
+	r := &pageReadiness{
+		cond:         &ReadyCondition{Type: ReadyConditionNetworkIdle, Timeout: time.Second},
+		inFlight:     make(map[network.RequestID]bool),
+		lastActivity: time.Now(),
+		stopTracking: func() {},
+	}
+	for _, id := range []network.RequestID{"1", "2", "3"} {
+		r.track(id, true)
+	}
+
+	if r.isNetworkIdle(time.Now().Add(time.Hour)) {
+		t.Error("Expected network to be busy while more than the allowed requests are in flight")
+	}
+
+	r.track("1", false)
+	if r.isNetworkIdle(r.lastActivity.Add(networkIdleQuietPeriod / 2)) {
+		t.Error("Expected network to be busy during the quiet period")
+	}
+	if !r.isNetworkIdle(r.lastActivity.Add(networkIdleQuietPeriod)) {
+		t.Error("Expected network to be idle with long-lived requests still in flight")
+	}
+
+	settled := r.lastActivity
+	r.track("2", false)
+	r.track("4", true)
+	if r.lastActivity != settled {
+		t.Error("Expected requests within the allowed in-flight count not to restart the quiet period")
+	}
+
+	stopped := false
+	r.stopTracking = func() { stopped = true }
+	if err := r.waitNetworkIdle(context.Background()); err != nil {
+		t.Fatalf("Expected network to be idle, got %v", err)
+	}
+	if !stopped {
+		t.Error("Expected request tracking to stop once the network is idle")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.track("5", true)
+	r.track("6", true)
+	if err := r.waitNetworkIdle(ctx); err == nil {
+		t.Error("Expected waitNetworkIdle to return the context error")
+	}
+}
+
+func TestPageReadinessLegacyWait(t *testing.T) {
+	r := &pageReadiness{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := r.wait(ctx); err == nil {
+		t.Error("Expected cancelled context to abort the legacy settle delay")
+	}
+	if len(r.beforeNavigate()) != 0 {
+		t.Error("Expected no pre-navigation actions without a condition")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+
+	"go.uber.org/zap"
+)
+
+// displayLauncher starts the virtual display a canvas is drawn on.
+type displayLauncher interface {
+	startDisplay(ctx context.Context, output StreamOutput) (displayProcess, error)
+}
+
+// displayProcess is one running display server process.
+type displayProcess interface {
+	// kill terminates the process; exited is closed once it is gone
+	kill()
+	exited() <-chan struct{}
+}
+
+// browserLauncher starts the browser that renders a canvas, and recreates it when
+// the display under it was replaced.
+type browserLauncher interface {
+	startBrowser(ctx context.Context, config *Config, output StreamOutput, isPrimary bool) (*chromeInstance, error)
+	recreateBrowser(ctx context.Context, config *Config, output StreamOutput, isPrimary bool, instance *chromeInstance) error
+}
+
+// encoderLauncher starts the encoder that captures the displays and publishes the stream.
+type encoderLauncher interface {
+	startEncoder(ctx context.Context, config *Config, frames *frameMonitor, audio *audioMonitor) (encoder, error)
+}
+
+// encoder is one running encoder process.
+type encoder interface {
+	// wait blocks until the encoder exits and returns its exit error
+	wait() error
+	// shutdown stops the encoder and returns once it exited
+	shutdown(logger *zap.Logger)
+}
+
+// pipelineRunner bundles the launchers a stream is built from. Production uses
+// defaultRunner; tests swap in fakes so the pipeline runs without Xvfb, Chrome or FFmpeg.
+type pipelineRunner struct {
+	displays displayLauncher
+	browsers browserLauncher
+	encoders encoderLauncher
+}
+
+var defaultRunner = pipelineRunner{
+	displays: xvfbLauncher{},
+	browsers: chromeLauncher{},
+	encoders: ffmpegLauncher{},
+}
+
+// xvfbLauncher runs Xvfb.
+type xvfbLauncher struct{}
+
+func (xvfbLauncher) startDisplay(ctx context.Context, output StreamOutput) (displayProcess, error) {
+	cmd, err := startXvfb(ctx, output)
+	if err != nil {
+		return nil, err
+	}
+	return newExecProcess(cmd), nil
+}
+
+// execProcess adapts a started exec.Cmd to displayProcess, reaping it in the background.
+type execProcess struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+func newExecProcess(cmd *exec.Cmd) *execProcess {
+	p := &execProcess{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		_ = cmd.Wait()
+		close(p.done)
+	}()
+	return p
+}
+
+func (p *execProcess) kill() {
+	if p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+}
+
+func (p *execProcess) exited() <-chan struct{} {
+	return p.done
+}
+
+// chromeLauncher runs Chrome through chromedp.
+type chromeLauncher struct{}
+
+func (chromeLauncher) startBrowser(ctx context.Context, config *Config, output StreamOutput, isPrimary bool) (*chromeInstance, error) {
+	return startChrome(ctx, config, output, isPrimary)
+}
+
+func (chromeLauncher) recreateBrowser(ctx context.Context, config *Config, output StreamOutput, isPrimary bool, instance *chromeInstance) error {
+	return recreateChrome(ctx, config, output, isPrimary, instance)
+}
+
+// ffmpegLauncher runs FFmpeg; its startEncoder builds the command line in main.go.
+type ffmpegLauncher struct{}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// pipelineEvents records what the fake launchers were asked to do, in order.
+type pipelineEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *pipelineEvents) add(format string, args ...any) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, fmt.Sprintf(format, args...))
+}
+
+func (e *pipelineEvents) list() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.events...)
+}
+
+func (e *pipelineEvents) count(event string) int {
+	n := 0
+	for _, got := range e.list() {
+		if got == event {
+			n++
+		}
+	}
+	return n
+}
+
+// since returns the events recorded after the first n.
+func (e *pipelineEvents) since(n int) []string {
+	return e.list()[n:]
+}
+
+// fakeDisplayLauncher hands out display processes that run until killed.
+type fakeDisplayLauncher struct {
+	events *pipelineEvents
+	err    error
+
+	mu        sync.Mutex
+	processes map[int]*fakeDisplayProcess
+}
+
+func (l *fakeDisplayLauncher) startDisplay(ctx context.Context, output StreamOutput) (displayProcess, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	p := &fakeDisplayProcess{display: output.Display, events: l.events, done: make(chan struct{})}
+	l.mu.Lock()
+	if l.processes == nil {
+		l.processes = make(map[int]*fakeDisplayProcess)
+	}
+	l.processes[output.Display] = p
+	l.mu.Unlock()
+	l.events.add("display start :%d", output.Display)
+	return p, nil
+}
+
+// process returns the latest process started for display.
+func (l *fakeDisplayLauncher) process(display int) *fakeDisplayProcess {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.processes[display]
+}
+
+type fakeDisplayProcess struct {
+	display int
+	events  *pipelineEvents
+	once    sync.Once
+	done    chan struct{}
+}
+
+func (p *fakeDisplayProcess) kill() {
+	p.once.Do(func() {
+		p.events.add("display kill :%d", p.display)
+		close(p.done)
+	})
+}
+
+func (p *fakeDisplayProcess) exited() <-chan struct{} {
+	return p.done
+}
+
+// fakeBrowserLauncher hands out browsers backed by plain contexts; failDisplay makes
+// starting the browser for that display fail.
+type fakeBrowserLauncher struct {
+	events      *pipelineEvents
+	failDisplay int
+}
+
+func (l *fakeBrowserLauncher) newBrowser(display int) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return ctx, func() {
+		cancel()
+		l.events.add("browser stop :%d", display)
+	}
+}
+
+func (l *fakeBrowserLauncher) startBrowser(ctx context.Context, config *Config, output StreamOutput, isPrimary bool) (*chromeInstance, error) {
+	if output.Display == l.failDisplay {
+		return nil, errors.New("browser crashed on launch")
+	}
+	l.events.add("browser start :%d primary=%v", output.Display, isPrimary)
+	return newChromeInstance(l.newBrowser(output.Display)), nil
+}
+
+func (l *fakeBrowserLauncher) recreateBrowser(ctx context.Context, config *Config, output StreamOutput, isPrimary bool, instance *chromeInstance) error {
+	l.events.add("browser recreate :%d", output.Display)
+	instance.replace(l.newBrowser(output.Display))
+	return nil
+}
+
+// fakeEncoderLauncher hands out encoders that run until shut down or crashed, and
+// publishes each one on started.
+type fakeEncoderLauncher struct {
+	events  *pipelineEvents
+	started chan *fakeEncoder
+}
+
+func (l *fakeEncoderLauncher) startEncoder(ctx context.Context, config *Config, frames *frameMonitor, audio *audioMonitor) (encoder, error) {
+	e := &fakeEncoder{events: l.events, exit: make(chan error, 1)}
+	l.events.add("encoder start")
+	l.started <- e
+	return e, nil
+}
+
+type fakeEncoder struct {
+	events *pipelineEvents
+	exit   chan error
+}
+
+func (e *fakeEncoder) wait() error {
+	return <-e.exit
+}
+
+// crash makes the encoder exit on its own with err.
+func (e *fakeEncoder) crash(err error) {
+	select {
+	case e.exit <- err:
+	default:
+	}
+}
+
+func (e *fakeEncoder) shutdown(logger *zap.Logger) {
+	e.events.add("encoder shutdown")
+	e.crash(nil)
+}
+
+// fakePipeline is a runner built from fakes sharing one event log.
+type fakePipeline struct {
+	events   *pipelineEvents
+	displays *fakeDisplayLauncher
+	browsers *fakeBrowserLauncher
+	encoders *fakeEncoderLauncher
+}
+
+func newFakePipeline() *fakePipeline {
+	events := &pipelineEvents{}
+	return &fakePipeline{
+		events:   events,
+		displays: &fakeDisplayLauncher{events: events},
+		browsers: &fakeBrowserLauncher{events: events},
+		encoders: &fakeEncoderLauncher{events: events, started: make(chan *fakeEncoder, 10)},
+	}
+}
+
+func (p *fakePipeline) runner() pipelineRunner {
+	return pipelineRunner{displays: p.displays, browsers: p.browsers, encoders: p.encoders}
+}
+
+// start runs the pipeline in the background; the returned channel yields its result.
+func (p *fakePipeline) start(ctx context.Context, config *Config) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- runPipeline(ctx, config, p.runner()) }()
+	return result
+}
+
+func (p *fakePipeline) nextEncoder(t *testing.T) *fakeEncoder {
+	t.Helper()
+	select {
+	case e := <-p.encoders.started:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an encoder to be started")
+		return nil
+	}
+}
+
+func waitForResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the pipeline to return")
+		return nil
+	}
+}
+
+func waitForCondition(t *testing.T, message string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func expectEvents(t *testing.T, expected, got []string) {
+	t.Helper()
+	if strings.Join(expected, "\n") != strings.Join(got, "\n") {
+		t.Errorf("Expected events:\n  %s\ngot:\n  %s", strings.Join(expected, "\n  "), strings.Join(got, "\n  "))
+	}
+}
+
+// testPipelineConfig has two canvases, the first with a scaled secondary track.
+func testPipelineConfig() *Config {
+	return &Config{
+		WebpageURL:           "https://example.com",
+		RTMPURL:              "rtmp://example.com/live/stream",
+		ComponentMaxRestarts: 5,
+		Outputs: []StreamOutput{
+			{Width: 1920, Height: 1080, Framerate: 30, Name: "landscape", Display: 99},
+			{Width: 1280, Height: 720, Framerate: 30, Name: "landscape-720p", Display: 99, SourceDisplay: 99},
+			{Width: 720, Height: 1280, Framerate: 30, Name: "portrait", Display: 100},
+		},
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	t.Run("Starts Components And Tears Down In Order", func(t *testing.T) {
+		t.Cleanup(resetGlobalStreamState)
+		pipeline := newFakePipeline()
+		result := pipeline.start(ctx, testPipelineConfig())
+		pipeline.nextEncoder(t)
+
+		expectEvents(t, []string{
+			"display start :99",
+			"browser start :99 primary=true",
+			"display start :100",
+			"browser start :100 primary=false",
+			"encoder start",
+		}, pipeline.events.list())
+		if !IsStreamRunning() {
+			t.Error("Expected stream to be marked running")
+		}
+
+		started := len(pipeline.events.list())
+		StopCurrentStream(ctx)
+		if err := waitForResult(t, result); err != nil {
+			t.Errorf("Expected no error after a deliberate stop, got %v", err)
+		}
+		expectEvents(t, []string{
+			"encoder shutdown",
+			"browser stop :99",
+			"browser stop :100",
+			"display kill :99",
+			"display kill :100",
+		}, pipeline.events.since(started))
+		if IsStreamRunning() {
+			t.Error("Expected stream to be marked stopped")
+		}
+	})
+
+	t.Run("Encoder Exit Restarts Only The Encoder", func(t *testing.T) {
+		t.Cleanup(resetGlobalStreamState)
+		pipeline := newFakePipeline()
+		result := pipeline.start(ctx, testPipelineConfig())
+
+		pipeline.nextEncoder(t).crash(errors.New("connection reset"))
+		pipeline.nextEncoder(t)
+
+		if n := pipeline.events.count("display start :99"); n != 1 {
+			t.Errorf("Expected the display to keep running, started %d times", n)
+		}
+		if n := pipeline.events.count("browser start :99 primary=true"); n != 1 {
+			t.Errorf("Expected the browser to keep running, started %d times", n)
+		}
+		if n := pipeline.events.count("browser stop :99"); n != 0 {
+			t.Errorf("Expected the browser not to be stopped, stopped %d times", n)
+		}
+
+		StopCurrentStream(ctx)
+		if err := waitForResult(t, result); err != nil {
+			t.Errorf("Expected no error after a deliberate stop, got %v", err)
+		}
+	})
+
+	t.Run("Encoder Over Budget Fails Pipeline", func(t *testing.T) {
+		t.Cleanup(resetGlobalStreamState)
+		pipeline := newFakePipeline()
+		config := testPipelineConfig()
+		config.ComponentMaxRestarts = 1
+		result := pipeline.start(ctx, config)
+
+		pipeline.nextEncoder(t).crash(errors.New("connection reset"))
+		pipeline.nextEncoder(t).crash(errors.New("connection reset"))
+
+		err := waitForResult(t, result)
+		if err == nil || !strings.Contains(err.Error(), "ffmpeg exited more than 1 times") {
+			t.Errorf("Expected the restart budget error, got %v", err)
+		}
+		for _, event := range []string{"browser stop :99", "browser stop :100", "display kill :99", "display kill :100"} {
+			if pipeline.events.count(event) != 1 {
+				t.Errorf("Expected %q once the pipeline gave up, got events %v", event, pipeline.events.list())
+			}
+		}
+	})
+
+	t.Run("Display Exit Restarts Display And Recreates Browser", func(t *testing.T) {
+		t.Cleanup(resetGlobalStreamState)
+		pipeline := newFakePipeline()
+		result := pipeline.start(ctx, testPipelineConfig())
+		pipeline.nextEncoder(t)
+
+		// Simulate Xvfb crashing
+		pipeline.displays.process(100).kill()
+		waitForCondition(t, "Expected the browser to be recreated", func() bool {
+			return pipeline.events.count("browser recreate :100") == 1
+		})
+
+		if n := pipeline.events.count("display start :100"); n != 2 {
+			t.Errorf("Expected the display to be restarted once, started %d times", n)
+		}
+		if n := pipeline.events.count("display start :99"); n != 1 {
+			t.Errorf("Expected the other display to keep running, started %d times", n)
+		}
+		if n := pipeline.events.count("encoder start"); n != 1 {
+			t.Errorf("Expected the encoder to keep running, started %d times", n)
+		}
+
+		StopCurrentStream(ctx)
+		if err := waitForResult(t, result); err != nil {
+			t.Errorf("Expected no error after a deliberate stop, got %v", err)
+		}
+		if n := pipeline.events.count("display kill :100"); n != 2 {
+			t.Errorf("Expected the restarted display to be killed on stop, killed %d times", n)
+		}
+	})
+
+	t.Run("Browser Failure Cleans Up Started Components", func(t *testing.T) {
+		t.Cleanup(resetGlobalStreamState)
+		pipeline := newFakePipeline()
+		pipeline.browsers.failDisplay = 100
+
+		err := waitForResult(t, pipeline.start(ctx, testPipelineConfig()))
+		if err == nil || !strings.Contains(err.Error(), "failed to start Chrome") {
+			t.Errorf("Expected a Chrome start error, got %v", err)
+		}
+		expectEvents(t, []string{
+			"display start :99",
+			"browser start :99 primary=true",
+			"display start :100",
+			"browser stop :99",
+			"display kill :99",
+			"display kill :100",
+		}, pipeline.events.list())
+		if IsStreamRunning() {
+			t.Error("Expected stream not to be marked running")
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default seconds to wait before the first restart after a failure
+	DefaultRestartBackoffInitial = 5
+	// Default upper bound, in seconds, for the delay between restarts
+	DefaultRestartBackoffMax = 300
+	// Default number of failures within the window that trips the circuit breaker
+	DefaultRestartMaxFailures = 10
+	// Default seconds over which failures are counted for the circuit breaker
+	DefaultRestartFailureWindow = 600
+	// Default seconds a run must last to count as stable and reset the backoff
+	DefaultRestartStablePeriod = 300
+	// Default seconds to wait in the failed state before trying again
+	DefaultRestartCooldown = 900
+)
+
+// Supervisor states reported on the health endpoint
+const (
+	SupervisorStateStarting = "starting"
+	SupervisorStateRunning  = "running"
+	SupervisorStateBackoff  = "backoff"
+	SupervisorStateFailed   = "failed"
+)
+
+// RestartPolicy controls how the main loop restarts a stream that ended with an error.
+type RestartPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	MaxFailures    int
+	FailureWindow  time.Duration
+	StablePeriod   time.Duration
+	Cooldown       time.Duration
+}
+
+// loadRestartPolicy reads the RESTART_* environment variables.
+func loadRestartPolicy(ctx context.Context) RestartPolicy {
+	policy := RestartPolicy{
+		InitialBackoff: utils.GetSecondsFromEnv(ctx, "RESTART_BACKOFF_INITIAL", DefaultRestartBackoffInitial),
+		MaxBackoff:     utils.GetSecondsFromEnv(ctx, "RESTART_BACKOFF_MAX", DefaultRestartBackoffMax),
+		MaxFailures:    DefaultRestartMaxFailures,
+		FailureWindow:  utils.GetSecondsFromEnv(ctx, "RESTART_FAILURE_WINDOW", DefaultRestartFailureWindow),
+		StablePeriod:   utils.GetSecondsFromEnv(ctx, "RESTART_STABLE_PERIOD", DefaultRestartStablePeriod),
+		Cooldown:       utils.GetSecondsFromEnv(ctx, "RESTART_COOLDOWN", DefaultRestartCooldown),
+	}
+	if maxStr := utils.GetEnvOrDefault("RESTART_MAX_FAILURES", ""); maxStr != "" {
+		maxFailures, err := strconv.Atoi(maxStr)
+		if err != nil || maxFailures < 0 {
+			utils.GetLoggerFromContext(ctx).Warn("Invalid RESTART_MAX_FAILURES value, using default",
+				zap.String("invalidValue", maxStr), zap.Int("default", DefaultRestartMaxFailures))
+		} else {
+			policy.MaxFailures = maxFailures
+		}
+	}
+	if policy.MaxBackoff < policy.InitialBackoff {
+		policy.MaxBackoff = policy.InitialBackoff
+	}
+	return policy
+}
+
+// restartSupervisor decides how long the main loop waits before restarting the stream.
+// Failures back off exponentially with jitter; too many failures within the window
+// trip a circuit breaker that marks the service failed and waits out a cooldown.
+// A run lasting the stable period resets everything.
+type restartSupervisor struct {
+	policy RestartPolicy
+	// now and jitter are replaceable in tests
+	now    func() time.Time
+	jitter func(max time.Duration) time.Duration
+
+	mu        sync.Mutex
+	state     string
+	backoff   time.Duration
+	failures  []time.Time
+	running   bool
+	runStart  time.Time
+	lastError string
+}
+
+func newRestartSupervisor(policy RestartPolicy) *restartSupervisor {
+	return &restartSupervisor{
+		policy:  policy,
+		now:     time.Now,
+		jitter:  func(max time.Duration) time.Duration { return rand.N(max + 1) },
+		state:   SupervisorStateStarting,
+		backoff: policy.InitialBackoff,
+	}
+}
+
+// runStarted records that a stream attempt is starting. A tripped breaker stays
+// reported as failed until a run proves stable.
+func (s *restartSupervisor) runStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = true
+	s.runStart = s.now()
+	if s.state != SupervisorStateFailed {
+		s.state = SupervisorStateRunning
+	}
+	circuitOpen.Set(0)
+}
+
+// runEnded records how an attempt ended and returns how long to wait before the next.
+// A nil error is a deliberate restart (e.g. RestartStream) and restarts immediately.
+func (s *restartSupervisor) runEnded(err error) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.resetIfStable(now)
+	s.running = false
+
+	if err == nil {
+		return 0
+	}
+
+	restartFailuresTotal.Inc()
+	s.lastError = err.Error()
+
+	// Forget failures that fell out of the window
+	kept := s.failures[:0]
+	for _, t := range s.failures {
+		if now.Sub(t) < s.policy.FailureWindow {
+			kept = append(kept, t)
+		}
+	}
+	s.failures = append(kept, now)
+
+	if s.policy.MaxFailures > 0 && len(s.failures) >= s.policy.MaxFailures {
+		s.state = SupervisorStateFailed
+		s.failures = nil
+		s.backoff = s.policy.InitialBackoff
+		circuitOpen.Set(1)
+		return s.policy.Cooldown
+	}
+
+	// Equal jitter: wait between half and all of the current backoff
+	delay := s.backoff/2 + s.jitter(s.backoff-s.backoff/2)
+	s.backoff = min(s.backoff*2, s.policy.MaxBackoff)
+	if s.state != SupervisorStateFailed {
+		s.state = SupervisorStateBackoff
+	}
+	return delay
+}
+
+// resetIfStable forgets earlier failures once the current run has lasted the stable
+// period, clearing a tripped breaker. Must be called with mu held.
+func (s *restartSupervisor) resetIfStable(now time.Time) {
+	if !s.running || now.Sub(s.runStart) < s.policy.StablePeriod {
+		return
+	}
+	s.failures = nil
+	s.backoff = s.policy.InitialBackoff
+	s.lastError = ""
+	s.state = SupervisorStateRunning
+}
+
+// status returns the current state and the last error, if any.
+func (s *restartSupervisor) status() (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetIfStable(s.now())
+	return s.state, s.lastError
+}
+
+// waitForRestart sleeps for delay, returning false if ctx is cancelled first.
+func waitForRestart(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
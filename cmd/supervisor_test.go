@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// testRestartSupervisor returns a supervisor on a fake clock with jitter disabled
+// (always the upper bound), plus a function to advance the clock.
+func testRestartSupervisor(policy RestartPolicy) (*restartSupervisor, func(time.Duration)) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newRestartSupervisor(policy)
+	s.now = func() time.Time { return now }
+	s.jitter = func(max time.Duration) time.Duration { return max }
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+var testRestartPolicy = RestartPolicy{
+	InitialBackoff: 5 * time.Second,
+	MaxBackoff:     30 * time.Second,
+	MaxFailures:    4,
+	FailureWindow:  10 * time.Minute,
+	StablePeriod:   5 * time.Minute,
+	Cooldown:       15 * time.Minute,
+}
+
+func TestLoadRestartPolicy(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := utils.SaveLoggerToContext(context.Background(), logger)
+
+	t.Run("Defaults", func(t *testing.T) {
+		for _, key := range []string{"RESTART_BACKOFF_INITIAL", "RESTART_BACKOFF_MAX", "RESTART_MAX_FAILURES", "RESTART_FAILURE_WINDOW", "RESTART_STABLE_PERIOD", "RESTART_COOLDOWN"} {
+			t.Setenv(key, "")
+		}
+		policy := loadRestartPolicy(ctx)
+		expected := RestartPolicy{
+			InitialBackoff: 5 * time.Second,
+			MaxBackoff:     300 * time.Second,
+			MaxFailures:    10,
+			FailureWindow:  600 * time.Second,
+			StablePeriod:   300 * time.Second,
+			Cooldown:       900 * time.Second,
+		}
+		if policy != expected {
+			t.Errorf("Expected %+v, got %+v", expected, policy)
+		}
+	})
+
+	t.Run("Max Backoff Never Below Initial", func(t *testing.T) {
+		t.Setenv("RESTART_BACKOFF_INITIAL", "60")
+		t.Setenv("RESTART_BACKOFF_MAX", "10")
+		t.Setenv("RESTART_MAX_FAILURES", "invalid")
+		policy := loadRestartPolicy(ctx)
+		if policy.MaxBackoff != 60*time.Second {
+			t.Errorf("Expected max backoff raised to 60s, got %v", policy.MaxBackoff)
+		}
+		if policy.MaxFailures != DefaultRestartMaxFailures {
+			t.Errorf("Expected default max failures for invalid value, got %d", policy.MaxFailures)
+		}
+	})
+}
+
+func TestRestartSupervisor(t *testing.T) {
+	failure := errors.New("ffmpeg exited")
+
+	t.Run("Backoff Doubles Up To Max", func(t *testing.T) {
+		policy := testRestartPolicy
+		policy.MaxFailures = 0
+		s, advance := testRestartSupervisor(policy)
+
+		var delays []time.Duration
+		for i := 0; i < 5; i++ {
+			s.runStarted()
+			advance(time.Second)
+			delays = append(delays, s.runEnded(failure))
+		}
+		expected := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second}
+		for i := range expected {
+			if delays[i] != expected[i] {
+				t.Errorf("Attempt %d: expected delay %v, got %v", i+1, expected[i], delays[i])
+			}
+		}
+		if state, lastError := s.status(); state != SupervisorStateBackoff || lastError != "ffmpeg exited" {
+			t.Errorf("Expected backoff state with last error, got %q %q", state, lastError)
+		}
+	})
+
+	t.Run("Jitter Stays Within Half Of Backoff", func(t *testing.T) {
+		s := newRestartSupervisor(testRestartPolicy)
+		for i := 0; i < 20; i++ {
+			s.backoff = 10 * time.Second
+			s.failures = nil
+			s.runStarted()
+			if delay := s.runEnded(failure); delay < 5*time.Second || delay > 10*time.Second {
+				t.Fatalf("Expected delay between 5s and 10s, got %v", delay)
+			}
+		}
+	})
+
+	t.Run("Deliberate Restart Is Immediate", func(t *testing.T) {
+		s, _ := testRestartSupervisor(testRestartPolicy)
+		s.runStarted()
+		if delay := s.runEnded(nil); delay != 0 {
+			t.Errorf("Expected no delay after a deliberate restart, got %v", delay)
+		}
+	})
+
+	t.Run("Circuit Breaker Trips And Recovers After Stable Run", func(t *testing.T) {
+		s, advance := testRestartSupervisor(testRestartPolicy)
+
+		var delay time.Duration
+		for i := 0; i < testRestartPolicy.MaxFailures; i++ {
+			s.runStarted()
+			advance(time.Second)
+			delay = s.runEnded(failure)
+		}
+		if delay != testRestartPolicy.Cooldown {
+			t.Errorf("Expected cooldown delay once the breaker trips, got %v", delay)
+		}
+		if state, _ := s.status(); state != SupervisorStateFailed {
+			t.Fatalf("Expected failed state, got %q", state)
+		}
+
+		// Still failed while the next attempt hasn't proven stable
+		s.runStarted()
+		advance(time.Minute)
+		if state, _ := s.status(); state != SupervisorStateFailed {
+			t.Errorf("Expected failed state during an unproven run, got %q", state)
+		}
+
+		advance(testRestartPolicy.StablePeriod)
+		if state, lastError := s.status(); state != SupervisorStateRunning || lastError != "" {
+			t.Errorf("Expected running state after a stable run, got %q %q", state, lastError)
+		}
+		if delay := s.runEnded(failure); delay != testRestartPolicy.InitialBackoff {
+			t.Errorf("Expected backoff reset after a stable run, got %v", delay)
+		}
+	})
+
+	t.Run("Failures Outside Window Are Forgotten", func(t *testing.T) {
+		s, advance := testRestartSupervisor(testRestartPolicy)
+		for i := 0; i < 10; i++ {
+			s.runStarted()
+			advance(testRestartPolicy.FailureWindow / 2)
+			s.runEnded(failure)
+		}
+		if state, _ := s.status(); state == SupervisorStateFailed {
+			t.Error("Expected breaker to stay closed when failures are spread out")
+		}
+	})
+}
+
+func TestGetHealthResponseFailed(t *testing.T) {
+	original := globalRestartSupervisor
+	defer func() { globalRestartSupervisor = original }()
+
+	policy := testRestartPolicy
+	policy.MaxFailures = 1
+	globalRestartSupervisor, _ = testRestartSupervisor(policy)
+	globalRestartSupervisor.runStarted()
+	globalRestartSupervisor.runEnded(errors.New("ingest unreachable"))
+
+	w := httptest.NewRecorder()
+	getHealthResponse(w, httptest.NewRequest("GET", "/health", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code 503, got %d", w.Code)
+	}
+	var health Health
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Failed to unmarshal health response: %v", err)
+	}
+	if health.State != SupervisorStateFailed || health.LastError != "ingest unreachable" {
+		t.Errorf("Expected failed state with last error, got %+v", health)
+	}
+}
+
+func TestWaitForRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if !waitForRestart(ctx, 0) {
+		t.Error("Expected immediate restart without delay")
+	}
+	cancel()
+	if waitForRestart(ctx, time.Hour) {
+		t.Error("Expected cancelled context to abort the wait")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/inspector"
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Default seconds between JS heartbeats sent to each page
+	DefaultChromeHeartbeatInterval = 10
+	// Default seconds a heartbeat may take before the page counts as hung
+	DefaultChromeHeartbeatTimeout = 5
+	// How long a reload may take before recovery falls back to recreating Chrome
+	chromeReloadTimeout = 30 * time.Second
+)
+
+// Reasons and actions recorded on the chrome recovery metric
+const (
+	chromeFailureCrash = "crash"
+	chromeFailureHang  = "hang"
+
+	chromeRecoveryReload   = "reload"
+	chromeRecoveryRecreate = "recreate"
+)
+
+// chromeInstance tracks the browser currently serving a display. The watchdog can
+// swap in a recreated browser, so callers must always go through context().
+type chromeInstance struct {
+	mu        sync.Mutex
+	chromeCtx context.Context
+	cancel    context.CancelFunc
+	stopped   bool
+	// network watches every browser created for this display for failed page loads
+	network *networkMonitor
+}
+
+func newChromeInstance(chromeCtx context.Context, cancel context.CancelFunc) *chromeInstance {
+	return &chromeInstance{chromeCtx: chromeCtx, cancel: cancel}
+}
+
+// context returns the chromedp context of the current browser.
+func (c *chromeInstance) context() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chromeCtx
+}
+
+// replace swaps in a new browser and closes the old one. If the instance was stopped
+// in the meantime the new browser is closed instead and false is returned.
+func (c *chromeInstance) replace(chromeCtx context.Context, cancel context.CancelFunc) bool {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		cancel()
+		return false
+	}
+	old := c.cancel
+	c.chromeCtx = chromeCtx
+	c.cancel = cancel
+	c.mu.Unlock()
+
+	if old != nil {
+		old()
+	}
+	return true
+}
+
+// closeCurrent closes the current browser without stopping the instance, so a
+// replacement can still be swapped in. The stale context stays in place and any
+// action run against it fails fast until then.
+func (c *chromeInstance) closeCurrent() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.cancel = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// isStopped reports whether stop has been called.
+func (c *chromeInstance) isStopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stopped
+}
+
+// stop closes the current browser; it is safe to call more than once.
+func (c *chromeInstance) stop() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.stopped = true
+	c.cancel = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// chromeHeartbeat evaluates a trivial expression in the page. A crashed or hung
+// renderer can't answer, so this fails with the timeout.
+func chromeHeartbeat(chromeCtx context.Context, timeout time.Duration) error {
+	hbCtx, cancel := context.WithTimeout(chromeCtx, timeout)
+	defer cancel()
+	var res int
+	return chromedp.Run(hbCtx, chromedp.Evaluate("1", &res))
+}
+
+// watchChrome monitors a Chrome instance for renderer crashes (Inspector.targetCrashed)
+// and hangs (missed JS heartbeats). On failure it first reloads the page and, if the
+// page still doesn't respond, recreates just this browser on the same Xvfb display so
+// FFmpeg keeps capturing without a full pipeline restart. Runs until ctx is cancelled
+// or the instance is stopped. CHROME_HEARTBEAT_INTERVAL=0 disables the watchdog.
+func watchChrome(ctx context.Context, config *Config, output StreamOutput, isPrimary bool, instance *chromeInstance) {
+	logger := utils.GetLoggerFromContext(ctx)
+	interval := utils.GetSecondsFromEnv(ctx, "CHROME_HEARTBEAT_INTERVAL", DefaultChromeHeartbeatInterval)
+	timeout := utils.GetSecondsFromEnv(ctx, "CHROME_HEARTBEAT_TIMEOUT", DefaultChromeHeartbeatTimeout)
+	if interval == 0 {
+		logger.Debug("Chrome watchdog disabled", zap.Int("display", output.Display))
+		return
+	}
+	if timeout == 0 || timeout > interval {
+		timeout = interval
+	}
+	display := strconv.Itoa(output.Display)
+
+	crashed := make(chan struct{}, 1)
+	listenForCrash := func(chromeCtx context.Context) {
+		chromedp.ListenTarget(chromeCtx, func(ev any) {
+			if _, ok := ev.(*inspector.EventTargetCrashed); ok {
+				select {
+				case crashed <- struct{}{}:
+				default:
+				}
+			}
+		})
+	}
+	// The browser being watched; it changes when recreated here or after an Xvfb restart
+	watched := instance.context()
+	listenForCrash(watched)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var reason string
+		select {
+		case <-ctx.Done():
+			return
+		case <-crashed:
+			reason = chromeFailureCrash
+		case <-ticker.C:
+			if current := instance.context(); current != watched {
+				watched = current
+				listenForCrash(watched)
+			}
+			if err := chromeHeartbeat(instance.context(), timeout); err != nil {
+				reason = chromeFailureHang
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		if ctx.Err() != nil || instance.isStopped() {
+			return
+		}
+
+		chromeFailuresTotal.WithLabelValues(display, reason).Inc()
+		logger.Warn("Chrome page is unresponsive, attempting recovery",
+			zap.Int("display", output.Display),
+			zap.String("reason", reason))
+
+		if err := recoverChrome(ctx, config, output, isPrimary, instance, timeout); err != nil {
+			// Leave the rest of the pipeline running; the next heartbeat retries recovery
+			logger.Error("Failed to recover Chrome", zap.Int("display", output.Display), zap.Error(err))
+			continue
+		}
+		if current := instance.context(); current != watched {
+			watched = current
+			listenForCrash(watched)
+		}
+	}
+}
+
+// recoverChrome reloads the current page and, if it still doesn't answer a heartbeat,
+// replaces the browser with a freshly launched one on the same display.
+func recoverChrome(ctx context.Context, config *Config, output StreamOutput, isPrimary bool, instance *chromeInstance, heartbeatTimeout time.Duration) error {
+	logger := utils.GetLoggerFromContext(ctx)
+	display := strconv.Itoa(output.Display)
+
+	reloadCtx, cancel := context.WithTimeout(instance.context(), chromeReloadTimeout)
+	err := chromedp.Run(reloadCtx, chromedp.Reload())
+	cancel()
+	if err == nil {
+		err = chromeHeartbeat(instance.context(), heartbeatTimeout)
+	}
+	if err == nil {
+		chromeRecoveriesTotal.WithLabelValues(display, chromeRecoveryReload).Inc()
+		logger.Info("Chrome page recovered by reload", zap.Int("display", output.Display))
+		return nil
+	}
+
+	logger.Warn("Reload did not recover Chrome, recreating browser",
+		zap.Int("display", output.Display), zap.Error(err))
+	return recreateChrome(ctx, config, output, isPrimary, instance)
+}
+
+// recreateChrome replaces the instance's browser with a freshly launched one on the
+// same display, e.g. after a hang or after its Xvfb display was restarted.
+func recreateChrome(ctx context.Context, config *Config, output StreamOutput, isPrimary bool, instance *chromeInstance) error {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	// Close the broken browser first so a persistent profile isn't locked by it
+	instance.closeCurrent()
+	chromeCtx, chromeCancel, err := launchChrome(ctx, config, output, isPrimary, instance.network)
+	if err != nil {
+		return fmt.Errorf("failed to recreate Chrome on display :%d: %w", output.Display, err)
+	}
+	if !instance.replace(chromeCtx, chromeCancel) {
+		return nil
+	}
+
+	chromeRecoveriesTotal.WithLabelValues(strconv.Itoa(output.Display), chromeRecoveryRecreate).Inc()
+	logger.Info("Chrome recreated", zap.Int("display", output.Display))
+	return nil
+}
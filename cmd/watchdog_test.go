@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChromeInstance(t *testing.T) {
+	t.Run("Replace Closes Old Browser", func(t *testing.T) {
+		oldCalls, newCalls := 0, 0
+		oldCtx := context.WithValue(context.Background(), instanceCtxTestKey{}, "old")
+		newCtx := context.WithValue(context.Background(), instanceCtxTestKey{}, "new")
+		instance := newChromeInstance(oldCtx, func() { oldCalls++ })
+
+		if !instance.replace(newCtx, func() { newCalls++ }) {
+			t.Fatal("Expected replace to succeed on a running instance")
+		}
+		if oldCalls != 1 {
+			t.Errorf("Expected old browser to be closed once, got %d", oldCalls)
+		}
+		if instance.context() != newCtx {
+			t.Error("Expected context() to return the replacement context")
+		}
+
+		instance.stop()
+		instance.stop()
+		if newCalls != 1 {
+			t.Errorf("Expected replacement browser to be closed once, got %d", newCalls)
+		}
+	})
+
+	t.Run("Replace After Stop Closes Replacement", func(t *testing.T) {
+		closed := false
+		instance := newChromeInstance(context.Background(), func() {})
+		instance.stop()
+
+		if instance.replace(context.Background(), func() { closed = true }) {
+			t.Error("Expected replace to fail on a stopped instance")
+		}
+		if !closed {
+			t.Error("Expected replacement browser to be closed when instance is stopped")
+		}
+		if !instance.isStopped() {
+			t.Error("Expected instance to report stopped")
+		}
+	})
+
+	t.Run("Close Current Keeps Instance Usable", func(t *testing.T) {
+		calls := 0
+		instance := newChromeInstance(context.Background(), func() { calls++ })
+
+		instance.closeCurrent()
+		instance.closeCurrent()
+		if calls != 1 {
+			t.Errorf("Expected current browser to be closed once, got %d", calls)
+		}
+		if instance.isStopped() {
+			t.Error("Expected instance to still be running after closeCurrent")
+		}
+		if !instance.replace(context.Background(), func() {}) {
+			t.Error("Expected replace to succeed after closeCurrent")
+		}
+	})
+}
+
+type instanceCtxTestKey struct{}
@@ -0,0 +1,75 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BandwidthTest describes an FFmpeg run that publishes generated, hard to compress
+// video in real time for Duration. When the uplink can't keep up, publishing takes
+// longer than Duration, so the bytes sent over the elapsed time is the upload speed,
+// up to Bitrate.
+type BandwidthTest struct {
+	// Bitrate of the generated stream in kbps; the highest speed that can be measured
+	Bitrate  int
+	Duration time.Duration
+	// URL the test stream is published to
+	URL string
+}
+
+// Args returns FFmpeg's arguments, excluding the program name. Progress is written
+// to stdout for ParseTotalSize.
+func (b BandwidthTest) Args() []string {
+	bitrate := fmt.Sprintf("%dk", b.Bitrate)
+	return []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-nostats",
+		"-re",
+		"-f", "lavfi",
+		"-i", "testsrc2=size=1280x720:rate=30,noise=alls=100:allf=t",
+		"-t", strconv.Itoa(int(b.Duration.Seconds())),
+		"-an",
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-tune", "zerolatency",
+		"-b:v", bitrate,
+		"-minrate", bitrate,
+		"-maxrate", bitrate,
+		"-bufsize", bitrate,
+		"-x264-params", "nal-hrd=cbr",
+		"-g", "60",
+		"-progress", "pipe:1",
+		"-f", "flv",
+		b.URL,
+	}
+}
+
+// ParseTotalSize returns the last total_size, in bytes, reported by FFmpeg's -progress output.
+func ParseTotalSize(r io.Reader) (int64, error) {
+	var total int64
+	found := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "total_size=")
+		if !ok {
+			continue
+		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		total, found = size, true
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no progress reported")
+	}
+	return total, nil
+}
@@ -0,0 +1,35 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBandwidthTestArgs(t *testing.T) {
+	test := BandwidthTest{
+		Bitrate:  20000,
+		Duration: 10 * time.Second,
+		URL:      "rtmp://ingest.example.com/app/live_test_key?bandwidthtest=true",
+	}
+	checkGolden(t, "bandwidth_test", test.Args())
+}
+
+func TestParseTotalSize(t *testing.T) {
+	t.Run("Last Report Wins", func(t *testing.T) {
+		progress := "frame=30\ntotal_size=1048576\nprogress=continue\nframe=300\ntotal_size=N/A\ntotal_size=25000000\nprogress=end\n"
+		size, err := ParseTotalSize(strings.NewReader(progress))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if size != 25000000 {
+			t.Errorf("Expected 25000000 bytes, got %d", size)
+		}
+	})
+
+	t.Run("No Progress", func(t *testing.T) {
+		if _, err := ParseTotalSize(strings.NewReader("")); err == nil {
+			t.Error("Expected an error without progress output")
+		}
+	})
+}
@@ -0,0 +1,248 @@
+// Package ffmpeg builds the FFmpeg command line that captures the Xvfb canvases and
+// the audio device and publishes them as a single Enhanced RTMP multitrack FLV stream,
+// and the one that measures upload speed to the ingest.
+package ffmpeg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Track is one video track of the stream.
+type Track struct {
+	Width     int
+	Height    int
+	Framerate int
+	// VideoBitrate in kbps with a "k" suffix, e.g. "6000k"
+	VideoBitrate string
+	// Display is the X display the track's canvas is drawn on
+	Display int
+	// Secondary tracks don't get a capture of their own; they are scaled from the
+	// capture of the primary track on the same Display.
+	Secondary bool
+}
+
+// Command describes an FFmpeg invocation. Args renders it in four parts: one x11grab
+// input per canvas plus the audio input, the filter graph, one encoder per track and
+// the FLV output.
+type Command struct {
+	Tracks []Track
+	// Preset is the libx264 preset
+	Preset string
+	// ThreadsPerEncoder is the thread count for each track's encoder
+	ThreadsPerEncoder int
+	// CanvasFilter optionally returns a filter chain to run on a canvas's capture
+	// before it is split into tracks, or "" for none.
+	CanvasFilter func(display int) string
+	// AudioFilter optionally returns filter graph parts consuming the audio input and
+	// the pad to map as the stream's audio.
+	AudioFilter func(audioInput int) ([]string, string)
+	// URL the stream is published to
+	URL string
+}
+
+// Args returns FFmpeg's arguments, excluding the program name.
+func (c Command) Args() []string {
+	args, inputs, audioInput := c.inputs()
+	filterParts, videoLabels, audioLabel := c.filterGraph(inputs, audioInput)
+
+	if len(filterParts) > 0 {
+		args = append(args, "-filter_complex", strings.Join(filterParts, ";"))
+	}
+	for _, label := range videoLabels {
+		args = append(args, "-map", label)
+	}
+	args = append(args, "-map", audioLabel)
+
+	args = append(args, c.encoders()...)
+	return append(args, c.output()...)
+}
+
+// inputs returns the input arguments: one x11grab input per unique display (not per
+// track), followed by the audio input. It also returns each display's input index and
+// the audio input's index.
+func (c Command) inputs() ([]string, map[int]int, int) {
+	var args []string
+	inputs := make(map[int]int)
+	for _, track := range c.Tracks {
+		if _, exists := inputs[track.Display]; exists {
+			continue
+		}
+		capture := c.capture(track)
+		args = append(args,
+			"-thread_queue_size", "512",
+			"-f", "x11grab",
+			"-draw_mouse", "0",
+			"-video_size", fmt.Sprintf("%dx%d", capture.Width, capture.Height),
+			"-framerate", strconv.Itoa(capture.Framerate),
+			"-i", fmt.Sprintf(":%d+0,0", track.Display),
+		)
+		inputs[track.Display] = len(inputs)
+	}
+
+	args = append(args,
+		"-thread_queue_size", "512",
+		"-f", "alsa",
+		"-i", "default",
+	)
+	return args, inputs, len(inputs)
+}
+
+// capture returns the track whose dimensions the track's display is captured at: the
+// display's primary track, which may come after its secondaries.
+func (c Command) capture(track Track) Track {
+	for _, t := range c.Tracks {
+		if t.Display == track.Display && !t.Secondary {
+			return t
+		}
+	}
+	return track
+}
+
+// filterGraph returns the filter_complex parts plus the pad to map for each track and
+// for the audio. Canvas filters run once per capture. When a capture feeds both a
+// primary and secondary tracks it is split: one copy passes through as-is, the
+// others are scaled.
+func (c Command) filterGraph(inputs map[int]int, audioInput int) ([]string, []string, string) {
+	var parts []string
+	labels := make([]string, len(c.Tracks))
+
+	// Source pad for each input: the raw capture, or the output of its canvas filters
+	sources := make(map[int]string)
+	for _, track := range c.Tracks {
+		input := inputs[track.Display]
+		if _, exists := sources[input]; exists {
+			continue
+		}
+		sources[input] = fmt.Sprintf("[%d:v]", input)
+		if c.CanvasFilter == nil {
+			continue
+		}
+		if chain := c.CanvasFilter(track.Display); chain != "" {
+			label := fmt.Sprintf("[chk%d]", input)
+			parts = append(parts, sources[input]+chain+label)
+			sources[input] = label
+		}
+	}
+
+	// Inputs with secondary tracks are split, once per track they feed
+	needsSplit := make(map[int]bool)
+	splitCount := make(map[int]int)
+	for _, track := range c.Tracks {
+		input := inputs[track.Display]
+		if track.Secondary {
+			needsSplit[input] = true
+		}
+		splitCount[input]++
+	}
+
+	// Next split pad to use for each input
+	splitIdx := make(map[int]int)
+
+	for i, track := range c.Tracks {
+		input := inputs[track.Display]
+
+		if !needsSplit[input] {
+			// No secondaries — pass the input through directly
+			if sources[input] == fmt.Sprintf("[%d:v]", input) {
+				labels[i] = fmt.Sprintf("%d:v", input)
+			} else {
+				labels[i] = sources[input]
+			}
+			continue
+		}
+
+		idx := splitIdx[input]
+		splitIdx[input] = idx + 1
+		label := fmt.Sprintf("v%d", i)
+
+		if idx == 0 {
+			// First track for this input — add the split filter
+			splitLabels := make([]string, splitCount[input])
+			for s := range splitLabels {
+				splitLabels[s] = fmt.Sprintf("[in%d_%d]", input, s)
+			}
+			parts = append(parts,
+				fmt.Sprintf("%ssplit=%d%s", sources[input], splitCount[input], strings.Join(splitLabels, "")))
+		}
+
+		pad := fmt.Sprintf("[in%d_%d]", input, idx)
+		if track.Secondary {
+			parts = append(parts, fmt.Sprintf("%sscale=%d:%d[%s]", pad, track.Width, track.Height, label))
+		} else {
+			// Primary track — just rename the split output
+			parts = append(parts, fmt.Sprintf("%snull[%s]", pad, label))
+		}
+		labels[i] = fmt.Sprintf("[%s]", label)
+	}
+
+	audioLabel := fmt.Sprintf("%d:a", audioInput)
+	if c.AudioFilter != nil {
+		var audioParts []string
+		audioParts, audioLabel = c.AudioFilter(audioInput)
+		parts = append(parts, audioParts...)
+	}
+
+	return parts, labels, audioLabel
+}
+
+// encoders returns the video encoder arguments shared by all tracks, followed by
+// each track's rate control.
+func (c Command) encoders() []string {
+	args := []string{
+		"-c:v", "libx264",
+		"-preset", c.Preset,
+		"-pix_fmt", "yuv420p",
+	}
+	for i, track := range c.Tracks {
+		bufsize := fmt.Sprintf("%dk", extractNumberFromBitrate(track.VideoBitrate)*2)
+		gopSize := track.Framerate * 2
+
+		args = append(args,
+			fmt.Sprintf("-threads:v:%d", i), strconv.Itoa(c.ThreadsPerEncoder),
+			fmt.Sprintf("-b:v:%d", i), track.VideoBitrate,
+			fmt.Sprintf("-maxrate:v:%d", i), track.VideoBitrate,
+			fmt.Sprintf("-bufsize:v:%d", i), bufsize,
+			fmt.Sprintf("-g:v:%d", i), strconv.Itoa(gopSize),
+		)
+	}
+	return args
+}
+
+// output returns the audio encoder and FLV output arguments.
+func (c Command) output() []string {
+	return []string{
+		"-c:a", "aac",
+		"-b:a", "160k",
+		"-ar", "44100",
+		"-f", "flv",
+		c.URL,
+	}
+}
+
+// ThreadsPerEncoder splits the CPUs between the tracks' encoders, giving each
+// between 2 and 8 threads.
+func ThreadsPerEncoder(numCPU, numTracks int) int {
+	if numTracks <= 0 {
+		return 4
+	}
+	threads := numCPU / numTracks
+	if threads < 2 {
+		threads = 2
+	}
+	if threads > 8 {
+		threads = 8
+	}
+	return threads
+}
+
+// extractNumberFromBitrate extracts the numeric value from a bitrate string (e.g., "3000k" -> 3000).
+func extractNumberFromBitrate(bitrate string) int {
+	numStr := strings.TrimSuffix(bitrate, "k")
+	num, err := strconv.Atoi(numStr)
+	if err != nil {
+		return 3000
+	}
+	return num
+}
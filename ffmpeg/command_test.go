@@ -0,0 +1,161 @@
+package ffmpeg
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenName turns a subtest name into its golden file name, e.g. "Single Track" -> "single_track".
+func goldenName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), " ", "_")
+}
+
+// checkGolden compares args, one per line, with testdata/<name>.golden.
+func checkGolden(t *testing.T, name string, args []string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	got := strings.Join(args, "\n") + "\n"
+
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if got != string(expected) {
+		t.Errorf("Arguments differ from %s (run with -update to accept):\ngot:\n%s\nexpected:\n%s", path, got, expected)
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		tracks []Track
+	}{
+		{
+			name: "Single Track",
+			tracks: []Track{
+				{Width: 1280, Height: 720, Framerate: 30, VideoBitrate: "3000k", Display: 99},
+			},
+		},
+		{
+			name: "Multi Canvas",
+			tracks: []Track{
+				{Width: 1920, Height: 1080, Framerate: 60, VideoBitrate: "6000k", Display: 99},
+				{Width: 1280, Height: 720, Framerate: 30, VideoBitrate: "3000k", Display: 100},
+			},
+		},
+		{
+			// Go Live orders tracks by its own preference, so a canvas's largest track
+			// can come after the tracks scaled from it
+			name: "Enhanced Broadcasting",
+			tracks: []Track{
+				{Width: 1280, Height: 720, Framerate: 60, VideoBitrate: "3500k", Display: 99, Secondary: true},
+				{Width: 1920, Height: 1080, Framerate: 60, VideoBitrate: "6000k", Display: 99},
+				{Width: 1080, Height: 1920, Framerate: 60, VideoBitrate: "6000k", Display: 100},
+				{Width: 720, Height: 1280, Framerate: 60, VideoBitrate: "3500k", Display: 100, Secondary: true},
+			},
+		},
+		{
+			name: "Secondary Tracks",
+			tracks: []Track{
+				{Width: 1920, Height: 1080, Framerate: 30, VideoBitrate: "6000k", Display: 99},
+				{Width: 1280, Height: 720, Framerate: 30, VideoBitrate: "3000k", Display: 99, Secondary: true},
+				{Width: 854, Height: 480, Framerate: 30, VideoBitrate: "1500k", Display: 99, Secondary: true},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			command := Command{
+				Tracks:            tc.tracks,
+				Preset:            "ultrafast",
+				ThreadsPerEncoder: 4,
+				URL:               "rtmp://live.example.com/app/streamkey",
+			}
+			checkGolden(t, goldenName(tc.name), command.Args())
+		})
+	}
+
+	t.Run("Canvas And Audio Filters", func(t *testing.T) {
+		command := Command{
+			Tracks: []Track{
+				{Width: 1920, Height: 1080, Framerate: 30, VideoBitrate: "6000k", Display: 99},
+				{Width: 1280, Height: 720, Framerate: 30, VideoBitrate: "3000k", Display: 99, Secondary: true},
+				{Width: 1080, Height: 1920, Framerate: 30, VideoBitrate: "6000k", Display: 100},
+			},
+			Preset:            "veryfast",
+			ThreadsPerEncoder: 2,
+			CanvasFilter: func(display int) string {
+				return fmt.Sprintf("metadata@check%d=mode=print", display)
+			},
+			AudioFilter: func(audioInput int) ([]string, string) {
+				return []string{fmt.Sprintf("[%d:a]asplit=2[aout][ameter]", audioInput), "[ameter]anullsink"}, "[aout]"
+			},
+			URL: "rtmp://live.example.com/app/streamkey",
+		}
+		checkGolden(t, goldenName("Canvas And Audio Filters"), command.Args())
+	})
+}
+
+func TestThreadsPerEncoder(t *testing.T) {
+	tests := []struct {
+		name      string
+		numCPU    int
+		numTracks int
+		expected  int
+	}{
+		{"Splits CPUs Between Tracks", 12, 3, 4},
+		{"At Least Two Threads", 2, 4, 2},
+		{"At Most Eight Threads", 64, 1, 8},
+		{"No Tracks", 8, 0, 4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ThreadsPerEncoder(tc.numCPU, tc.numTracks); got != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestExtractNumberFromBitrate(t *testing.T) {
+	t.Run("Valid Bitrate Strings", func(t *testing.T) {
+		testCases := []struct {
+			input    string
+			expected int
+		}{
+			{"3000k", 3000},
+			{"4500k", 4500},
+			{"6000k", 6000},
+			{"8500k", 8500},
+			{"1000k", 1000},
+		}
+
+		for _, tc := range testCases {
+			t.Run("Bitrate "+tc.input, func(t *testing.T) {
+				result := extractNumberFromBitrate(tc.input)
+				if result != tc.expected {
+					t.Errorf("Expected %d, got %d", tc.expected, result)
+				}
+			})
+		}
+	})
+
+	t.Run("Invalid Bitrate String", func(t *testing.T) {
+		result := extractNumberFromBitrate("invalidk")
+		if result != 3000 {
+			t.Errorf("Expected default value 3000, got %d", result)
+		}
+	})
+}
@@ -0,0 +1,12 @@
+// Package integration holds end-to-end tests that run the real binary with Xvfb,
+// Chrome and FFmpeg against a local test page, publish to a local RTMP receiver and
+// check what arrives with ffprobe.
+//
+// The tests are behind the integration build tag:
+//
+//	go test -tags integration -count=1 -v ./integration/...
+//
+// They need Xvfb, xdpyinfo, Chrome or Chromium, FFmpeg 8+ and ffprobe on the PATH,
+// plus a working ALSA "default" capture device (e.g. PulseAudio with a null sink, as
+// start.sh sets up in the container). Tests skip when a tool is missing.
+package integration
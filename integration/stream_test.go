@@ -0,0 +1,335 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	// How much of the stream the receiver records
+	recordDuration = 10 * time.Second
+	// How long the binary gets to start Xvfb and Chrome, connect and deliver the recording
+	streamTimeout = 90 * time.Second
+	// How far the measured framerate may stray from the configured one
+	framerateTolerance = 0.2
+)
+
+// Path of the binary under test, built once by TestMain
+var binaryPath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "stream-webpage-integration")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create build directory: %v\n", err)
+		os.Exit(1)
+	}
+	binaryPath = filepath.Join(dir, "stream")
+
+	build := exec.Command("go", "build", "-o", binaryPath, "../cmd")
+	build.Stdout = os.Stderr
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build binary: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// requireTools skips the test unless everything the pipeline runs is installed.
+func requireTools(t *testing.T) {
+	t.Helper()
+	for _, tool := range []string{"Xvfb", "xdpyinfo", "ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	for _, chrome := range []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "headless-shell"} {
+		if _, err := exec.LookPath(chrome); err == nil {
+			return
+		}
+	}
+	t.Skip("Chrome or Chromium is not installed")
+}
+
+// freePort returns a TCP port that was free a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// testPageURL writes a page that animates a canvas, so every frame differs, and
+// returns its file:// URL.
+func testPageURL(t *testing.T) string {
+	t.Helper()
+	page := `<!DOCTYPE html>
+<html>
+<head><title>Integration Test</title></head>
+<body style="margin:0;overflow:hidden;background:#000">
+<canvas id="c"></canvas>
+<script>
+const canvas = document.getElementById("c");
+const ctx = canvas.getContext("2d");
+function draw(time) {
+  canvas.width = window.innerWidth;
+  canvas.height = window.innerHeight;
+  ctx.fillStyle = "hsl(" + (time / 20 % 360) + ", 80%, 50%)";
+  ctx.fillRect(0, 0, canvas.width, canvas.height);
+  ctx.fillStyle = "#fff";
+  ctx.font = "64px sans-serif";
+  ctx.fillText(Math.floor(time) + " ms", 40, 100);
+  requestAnimationFrame(draw);
+}
+requestAnimationFrame(draw);
+</script>
+</body>
+</html>
+`
+	path := filepath.Join(t.TempDir(), "index.html")
+	if err := os.WriteFile(path, []byte(page), 0o644); err != nil {
+		t.Fatalf("Failed to write test page: %v", err)
+	}
+	return "file://" + path
+}
+
+// rtmpReceiver is FFmpeg listening for a single RTMP publish and recording every
+// track of it to a Matroska file.
+type rtmpReceiver struct {
+	url    string
+	output string
+	cmd    *exec.Cmd
+	log    bytes.Buffer
+	done   chan struct{}
+	err    error
+}
+
+func startRTMPReceiver(t *testing.T) *rtmpReceiver {
+	t.Helper()
+	r := &rtmpReceiver{
+		url:    fmt.Sprintf("rtmp://127.0.0.1:%d/live/integration", freePort(t)),
+		output: filepath.Join(t.TempDir(), "received.mkv"),
+		done:   make(chan struct{}),
+	}
+	r.cmd = exec.Command("ffmpeg", "-hide_banner", "-loglevel", "warning",
+		"-listen", "1", "-i", r.url,
+		"-map", "0", "-c", "copy",
+		"-t", strconv.Itoa(int(recordDuration.Seconds())),
+		"-y", r.output,
+	)
+	r.cmd.Stdout = &r.log
+	r.cmd.Stderr = &r.log
+	if err := r.cmd.Start(); err != nil {
+		t.Fatalf("Failed to start RTMP receiver: %v", err)
+	}
+	go func() {
+		r.err = r.cmd.Wait()
+		close(r.done)
+	}()
+	t.Cleanup(func() {
+		_ = r.cmd.Process.Kill()
+		<-r.done
+		if t.Failed() {
+			t.Logf("RTMP receiver output:\n%s", r.log.String())
+		}
+	})
+	return r
+}
+
+// wait blocks until the recording is complete.
+func (r *rtmpReceiver) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-r.done:
+		if r.err != nil {
+			t.Fatalf("RTMP receiver failed: %v", r.err)
+		}
+	case <-time.After(streamTimeout):
+		t.Fatalf("No stream recorded within %v", streamTimeout)
+	}
+}
+
+// startStream runs the binary with env on top of the current environment and stops
+// it when the test ends.
+func startStream(t *testing.T, env ...string) {
+	t.Helper()
+	var log bytes.Buffer
+	cmd := exec.Command(binaryPath)
+	// Clear settings from the environment that would change the stream's shape
+	cmd.Env = append(os.Environ(),
+		"PORT="+strconv.Itoa(freePort(t)),
+		"LOG_LEVEL=debug",
+		"STREAM_OUTPUTS=",
+		"TWITCH_ENHANCED_BROADCASTING=",
+		"TWITCH_CHANNEL=",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdout = &log
+	cmd.Stderr = &log
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start binary: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		_ = cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-done:
+		case <-time.After(30 * time.Second):
+			_ = cmd.Process.Kill()
+			<-done
+		}
+		if t.Failed() {
+			t.Logf("Binary output:\n%s", log.String())
+		}
+	})
+}
+
+// probedStream is one stream of the recording as reported by ffprobe.
+type probedStream struct {
+	CodecType     string `json:"codec_type"`
+	CodecName     string `json:"codec_name"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	NbReadPackets string `json:"nb_read_packets"`
+}
+
+// probe returns the recording's streams and duration in seconds.
+func probe(t *testing.T, path string) ([]probedStream, float64) {
+	t.Helper()
+	out, err := exec.Command("ffprobe", "-v", "error", "-count_packets",
+		"-show_entries", "stream=codec_type,codec_name,width,height,nb_read_packets:format=duration",
+		"-of", "json", path).Output()
+	if err != nil {
+		t.Fatalf("ffprobe failed: %v", err)
+	}
+	var result struct {
+		Streams []probedStream `json:"streams"`
+		Format  struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("Failed to parse ffprobe output: %v", err)
+	}
+	duration, err := strconv.ParseFloat(result.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		t.Fatalf("Invalid recording duration %q", result.Format.Duration)
+	}
+	return result.Streams, duration
+}
+
+// videoTrack is a video track the stream is expected to carry.
+type videoTrack struct {
+	Width     int
+	Height    int
+	Framerate int
+}
+
+// checkRecording verifies the recording has exactly the expected video tracks, in
+// order, plus one AAC audio track.
+func checkRecording(t *testing.T, path string, expected []videoTrack) {
+	t.Helper()
+	streams, duration := probe(t, path)
+
+	var video []probedStream
+	audio := 0
+	for _, stream := range streams {
+		switch stream.CodecType {
+		case "video":
+			video = append(video, stream)
+		case "audio":
+			audio++
+			if stream.CodecName != "aac" {
+				t.Errorf("Expected AAC audio, got %q", stream.CodecName)
+			}
+		}
+	}
+
+	if audio != 1 {
+		t.Errorf("Expected 1 audio track, got %d", audio)
+	}
+	if len(video) != len(expected) {
+		t.Fatalf("Expected %d video tracks, got %d: %+v", len(expected), len(video), video)
+	}
+	for i, want := range expected {
+		got := video[i]
+		if got.CodecName != "h264" {
+			t.Errorf("Track %d: expected H.264, got %q", i, got.CodecName)
+		}
+		if got.Width != want.Width || got.Height != want.Height {
+			t.Errorf("Track %d: expected %dx%d, got %dx%d", i, want.Width, want.Height, got.Width, got.Height)
+		}
+		packets, err := strconv.Atoi(got.NbReadPackets)
+		if err != nil {
+			t.Errorf("Track %d: invalid packet count %q", i, got.NbReadPackets)
+			continue
+		}
+		framerate := float64(packets) / duration
+		if math.Abs(framerate-float64(want.Framerate)) > float64(want.Framerate)*framerateTolerance {
+			t.Errorf("Track %d: expected about %d fps, measured %.1f", i, want.Framerate, framerate)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		expected []videoTrack
+	}{
+		{
+			name:     "Single Track",
+			env:      []string{"RESOLUTION=720p", "FRAMERATE=30"},
+			expected: []videoTrack{{Width: 1280, Height: 720, Framerate: 30}},
+		},
+		{
+			name: "Multitrack Landscape And Portrait",
+			env: []string{`STREAM_OUTPUTS=[` +
+				`{"width":1280,"height":720,"framerate":30,"videoBitrate":"3000k","name":"landscape"},` +
+				`{"width":720,"height":1280,"framerate":30,"videoBitrate":"3000k","name":"portrait"}]`},
+			expected: []videoTrack{
+				{Width: 1280, Height: 720, Framerate: 30},
+				{Width: 720, Height: 1280, Framerate: 30},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			requireTools(t)
+			receiver := startRTMPReceiver(t)
+			env := append([]string{
+				"WEBPAGE_URL=" + testPageURL(t),
+				"RTMP_URL=" + receiver.url,
+			}, tc.env...)
+			startStream(t, env...)
+
+			receiver.wait(t)
+			checkRecording(t, receiver.output, tc.expected)
+		})
+	}
+}
@@ -57,3 +57,22 @@ func initializeClient(ctx context.Context) (*helix.Client, error) {
 
 	return client, nil
 }
+
+// NewUserClient creates a Twitch API client authenticated with the user access token
+// in TWITCH_USER_ACCESS_TOKEN, which EventSub WebSocket subscriptions require. With
+// TWITCH_REFRESH_TOKEN and TWITCH_CLIENT_SECRET set, expired tokens are refreshed.
+func NewUserClient(ctx context.Context) (*helix.Client, error) {
+	clientID := utils.GetEnvOrDefault("TWITCH_CLIENT_ID", "")
+	userAccessToken := utils.GetEnvOrDefault("TWITCH_USER_ACCESS_TOKEN", "")
+
+	if clientID == "" || userAccessToken == "" {
+		return nil, errors.New("Twitch client ID and user access token must be set")
+	}
+
+	return helix.NewClientWithContext(ctx, &helix.Options{
+		ClientID:        clientID,
+		ClientSecret:    utils.GetEnvOrDefault("TWITCH_CLIENT_SECRET", ""),
+		UserAccessToken: userAccessToken,
+		RefreshToken:    utils.GetEnvOrDefault("TWITCH_REFRESH_TOKEN", ""),
+	})
+}
@@ -0,0 +1,316 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/nicklaw5/helix/v2"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+const (
+	// Twitch's EventSub WebSocket endpoint
+	DefaultEventSubURL = "wss://eventsub.wss.twitch.tv/ws"
+	// Subscription types for a channel going live and ending its stream
+	EventSubStreamOnline  = helix.EventSubTypeStreamOnline
+	EventSubStreamOffline = helix.EventSubTypeStreamOffline
+	// Default wait before reconnecting after the connection is lost; doubles on each
+	// failed attempt up to eventSubMaxReconnectDelay
+	DefaultEventSubReconnectDelay = 5 * time.Second
+	eventSubMaxReconnectDelay     = 2 * time.Minute
+	// How long to wait for the connection and its welcome message
+	eventSubDialTimeout = 10 * time.Second
+	// Grace on top of the session's keepalive timeout before the connection is considered dead
+	eventSubKeepaliveSlack = 10 * time.Second
+	// How many notification IDs are remembered to drop redelivered notifications
+	eventSubSeenMessages = 100
+)
+
+// EventSubEvent is a stream.online or stream.offline notification.
+type EventSubEvent struct {
+	// Type is the subscription type, EventSubStreamOnline or EventSubStreamOffline
+	Type                 string
+	BroadcasterUserID    string
+	BroadcasterUserLogin string
+}
+
+// EventSubOptions configures RunEventSub.
+type EventSubOptions struct {
+	// URL of the EventSub WebSocket server; empty uses DefaultEventSubURL
+	URL string
+	// Subscribe creates the subscriptions for a new session. It must succeed within
+	// 10 seconds of the welcome message or Twitch closes the connection.
+	Subscribe func(ctx context.Context, sessionID string) error
+	// OnEvent is called for every notification, once per message ID
+	OnEvent func(EventSubEvent)
+	// OnConnected, if set, is called with true once subscribed and false when the connection is lost
+	OnConnected func(connected bool)
+	// ReconnectDelay is the wait before the first reconnect; 0 uses DefaultEventSubReconnectDelay
+	ReconnectDelay time.Duration
+}
+
+// eventSubMessage is the envelope of every message sent over the WebSocket.
+type eventSubMessage struct {
+	Metadata struct {
+		MessageID   string `json:"message_id"`
+		MessageType string `json:"message_type"`
+	} `json:"metadata"`
+	Payload struct {
+		Session *struct {
+			ID                      string `json:"id"`
+			KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+			ReconnectURL            string `json:"reconnect_url"`
+		} `json:"session"`
+		Subscription *struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"subscription"`
+		Event *struct {
+			BroadcasterUserID    string `json:"broadcaster_user_id"`
+			BroadcasterUserLogin string `json:"broadcaster_user_login"`
+		} `json:"event"`
+	} `json:"payload"`
+}
+
+// eventSubConn is one WebSocket connection and the session it was welcomed with.
+type eventSubConn struct {
+	conn      net.Conn
+	rw        io.ReadWriter
+	sessionID string
+	keepalive time.Duration
+	// stopClose stops closing the connection when the context is cancelled
+	stopClose func() bool
+}
+
+// RunEventSub connects to EventSub, subscribes each new session with opts.Subscribe
+// and hands notifications to opts.OnEvent. Lost connections are re-established with
+// backoff and server-requested reconnects are followed without re-subscribing. Runs
+// until ctx is cancelled.
+func RunEventSub(ctx context.Context, opts EventSubOptions) {
+	logger := utils.GetLoggerFromContext(ctx)
+	if opts.URL == "" {
+		opts.URL = DefaultEventSubURL
+	}
+	if opts.ReconnectDelay == 0 {
+		opts.ReconnectDelay = DefaultEventSubReconnectDelay
+	}
+
+	seen := newEventSubSeen()
+	delay := opts.ReconnectDelay
+	for {
+		subscribed, err := runEventSubSession(ctx, opts, seen)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			delay = opts.ReconnectDelay
+		}
+		logger.Warn("EventSub connection lost, reconnecting", zap.Duration("retryIn", delay), zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(delay*2, eventSubMaxReconnectDelay)
+	}
+}
+
+// runEventSubSession connects, subscribes and reads messages until the connection
+// fails. It reports whether the session got subscribed.
+func runEventSubSession(ctx context.Context, opts EventSubOptions, seen *eventSubSeen) (bool, error) {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	conn, err := dialEventSub(ctx, opts.URL)
+	if err != nil {
+		return false, err
+	}
+	defer func() { conn.close() }()
+
+	if err := opts.Subscribe(ctx, conn.sessionID); err != nil {
+		return false, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	logger.Info("EventSub session subscribed", zap.String("sessionId", conn.sessionID))
+	if opts.OnConnected != nil {
+		opts.OnConnected(true)
+		defer opts.OnConnected(false)
+	}
+
+	for {
+		msg, err := conn.next(conn.keepalive + eventSubKeepaliveSlack)
+		if err != nil {
+			return true, err
+		}
+
+		switch msg.Metadata.MessageType {
+		case "session_keepalive":
+		case "notification":
+			if msg.Payload.Subscription == nil || msg.Payload.Event == nil {
+				logger.Warn("Ignoring malformed EventSub notification", zap.String("messageId", msg.Metadata.MessageID))
+				continue
+			}
+			if !seen.add(msg.Metadata.MessageID) {
+				logger.Debug("Ignoring redelivered EventSub notification", zap.String("messageId", msg.Metadata.MessageID))
+				continue
+			}
+			opts.OnEvent(EventSubEvent{
+				Type:                 msg.Payload.Subscription.Type,
+				BroadcasterUserID:    msg.Payload.Event.BroadcasterUserID,
+				BroadcasterUserLogin: msg.Payload.Event.BroadcasterUserLogin,
+			})
+		case "session_reconnect":
+			if msg.Payload.Session == nil || msg.Payload.Session.ReconnectURL == "" {
+				return true, fmt.Errorf("EventSub reconnect without a reconnect URL")
+			}
+			// Subscriptions move to the new connection, which must be up before the old one closes
+			logger.Info("EventSub requested a reconnect")
+			next, err := dialEventSub(ctx, msg.Payload.Session.ReconnectURL)
+			if err != nil {
+				return true, fmt.Errorf("failed to follow EventSub reconnect: %w", err)
+			}
+			conn.close()
+			conn = next
+		case "revocation":
+			if msg.Payload.Subscription != nil {
+				return true, fmt.Errorf("EventSub subscription %s revoked: %s",
+					msg.Payload.Subscription.Type, msg.Payload.Subscription.Status)
+			}
+			return true, fmt.Errorf("EventSub subscription revoked")
+		default:
+			logger.Debug("Ignoring EventSub message", zap.String("type", msg.Metadata.MessageType))
+		}
+	}
+}
+
+// dialEventSub connects to url and waits for the session welcome.
+func dialEventSub(ctx context.Context, url string) (*eventSubConn, error) {
+	dialer := ws.Dialer{Timeout: eventSubDialTimeout}
+	conn, br, _, err := dialer.Dial(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to EventSub: %w", err)
+	}
+	// The reader may hold frames sent right after the handshake
+	var r io.Reader = conn
+	if br != nil {
+		r = br
+	}
+	c := &eventSubConn{
+		conn: conn,
+		rw: struct {
+			io.Reader
+			io.Writer
+		}{r, conn},
+		stopClose: context.AfterFunc(ctx, func() { conn.Close() }),
+	}
+
+	msg, err := c.next(eventSubDialTimeout)
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to read EventSub welcome: %w", err)
+	}
+	if msg.Metadata.MessageType != "session_welcome" || msg.Payload.Session == nil {
+		c.close()
+		return nil, fmt.Errorf("expected EventSub welcome, got %q", msg.Metadata.MessageType)
+	}
+	c.sessionID = msg.Payload.Session.ID
+	c.keepalive = time.Duration(msg.Payload.Session.KeepaliveTimeoutSeconds) * time.Second
+	return c, nil
+}
+
+// next reads the next message, failing if none arrives within timeout. Pings are
+// answered along the way.
+func (c *eventSubConn) next(timeout time.Duration) (*eventSubMessage, error) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+		data, op, err := wsutil.ReadServerData(c.rw)
+		if err != nil {
+			return nil, err
+		}
+		if op != ws.OpText {
+			continue
+		}
+		var msg eventSubMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("failed to decode EventSub message: %w", err)
+		}
+		return &msg, nil
+	}
+}
+
+func (c *eventSubConn) close() {
+	c.stopClose()
+	c.conn.Close()
+}
+
+// eventSubSeen remembers recent notification IDs; Twitch may deliver a notification more than once.
+type eventSubSeen struct {
+	ids   map[string]bool
+	order []string
+}
+
+func newEventSubSeen() *eventSubSeen {
+	return &eventSubSeen{ids: make(map[string]bool)}
+}
+
+// add records id, returning false if it was already seen.
+func (s *eventSubSeen) add(id string) bool {
+	if s.ids[id] {
+		return false
+	}
+	s.ids[id] = true
+	s.order = append(s.order, id)
+	if len(s.order) > eventSubSeenMessages {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// StreamEventSubscriber returns an EventSubOptions.Subscribe that subscribes a session
+// to stream.online and stream.offline for the broadcaster. client must use a user
+// access token; Twitch rejects WebSocket subscriptions made with an app access token.
+func StreamEventSubscriber(client *helix.Client, broadcasterID string) func(ctx context.Context, sessionID string) error {
+	return func(ctx context.Context, sessionID string) error {
+		for _, eventType := range []string{EventSubStreamOnline, EventSubStreamOffline} {
+			resp, err := client.CreateEventSubSubscription(&helix.EventSubSubscription{
+				Type:      eventType,
+				Version:   "1",
+				Condition: helix.EventSubCondition{BroadcasterUserID: broadcasterID},
+				Transport: helix.EventSubTransport{Method: "websocket", SessionID: sessionID},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to subscribe to %s: %w", eventType, err)
+			}
+			if resp.StatusCode != http.StatusAccepted {
+				return fmt.Errorf("failed to subscribe to %s: HTTP %d: %s", eventType, resp.StatusCode, resp.ErrorMessage)
+			}
+		}
+		return nil
+	}
+}
+
+// GetBroadcasterID looks up the user ID of the channel with the given login.
+func GetBroadcasterID(client *helix.Client, login string) (string, error) {
+	resp, err := client.GetUsers(&helix.UsersParams{Logins: []string{login}})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up Twitch channel %q: %w", login, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to look up Twitch channel %q: HTTP %d: %s", login, resp.StatusCode, resp.ErrorMessage)
+	}
+	if len(resp.Data.Users) == 0 {
+		return "", fmt.Errorf("Twitch channel %q not found", login)
+	}
+	return resp.Data.Users[0].ID, nil
+}
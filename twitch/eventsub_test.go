@@ -0,0 +1,334 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/nicklaw5/helix/v2"
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// newEventSubStandIn starts a local EventSub WebSocket server. Each connection is
+// handed to the handler for its path, and closed once the handler returns.
+func newEventSubStandIn(t *testing.T, handlers map[string]func(conn net.Conn)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// eventSubURL returns the WebSocket URL of path on the stand-in.
+func eventSubURL(server *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + path
+}
+
+func sendEventSub(conn net.Conn, messageID, messageType, payload string) {
+	msg := fmt.Sprintf(`{"metadata":{"message_id":%q,"message_type":%q,"message_timestamp":%q},"payload":%s}`,
+		messageID, messageType, time.Now().UTC().Format(time.RFC3339Nano), payload)
+	wsutil.WriteServerText(conn, []byte(msg))
+}
+
+func sendWelcome(conn net.Conn, sessionID string) {
+	sendEventSub(conn, "welcome-"+sessionID, "session_welcome",
+		fmt.Sprintf(`{"session":{"id":%q,"status":"connected","keepalive_timeout_seconds":10}}`, sessionID))
+}
+
+func sendNotification(conn net.Conn, messageID, eventType string) {
+	sendEventSub(conn, messageID, "notification", fmt.Sprintf(
+		`{"subscription":{"type":%q,"version":"1","status":"enabled"},"event":{"broadcaster_user_id":"1337","broadcaster_user_login":"cooler_user"}}`,
+		eventType))
+}
+
+// waitForClose blocks until the client closes the connection.
+func waitForClose(conn net.Conn) {
+	for {
+		if _, _, err := wsutil.ReadClientData(conn); err != nil {
+			return
+		}
+	}
+}
+
+// eventSubRecorder collects what RunEventSub reports.
+type eventSubRecorder struct {
+	mu       sync.Mutex
+	sessions []string
+	events   chan EventSubEvent
+}
+
+func newEventSubRecorder() *eventSubRecorder {
+	return &eventSubRecorder{events: make(chan EventSubEvent, 10)}
+}
+
+func (r *eventSubRecorder) options(url string) EventSubOptions {
+	return EventSubOptions{
+		URL: url,
+		Subscribe: func(ctx context.Context, sessionID string) error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.sessions = append(r.sessions, sessionID)
+			return nil
+		},
+		OnEvent:        func(event EventSubEvent) { r.events <- event },
+		ReconnectDelay: 10 * time.Millisecond,
+	}
+}
+
+func (r *eventSubRecorder) subscribedSessions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.sessions...)
+}
+
+func (r *eventSubRecorder) next(t *testing.T) EventSubEvent {
+	t.Helper()
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an EventSub event")
+		return EventSubEvent{}
+	}
+}
+
+// runEventSubInBackground runs RunEventSub until the test ends.
+func runEventSubInBackground(t *testing.T, opts EventSubOptions) {
+	t.Helper()
+	logger, _ := zap.NewDevelopment()
+	ctx, cancel := context.WithCancel(utils.SaveLoggerToContext(context.Background(), logger))
+	done := make(chan struct{})
+	go func() {
+		RunEventSub(ctx, opts)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("expected RunEventSub to return once cancelled")
+		}
+	})
+}
+
+func TestRunEventSub_DeliversNotificationsOnce(t *testing.T) {
+	server := newEventSubStandIn(t, map[string]func(net.Conn){
+		"/ws": func(conn net.Conn) {
+			sendWelcome(conn, "session-1")
+			sendEventSub(conn, "keepalive-1", "session_keepalive", `{}`)
+			sendNotification(conn, "message-1", EventSubStreamOffline)
+			sendNotification(conn, "message-1", EventSubStreamOffline)
+			sendNotification(conn, "message-2", EventSubStreamOnline)
+			waitForClose(conn)
+		},
+	})
+	recorder := newEventSubRecorder()
+	runEventSubInBackground(t, recorder.options(eventSubURL(server, "/ws")))
+
+	first := recorder.next(t)
+	if first.Type != EventSubStreamOffline || first.BroadcasterUserID != "1337" || first.BroadcasterUserLogin != "cooler_user" {
+		t.Errorf("unexpected first event: %+v", first)
+	}
+	if second := recorder.next(t); second.Type != EventSubStreamOnline {
+		t.Errorf("expected the redelivered notification to be dropped, got %+v", second)
+	}
+	if sessions := recorder.subscribedSessions(); len(sessions) != 1 || sessions[0] != "session-1" {
+		t.Errorf("expected session-1 to be subscribed once, got %v", sessions)
+	}
+}
+
+func TestRunEventSub_FollowsReconnect(t *testing.T) {
+	var server *httptest.Server
+	server = newEventSubStandIn(t, map[string]func(net.Conn){
+		"/ws": func(conn net.Conn) {
+			sendWelcome(conn, "session-1")
+			sendEventSub(conn, "reconnect-1", "session_reconnect", fmt.Sprintf(
+				`{"session":{"id":"session-1","status":"reconnecting","reconnect_url":%q}}`,
+				eventSubURL(server, "/reconnect")))
+			waitForClose(conn)
+		},
+		"/reconnect": func(conn net.Conn) {
+			sendWelcome(conn, "session-1")
+			sendNotification(conn, "message-1", EventSubStreamOffline)
+			waitForClose(conn)
+		},
+	})
+	recorder := newEventSubRecorder()
+	runEventSubInBackground(t, recorder.options(eventSubURL(server, "/ws")))
+
+	if event := recorder.next(t); event.Type != EventSubStreamOffline {
+		t.Errorf("expected the notification from the new connection, got %+v", event)
+	}
+	if sessions := recorder.subscribedSessions(); len(sessions) != 1 {
+		t.Errorf("expected subscriptions to carry over the reconnect, subscribed %v", sessions)
+	}
+}
+
+func TestRunEventSub_ResubscribesAfterConnectionLoss(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	server := newEventSubStandIn(t, map[string]func(net.Conn){
+		"/ws": func(conn net.Conn) {
+			mu.Lock()
+			connections++
+			n := connections
+			mu.Unlock()
+
+			sendWelcome(conn, fmt.Sprintf("session-%d", n))
+			if n == 1 {
+				// Drop the first connection
+				return
+			}
+			sendNotification(conn, "message-1", EventSubStreamOnline)
+			waitForClose(conn)
+		},
+	})
+	recorder := newEventSubRecorder()
+	runEventSubInBackground(t, recorder.options(eventSubURL(server, "/ws")))
+
+	if event := recorder.next(t); event.Type != EventSubStreamOnline {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	sessions := recorder.subscribedSessions()
+	if len(sessions) != 2 || sessions[0] != "session-1" || sessions[1] != "session-2" {
+		t.Errorf("expected session-1 and session-2 to be subscribed, got %v", sessions)
+	}
+}
+
+func TestRunEventSub_RetriesFailedSubscribe(t *testing.T) {
+	server := newEventSubStandIn(t, map[string]func(net.Conn){
+		"/ws": func(conn net.Conn) {
+			sendWelcome(conn, "session")
+			sendNotification(conn, "message-1", EventSubStreamOffline)
+			waitForClose(conn)
+		},
+	})
+	recorder := newEventSubRecorder()
+	opts := recorder.options(eventSubURL(server, "/ws"))
+	var attempts int
+	subscribe := opts.Subscribe
+	opts.Subscribe = func(ctx context.Context, sessionID string) error {
+		attempts++
+		if attempts == 1 {
+			return fmt.Errorf("HTTP 401")
+		}
+		return subscribe(ctx, sessionID)
+	}
+	runEventSubInBackground(t, opts)
+
+	recorder.next(t)
+	if sessions := recorder.subscribedSessions(); len(sessions) != 1 {
+		t.Errorf("expected one successful subscription, got %v", sessions)
+	}
+}
+
+// newTestHelixClient returns a client calling handler instead of the Twitch API.
+func newTestHelixClient(t *testing.T, handler http.HandlerFunc) *helix.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := helix.NewClient(&helix.Options{
+		ClientID:        "client-id",
+		UserAccessToken: "user-token",
+		APIBaseURL:      server.URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return client
+}
+
+func TestStreamEventSubscriber(t *testing.T) {
+	var mu sync.Mutex
+	var subscriptions []helix.EventSubSubscription
+	client := newTestHelixClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eventsub/subscriptions" || r.Header.Get("Authorization") != "Bearer user-token" {
+			http.Error(w, `{"error":"Unauthorized","status":401,"message":"invalid token"}`, http.StatusUnauthorized)
+			return
+		}
+		var sub helix.EventSubSubscription
+		json.NewDecoder(r.Body).Decode(&sub)
+		mu.Lock()
+		subscriptions = append(subscriptions, sub)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"data": []helix.EventSubSubscription{sub}})
+	})
+
+	if err := StreamEventSubscriber(client, "1337")(context.Background(), "session-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(subscriptions) != 2 {
+		t.Fatalf("expected 2 subscriptions, got %d", len(subscriptions))
+	}
+	for i, eventType := range []string{EventSubStreamOnline, EventSubStreamOffline} {
+		sub := subscriptions[i]
+		if sub.Type != eventType || sub.Version != "1" {
+			t.Errorf("expected %s version 1, got %s version %s", eventType, sub.Type, sub.Version)
+		}
+		if sub.Condition.BroadcasterUserID != "1337" {
+			t.Errorf("expected broadcaster 1337, got %q", sub.Condition.BroadcasterUserID)
+		}
+		if sub.Transport.Method != "websocket" || sub.Transport.SessionID != "session-1" {
+			t.Errorf("expected websocket transport for session-1, got %+v", sub.Transport)
+		}
+	}
+}
+
+func TestStreamEventSubscriber_Rejected(t *testing.T) {
+	client := newTestHelixClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"Bad Request","status":400,"message":"websocket transport cannot be used with app access token"}`))
+	})
+
+	err := StreamEventSubscriber(client, "1337")(context.Background(), "session-1")
+	if err == nil || !strings.Contains(err.Error(), "app access token") {
+		t.Errorf("expected the API error, got %v", err)
+	}
+}
+
+func TestGetBroadcasterID(t *testing.T) {
+	client := newTestHelixClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("login") == "cooler_user" {
+			w.Write([]byte(`{"data":[{"id":"1337","login":"cooler_user"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	})
+
+	id, err := GetBroadcasterID(client, "cooler_user")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "1337" {
+		t.Errorf("expected ID 1337, got %q", id)
+	}
+	if _, err := GetBroadcasterID(client, "nobody"); err == nil {
+		t.Error("expected an error for an unknown channel")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,14 +15,16 @@ import (
 )
 
 const (
-	TwitchGoLiveURL = "https://ingest.twitch.tv/api/v3/GetClientConfiguration"
-	// Schema "2024-06-04" is the current working version. "2025-01-25" requires a
-	// different struct layout (strings for system.build/revision, canvases array)
-	// and was returning HTTP 400 with empty body. "2023-05-10" is explicitly deprecated.
-	GoLiveSchemaVersion = "2024-06-04"
-	GoLiveService       = "IVS"
-	DefaultClientName   = "stream-webpage-container"
-	GoLiveTimeout       = 10 * time.Second
+	TwitchGoLiveURL         = "https://ingest.twitch.tv/api/v3/GetClientConfiguration"
+	// Schema "2024-06-04" is the default and the one known to work. "2025-01-25"
+	// uses a different request layout (see GoLiveRequest2025) and can be selected
+	// with GoLiveOptions.SchemaVersion; requests fall back to "2024-06-04" if the
+	// API rejects it. "2023-05-10" is explicitly deprecated.
+	GoLiveSchemaVersion     = "2024-06-04"
+	GoLiveSchemaVersion2025 = "2025-01-25"
+	GoLiveService           = "IVS"
+	DefaultClientName       = "stream-webpage-container"
+	GoLiveTimeout           = 10 * time.Second
 )
 
 // GoLiveRequest is the POST body sent to Twitch's GetClientConfiguration endpoint.
@@ -160,6 +163,9 @@ type GoLiveOptions struct {
 	ClientName string
 	// MaxTracks caps the number of encoder configurations returned (nil = no limit)
 	MaxTracks *int
+	// MaxAggregateBitrate caps the combined bitrate of the returned tracks, in kbps
+	// (nil = no limit)
+	MaxAggregateBitrate *int
 	// Primary canvas dimensions (from the largest landscape STREAM_OUTPUTS entry)
 	CanvasWidth  int
 	CanvasHeight int
@@ -167,12 +173,23 @@ type GoLiveOptions struct {
 	// PortraitCanvas, if set, adds a second portrait canvas to the request.
 	// Derived from the first portrait entry in STREAM_OUTPUTS.
 	PortraitCanvas *GoLiveCanvas
+	// APIURL overrides the GetClientConfiguration endpoint (default: TwitchGoLiveURL),
+	// e.g. to point at the bundled mock server.
+	APIURL string
+	// GPU names the GPU profile reported in capabilities (default: GoLiveGPUNVIDIA)
+	GPU string
+	// SchemaVersion selects the request layout (default: GoLiveSchemaVersion)
+	SchemaVersion string
 }
 
 // CallGoLiveAPI calls Twitch's GetClientConfiguration endpoint to obtain
 // multitrack streaming configuration and ingest credentials.
 func CallGoLiveAPI(ctx context.Context, streamKey string, opts GoLiveOptions) (*GoLiveResponse, error) {
-	return callGoLiveAPIWithURL(ctx, streamKey, opts, TwitchGoLiveURL)
+	apiURL := opts.APIURL
+	if apiURL == "" {
+		apiURL = TwitchGoLiveURL
+	}
+	return callGoLiveAPIWithURL(ctx, streamKey, opts, apiURL)
 }
 
 func callGoLiveAPIWithURL(ctx context.Context, streamKey string, opts GoLiveOptions, apiURL string) (*GoLiveResponse, error) {
@@ -196,14 +213,27 @@ func callGoLiveAPIWithURL(ctx context.Context, streamKey string, opts GoLiveOpti
 		framerate = 60
 	}
 
-	// Twitch's Go Live API validates hardware capabilities and rejects requests
-	// that don't report a recognized GPU. The API uses this to decide which encoder
-	// configurations to return. We report plausible NVIDIA hardware because:
+	// Twitch's Go Live API uses the reported hardware to decide which encoder
+	// configurations to return, so the real CPU, memory and kernel are reported.
+	// It also rejects requests that don't report a recognized GPU, which containers
+	// rarely have, so a GPU profile (NVIDIA by default) is reported instead:
 	//   1. The API returns HTTP 200 with "GPU not supported" if vendor_id is 0
 	//   2. We only use the response for track resolutions/bitrates — actual encoding
 	//      is done with libx264 regardless of what the API recommends
 	//   3. The returned encoder_configurations specify OBS-specific encoder types
 	//      (e.g. "jim_nvenc") which we ignore; we only extract width/height/bitrate
+	gpus, err := goLiveGPUs(opts.GPU)
+	if err != nil {
+		return nil, err
+	}
+
+	// The API takes the aggregate bitrate in bits per second
+	var maxAggregateBitrate *int64
+	if opts.MaxAggregateBitrate != nil {
+		bps := int64(*opts.MaxAggregateBitrate) * 1000
+		maxAggregateBitrate = &bps
+	}
+
 	req := GoLiveRequest{
 		Service:        GoLiveService,
 		SchemaVersion:  GoLiveSchemaVersion,
@@ -214,50 +244,14 @@ func callGoLiveAPIWithURL(ctx context.Context, streamKey string, opts GoLiveOpti
 			SupportedCodecs: []string{"h264"},
 			VodTrackAudio:   false,
 		},
-		Capabilities: GoLiveCapabilities{
-			// CPU/Memory values are plausible defaults; the API uses them to gauge
-			// encoding capacity but we don't rely on its encoder choice.
-			CPU: GoLiveCPU{
-				PhysicalCores: 8,
-				LogicalCores:  8,
-				Speed:         3800,
-				Name:          "AMD Ryzen 7 5800X",
-			},
-			Memory: GoLiveMemory{
-				Total: 34359738368,
-				Free:  16589934592,
-			},
-			// Must report a recognized GPU vendor (NVIDIA=4318, AMD=4098) or the API
-			// rejects with "Your GPU is not currently supported by Enhanced Broadcasting."
-			GPU: []GoLiveGPU{
-				{
-					Model:                "NVIDIA GeForce RTX 4080",
-					VendorID:             4318, // 0x10DE (NVIDIA)
-					DeviceID:             10114,
-					DedicatedVideoMemory: 16106127360,
-					SharedSystemMemory:   17079595008,
-					DriverVersion:        "566.36",
-				},
-			},
-			System: GoLiveSystem{
-				Version:      "6.6",
-				Name:         "Linux",
-				Build:        0,
-				Release:      "6.6",
-				Revision:     0,
-				Bits:         64,
-				ARM:          false,
-				ARMEmulation: false,
-			},
-			GamingFeatures: nil,
-		},
+		Capabilities: DetectCapabilities(gpus),
 		// Canvas dimensions must be flat fields in preferences (not a nested array)
 		// for schema "2024-06-04". The API uses these to determine output track layouts.
 		// MaximumVideoTracks caps how many encoder configs the API returns — each track
 		// requires its own Xvfb + Chrome + FFmpeg encode pipeline, so limit to what
 		// the container can sustain.
 		Preferences: GoLivePreferences{
-			MaximumAggregateBitrate: nil,
+			MaximumAggregateBitrate: maxAggregateBitrate,
 			MaximumVideoTracks:      opts.MaxTracks,
 			CompositionGPUIndex:     0,
 			Width:                   canvasWidth,
@@ -278,19 +272,64 @@ func callGoLiveAPIWithURL(ctx context.Context, streamKey string, opts GoLiveOpti
 		req.Preferences.Canvases = []GoLiveCanvas{*opts.PortraitCanvas}
 	}
 
-	body, err := json.Marshal(req)
+	schemaVersion := opts.SchemaVersion
+	if schemaVersion == "" {
+		schemaVersion = GoLiveSchemaVersion
+	}
+	goLiveResp, err := postGoLiveRequest(ctx, apiURL, req, schemaVersion)
+	// The API answers HTTP 400 to schemas it doesn't accept; fall back to the one known to work
+	var httpErr *GoLiveHTTPError
+	if schemaVersion != GoLiveSchemaVersion && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest {
+		logger.Warn("Go Live API rejected schema version, falling back",
+			zap.String("schemaVersion", schemaVersion),
+			zap.String("fallbackSchemaVersion", GoLiveSchemaVersion))
+		goLiveResp, err = postGoLiveRequest(ctx, apiURL, req, GoLiveSchemaVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if goLiveResp.Status.Result == "error" {
+		msg := goLiveResp.Status.HTMLEnUS
+		if msg == "" {
+			msg = "unknown error"
+		}
+		return nil, fmt.Errorf("Go Live API returned error: %s", msg)
+	}
+
+	return goLiveResp, nil
+}
+
+// encodeGoLiveRequest marshals req in the layout of the given schema version.
+func encodeGoLiveRequest(req GoLiveRequest, schemaVersion string) ([]byte, error) {
+	switch schemaVersion {
+	case GoLiveSchemaVersion:
+		req.SchemaVersion = schemaVersion
+		return json.Marshal(req)
+	case GoLiveSchemaVersion2025:
+		return json.Marshal(newGoLiveRequest2025(req))
+	default:
+		return nil, fmt.Errorf("unsupported Go Live schema version %q", schemaVersion)
+	}
+}
+
+// postGoLiveRequest sends req to apiURL using the given schema version and parses the response.
+func postGoLiveRequest(ctx context.Context, apiURL string, req GoLiveRequest, schemaVersion string) (*GoLiveResponse, error) {
+	logger := utils.GetLoggerFromContext(ctx)
+
+	body, err := encodeGoLiveRequest(req, schemaVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal Go Live API request: %w", err)
 	}
 
-	var redactedReq GoLiveRequest
-	_ = json.Unmarshal(body, &redactedReq)
+	redactedReq := req
 	redactedReq.Authentication = "[REDACTED]"
-	redactedBody, _ := json.Marshal(redactedReq)
+	redactedBody, _ := encodeGoLiveRequest(redactedReq, schemaVersion)
 
 	logger.Debug("Calling Twitch Go Live API",
 		zap.String("url", apiURL),
-		zap.String("clientName", clientName),
+		zap.String("clientName", req.Client.Name),
+		zap.String("schemaVersion", schemaVersion),
 		zap.String("requestBody", string(redactedBody)))
 
 	httpCtx, cancel := context.WithTimeout(ctx, GoLiveTimeout)
@@ -317,7 +356,7 @@ func callGoLiveAPIWithURL(ctx context.Context, streamKey string, opts GoLiveOpti
 		logger.Debug("Go Live API error response",
 			zap.Int("statusCode", resp.StatusCode),
 			zap.String("body", string(respBody)))
-		return nil, fmt.Errorf("Go Live API returned HTTP %d: %s", resp.StatusCode, string(respBody))
+		return nil, &GoLiveHTTPError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var goLiveResp GoLiveResponse
@@ -328,16 +367,9 @@ func callGoLiveAPIWithURL(ctx context.Context, streamKey string, opts GoLiveOpti
 	logger.Debug("Go Live API response received",
 		zap.String("status", goLiveResp.Status.Result),
 		zap.String("configId", goLiveResp.Meta.ConfigID),
+		zap.String("schemaVersion", goLiveResp.Meta.SchemaVersion),
 		zap.Int("numEncoders", len(goLiveResp.EncoderConfigurations)),
 		zap.Int("numEndpoints", len(goLiveResp.IngestEndpoints)))
 
-	if goLiveResp.Status.Result == "error" {
-		msg := goLiveResp.Status.HTMLEnUS
-		if msg == "" {
-			msg = "unknown error"
-		}
-		return nil, fmt.Errorf("Go Live API returned error: %s", msg)
-	}
-
 	return &goLiveResp, nil
 }
@@ -0,0 +1,78 @@
+package twitch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// goLiveCacheEntry is the on-disk form of a cached Go Live response.
+type goLiveCacheEntry struct {
+	SavedAt time.Time `json:"saved_at"`
+	// Fingerprint identifies the request the response answered, so a response is
+	// never reused for a different stream key or set of preferences
+	Fingerprint string         `json:"fingerprint"`
+	Response    GoLiveResponse `json:"response"`
+}
+
+// goLiveFingerprint hashes the stream key and options a request is built from.
+func goLiveFingerprint(streamKey string, opts GoLiveOptions) string {
+	optsJSON, _ := json.Marshal(opts)
+	sum := sha256.Sum256(append([]byte(streamKey+"\n"), optsJSON...))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveGoLiveResponse writes resp to path for reuse by LoadGoLiveResponse. The file
+// holds ingest credentials, so it is only readable by the owner.
+func SaveGoLiveResponse(path, streamKey string, opts GoLiveOptions, resp *GoLiveResponse) error {
+	data, err := json.Marshal(goLiveCacheEntry{
+		SavedAt:     time.Now().UTC(),
+		Fingerprint: goLiveFingerprint(streamKey, opts),
+		Response:    *resp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode Go Live response: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated cache
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".golive-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create Go Live cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write Go Live cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write Go Live cache file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return fmt.Errorf("failed to write Go Live cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write Go Live cache file: %w", err)
+	}
+	return nil
+}
+
+// LoadGoLiveResponse reads a response saved by SaveGoLiveResponse for the same stream
+// key and options, returning it with the time it was saved.
+func LoadGoLiveResponse(path, streamKey string, opts GoLiveOptions) (*GoLiveResponse, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read Go Live cache file: %w", err)
+	}
+	var entry goLiveCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse Go Live cache file: %w", err)
+	}
+	if entry.Fingerprint != goLiveFingerprint(streamKey, opts) {
+		return nil, time.Time{}, fmt.Errorf("cached Go Live response was for a different stream key or preferences")
+	}
+	return &entry.Response, entry.SavedAt, nil
+}
@@ -0,0 +1,63 @@
+package twitch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoLiveResponseCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golive.json")
+	opts := GoLiveOptions{CanvasWidth: 1280, CanvasHeight: 720, Framerate: 30}
+	resp := &GoLiveResponse{
+		Meta:            GoLiveMeta{ConfigID: "cached-config"},
+		IngestEndpoints: []GoLiveIngestEndpoint{{Protocol: "RTMP", URLTemplate: "rtmp://test/app/{stream_key}", Authentication: "auth"}},
+	}
+
+	if err := SaveGoLiveResponse(path, "live_test_key", opts, resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		cached, savedAt, err := LoadGoLiveResponse(path, "live_test_key", opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cached.Meta.ConfigID != "cached-config" || len(cached.IngestEndpoints) != 1 {
+			t.Errorf("unexpected cached response: %+v", cached)
+		}
+		if savedAt.IsZero() {
+			t.Error("expected the save time to be recorded")
+		}
+	})
+
+	t.Run("Owner Only", func(t *testing.T) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("Different Stream Key", func(t *testing.T) {
+		if _, _, err := LoadGoLiveResponse(path, "other_key", opts); err == nil {
+			t.Error("expected a response for another stream key to be rejected")
+		}
+	})
+
+	t.Run("Different Preferences", func(t *testing.T) {
+		changed := opts
+		changed.Framerate = 60
+		if _, _, err := LoadGoLiveResponse(path, "live_test_key", changed); err == nil {
+			t.Error("expected a response for other preferences to be rejected")
+		}
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		if _, _, err := LoadGoLiveResponse(filepath.Join(t.TempDir(), "missing.json"), "live_test_key", opts); err == nil {
+			t.Error("expected an error for a missing file")
+		}
+	})
+}
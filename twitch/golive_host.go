@@ -0,0 +1,227 @@
+package twitch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GPU profiles reported to the Go Live API. Containers rarely have a GPU the API would
+// recognize, and it rejects requests without one, so a plausible card is reported;
+// encoding is done with libx264 whatever the API assumes.
+const (
+	// NVIDIA GeForce RTX 4080 (the default)
+	GoLiveGPUNVIDIA = "nvidia"
+	// AMD Radeon RX 7800 XT
+	GoLiveGPUAMD = "amd"
+	// No GPU; the real API answers with "Your GPU is not currently supported"
+	GoLiveGPUNone = "none"
+)
+
+var goLiveGPUProfiles = map[string][]GoLiveGPU{
+	GoLiveGPUNVIDIA: {{
+		Model:                "NVIDIA GeForce RTX 4080",
+		VendorID:             4318, // 0x10DE (NVIDIA)
+		DeviceID:             10114,
+		DedicatedVideoMemory: 16106127360,
+		SharedSystemMemory:   17079595008,
+		DriverVersion:        "566.36",
+	}},
+	GoLiveGPUAMD: {{
+		Model:                "AMD Radeon RX 7800 XT",
+		VendorID:             4098, // 0x1002 (AMD)
+		DeviceID:             29822,
+		DedicatedVideoMemory: 17163091968,
+		SharedSystemMemory:   17079595008,
+		DriverVersion:        "24.12.1",
+	}},
+	GoLiveGPUNone: {},
+}
+
+// GoLiveGPUProfiles returns the names of the GPU profiles that can be reported.
+func GoLiveGPUProfiles() []string {
+	names := make([]string, 0, len(goLiveGPUProfiles))
+	for name := range goLiveGPUProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// goLiveGPUs returns the GPUs of the named profile; empty selects GoLiveGPUNVIDIA.
+func goLiveGPUs(profile string) ([]GoLiveGPU, error) {
+	if profile == "" {
+		profile = GoLiveGPUNVIDIA
+	}
+	gpus, ok := goLiveGPUProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown GPU profile %q, expected one of: %s", profile, strings.Join(GoLiveGPUProfiles(), ", "))
+	}
+	return gpus, nil
+}
+
+// DetectCapabilities describes the host for the Go Live API: CPU from /proc/cpuinfo,
+// memory from /proc/meminfo (capped by the container's cgroup limit), the kernel
+// release from uname and the architecture from runtime.GOARCH. Anything that can't
+// be read falls back to what the Go runtime knows. gpus is reported as-is.
+func DetectCapabilities(gpus []GoLiveGPU) GoLiveCapabilities {
+	var cpu GoLiveCPU
+	if f, err := os.Open("/proc/cpuinfo"); err == nil {
+		cpu = parseCPUInfo(f)
+		f.Close()
+	}
+	// Only the CPUs the process may run on can encode, e.g. with --cpuset-cpus
+	if cpu.LogicalCores == 0 || cpu.LogicalCores > runtime.NumCPU() {
+		cpu.LogicalCores = runtime.NumCPU()
+	}
+	if cpu.PhysicalCores == 0 || cpu.PhysicalCores > cpu.LogicalCores {
+		cpu.PhysicalCores = cpu.LogicalCores
+	}
+	if cpu.Speed == 0 {
+		cpu.Speed = readMaxFrequencyMHz("/sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq")
+	}
+	if cpu.Name == "" {
+		cpu.Name = runtime.GOARCH
+	}
+
+	var memory GoLiveMemory
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		memory = parseMemInfo(f)
+		f.Close()
+	}
+	if limit := readCgroupMemoryLimit("/sys/fs/cgroup/memory.max"); limit > 0 && limit < memory.Total {
+		memory.Total = limit
+		if memory.Free > limit {
+			memory.Free = limit
+		}
+	}
+
+	release := kernelRelease()
+	return GoLiveCapabilities{
+		CPU:    cpu,
+		Memory: memory,
+		GPU:    gpus,
+		System: GoLiveSystem{
+			Version: kernelVersion(release),
+			Name:    "Linux",
+			Release: release,
+			Bits:    strconv.IntSize,
+			ARM:     runtime.GOARCH == "arm64" || runtime.GOARCH == "arm",
+		},
+	}
+}
+
+// parseCPUInfo reads the CPU model, core counts and clock speed from /proc/cpuinfo.
+// Physical cores are the distinct (physical id, core id) pairs; ARM kernels list
+// neither, leaving them to the caller.
+func parseCPUInfo(r io.Reader) GoLiveCPU {
+	var cpu GoLiveCPU
+	cores := make(map[string]bool)
+	physicalID := ""
+	var maxMHz float64
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "processor":
+			cpu.LogicalCores++
+		case "model name", "Model":
+			if cpu.Name == "" {
+				cpu.Name = value
+			}
+		case "physical id":
+			physicalID = value
+		case "core id":
+			cores[physicalID+"/"+value] = true
+		case "cpu MHz":
+			if mhz, err := strconv.ParseFloat(value, 64); err == nil && mhz > maxMHz {
+				maxMHz = mhz
+			}
+		}
+	}
+	cpu.PhysicalCores = len(cores)
+	cpu.Speed = int(math.Round(maxMHz))
+	return cpu
+}
+
+// parseMemInfo reads total and available memory from /proc/meminfo, in bytes.
+func parseMemInfo(r io.Reader) GoLiveMemory {
+	var memory GoLiveMemory
+	var free, available int64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			memory.Total = kb * 1024
+		case "MemFree:":
+			free = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+	// MemAvailable counts reclaimable caches too; older kernels lack it
+	memory.Free = available
+	if memory.Free == 0 {
+		memory.Free = free
+	}
+	return memory
+}
+
+// readMaxFrequencyMHz reads a cpufreq frequency file (in kHz), returning 0 if unavailable.
+func readMaxFrequencyMHz(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	khz, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return khz / 1000
+}
+
+// readCgroupMemoryLimit reads a cgroup v2 memory.max file, returning 0 when there is
+// no limit or it can't be read.
+func readCgroupMemoryLimit(path string) int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+// kernelVersion returns the major.minor part of a kernel release like "6.6.87-generic".
+func kernelVersion(release string) string {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return release
+	}
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i]
+	}
+	return parts[0] + "." + minor
+}
@@ -0,0 +1,19 @@
+package twitch
+
+import "syscall"
+
+// kernelRelease returns the running kernel's release, as reported by uname -r.
+func kernelRelease() string {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return ""
+	}
+	release := make([]byte, 0, len(uts.Release))
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	return string(release)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package twitch
+
+// kernelRelease returns "" off Linux; the container always runs on Linux.
+func kernelRelease() string {
+	return ""
+}
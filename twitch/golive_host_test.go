@@ -0,0 +1,160 @@
+package twitch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testX86CPUInfo = `processor	: 0
+vendor_id	: AuthenticAMD
+model name	: AMD EPYC 7763 64-Core Processor
+cpu MHz		: 2445.404
+physical id	: 0
+core id		: 0
+
+processor	: 1
+model name	: AMD EPYC 7763 64-Core Processor
+cpu MHz		: 3243.123
+physical id	: 0
+core id		: 0
+
+processor	: 2
+model name	: AMD EPYC 7763 64-Core Processor
+cpu MHz		: 2445.404
+physical id	: 0
+core id		: 1
+
+processor	: 3
+model name	: AMD EPYC 7763 64-Core Processor
+cpu MHz		: 2445.404
+physical id	: 1
+core id		: 0
+`
+
+const testARMCPUInfo = `processor	: 0
+BogoMIPS	: 243.75
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 atomics
+CPU implementer	: 0x41
+CPU part	: 0xd0c
+
+processor	: 1
+BogoMIPS	: 243.75
+CPU implementer	: 0x41
+CPU part	: 0xd0c
+`
+
+func TestParseCPUInfo_X86(t *testing.T) {
+	cpu := parseCPUInfo(strings.NewReader(testX86CPUInfo))
+
+	if cpu.Name != "AMD EPYC 7763 64-Core Processor" {
+		t.Errorf("expected model name, got %q", cpu.Name)
+	}
+	if cpu.LogicalCores != 4 {
+		t.Errorf("expected 4 logical cores, got %d", cpu.LogicalCores)
+	}
+	if cpu.PhysicalCores != 3 {
+		t.Errorf("expected 3 physical cores, got %d", cpu.PhysicalCores)
+	}
+	if cpu.Speed != 3243 {
+		t.Errorf("expected the fastest core's 3243 MHz, got %d", cpu.Speed)
+	}
+}
+
+func TestParseCPUInfo_ARM(t *testing.T) {
+	cpu := parseCPUInfo(strings.NewReader(testARMCPUInfo))
+
+	if cpu.LogicalCores != 2 {
+		t.Errorf("expected 2 logical cores, got %d", cpu.LogicalCores)
+	}
+	if cpu.PhysicalCores != 0 || cpu.Speed != 0 || cpu.Name != "" {
+		t.Errorf("expected no physical cores, speed or name, got %+v", cpu)
+	}
+}
+
+func TestParseMemInfo(t *testing.T) {
+	memory := parseMemInfo(strings.NewReader("MemTotal:        8000000 kB\nMemFree:         1000000 kB\nMemAvailable:    5000000 kB\n"))
+	if memory.Total != 8000000*1024 {
+		t.Errorf("expected total of 8000000 kB, got %d bytes", memory.Total)
+	}
+	if memory.Free != 5000000*1024 {
+		t.Errorf("expected available memory to be reported as free, got %d bytes", memory.Free)
+	}
+
+	memory = parseMemInfo(strings.NewReader("MemTotal:        8000000 kB\nMemFree:         1000000 kB\n"))
+	if memory.Free != 1000000*1024 {
+		t.Errorf("expected MemFree without MemAvailable, got %d bytes", memory.Free)
+	}
+}
+
+func TestKernelVersion(t *testing.T) {
+	tests := map[string]string{
+		"6.6.87.2-microsoft-standard-WSL2": "6.6",
+		"6.18.44-fc-v139":                  "6.18",
+		"5.15.0-1057-aws":                  "5.15",
+		"6.1-rc3":                          "6.1",
+		"":                                 "",
+	}
+	for release, expected := range tests {
+		if got := kernelVersion(release); got != expected {
+			t.Errorf("expected version %q for release %q, got %q", expected, release, got)
+		}
+	}
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	gpus, err := goLiveGPUs("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	caps := DetectCapabilities(gpus)
+
+	if caps.CPU.LogicalCores < 1 || caps.CPU.LogicalCores > runtime.NumCPU() {
+		t.Errorf("expected between 1 and %d logical cores, got %d", runtime.NumCPU(), caps.CPU.LogicalCores)
+	}
+	if caps.CPU.PhysicalCores < 1 || caps.CPU.PhysicalCores > caps.CPU.LogicalCores {
+		t.Errorf("expected physical cores within logical cores, got %d", caps.CPU.PhysicalCores)
+	}
+	if caps.CPU.Name == "" {
+		t.Error("expected a CPU name")
+	}
+	if caps.System.ARM != (runtime.GOARCH == "arm64" || runtime.GOARCH == "arm") {
+		t.Errorf("expected ARM to match GOARCH %s", runtime.GOARCH)
+	}
+	if len(caps.GPU) != 1 || caps.GPU[0].VendorID != 4318 {
+		t.Errorf("expected the NVIDIA profile by default, got %+v", caps.GPU)
+	}
+}
+
+func TestGoLiveGPUs_UnknownProfile(t *testing.T) {
+	if _, err := goLiveGPUs("voodoo"); err == nil {
+		t.Error("expected error for an unknown GPU profile")
+	}
+}
+
+func TestCallGoLiveAPI_ReportsGPUProfile(t *testing.T) {
+	var received GoLiveRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(GoLiveResponse{Status: GoLiveStatus{Result: "success"}})
+	}))
+	defer server.Close()
+
+	_, err := CallGoLiveAPI(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL, GPU: GoLiveGPUAMD})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received.Capabilities.GPU) != 1 || received.Capabilities.GPU[0].VendorID != 4098 {
+		t.Errorf("expected the AMD profile, got %+v", received.Capabilities.GPU)
+	}
+	if received.Capabilities.CPU.LogicalCores > runtime.NumCPU() {
+		t.Errorf("expected the host's CPU, got %+v", received.Capabilities.CPU)
+	}
+
+	if _, err := CallGoLiveAPI(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL, GPU: "voodoo"}); err == nil {
+		t.Error("expected error for an unknown GPU profile")
+	}
+}
@@ -0,0 +1,234 @@
+package twitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// Scenarios answered by the Go Live mock server.
+const (
+	// Three landscape tracks on a single canvas
+	MockScenarioSuccess = "success"
+	// Two landscape and two portrait tracks for Dual-Format streaming
+	MockScenarioPortrait = "portrait"
+	// A usable configuration with a warning status attached
+	MockScenarioWarning = "warning"
+	// An error status with no configuration, like an unsupported GPU
+	MockScenarioError = "error"
+	// A configuration whose only ingest endpoint isn't RTMP
+	MockScenarioNoRTMP = "no-rtmp"
+	// Three landscape tracks, but "2025-01-25" requests are rejected with HTTP 400
+	// like an API that doesn't accept that schema
+	MockScenarioLegacySchema = "legacy-schema"
+)
+
+// DefaultMockIngestURL is the ingest URL template the mock hands out by default: the
+// development RTMP server started by `make dev`.
+const DefaultMockIngestURL = "rtmp://localhost:1935/live/{stream_key}"
+
+func mockEncoder(width, height, framerate, bitrate int) GoLiveEncoderConfiguration {
+	return GoLiveEncoderConfiguration{
+		Type:      "obs_x264",
+		Width:     width,
+		Height:    height,
+		Framerate: &GoLiveFramerate{Numerator: framerate, Denominator: 1},
+		Settings: GoLiveEncoderSettings{
+			Bitrate:     bitrate,
+			RateControl: "CBR",
+			KeyintSec:   2,
+			Profile:     "high",
+		},
+	}
+}
+
+// mockLandscapeResponse is a successful response with three landscape tracks.
+func mockLandscapeResponse(configID, ingestURL string) GoLiveResponse {
+	return GoLiveResponse{
+		Meta:            GoLiveMeta{ConfigID: configID, Service: GoLiveService, SchemaVersion: GoLiveSchemaVersion},
+		Status:          GoLiveStatus{Result: "success"},
+		IngestEndpoints: []GoLiveIngestEndpoint{{Protocol: "RTMP", URLTemplate: ingestURL}},
+		EncoderConfigurations: []GoLiveEncoderConfiguration{
+			mockEncoder(1920, 1080, 60, 6000),
+			mockEncoder(1280, 720, 60, 3000),
+			mockEncoder(852, 480, 30, 1500),
+		},
+	}
+}
+
+// mockScenarios builds the canned response for each scenario. The ingest endpoint's
+// authentication is filled in per request.
+var mockScenarios = map[string]func(ingestURL string) GoLiveResponse{
+	MockScenarioSuccess: func(ingestURL string) GoLiveResponse {
+		return mockLandscapeResponse("mock-success", ingestURL)
+	},
+	MockScenarioPortrait: func(ingestURL string) GoLiveResponse {
+		return GoLiveResponse{
+			Meta:            GoLiveMeta{ConfigID: "mock-portrait", Service: GoLiveService, SchemaVersion: GoLiveSchemaVersion},
+			Status:          GoLiveStatus{Result: "success"},
+			IngestEndpoints: []GoLiveIngestEndpoint{{Protocol: "RTMP", URLTemplate: ingestURL}},
+			EncoderConfigurations: []GoLiveEncoderConfiguration{
+				mockEncoder(1280, 720, 30, 3500),
+				mockEncoder(852, 480, 30, 1500),
+				mockEncoder(720, 1280, 30, 3000),
+				mockEncoder(480, 852, 30, 1200),
+			},
+		}
+	},
+	MockScenarioWarning: func(ingestURL string) GoLiveResponse {
+		return GoLiveResponse{
+			Meta:            GoLiveMeta{ConfigID: "mock-warning", Service: GoLiveService, SchemaVersion: GoLiveSchemaVersion},
+			Status:          GoLiveStatus{Result: "warning", HTMLEnUS: "Your driver version will be deprecated soon."},
+			IngestEndpoints: []GoLiveIngestEndpoint{{Protocol: "RTMP", URLTemplate: ingestURL}},
+			EncoderConfigurations: []GoLiveEncoderConfiguration{
+				mockEncoder(1280, 720, 30, 3000),
+				mockEncoder(852, 480, 30, 1500),
+			},
+		}
+	},
+	MockScenarioError: func(ingestURL string) GoLiveResponse {
+		return GoLiveResponse{
+			Meta:   GoLiveMeta{Service: GoLiveService, SchemaVersion: GoLiveSchemaVersion},
+			Status: GoLiveStatus{Result: "error", HTMLEnUS: "Your GPU is not currently supported by Enhanced Broadcasting."},
+		}
+	},
+	MockScenarioLegacySchema: func(ingestURL string) GoLiveResponse {
+		return mockLandscapeResponse("mock-legacy-schema", ingestURL)
+	},
+	MockScenarioNoRTMP: func(ingestURL string) GoLiveResponse {
+		return GoLiveResponse{
+			Meta:   GoLiveMeta{ConfigID: "mock-no-rtmp", Service: GoLiveService, SchemaVersion: GoLiveSchemaVersion},
+			Status: GoLiveStatus{Result: "success"},
+			IngestEndpoints: []GoLiveIngestEndpoint{
+				{Protocol: "SRT", URLTemplate: "srt://localhost:9000?streamid={stream_key}"},
+			},
+			EncoderConfigurations: []GoLiveEncoderConfiguration{
+				mockEncoder(1280, 720, 30, 3000),
+			},
+		}
+	},
+}
+
+// MockGoLiveScenarios returns the names of the scenarios the mock server knows.
+func MockGoLiveScenarios() []string {
+	names := make([]string, 0, len(mockScenarios))
+	for name := range mockScenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MockGoLiveResponse returns the canned response for scenario, with ingest endpoints
+// built from ingestURL (a template containing {stream_key}) authenticated by streamKey.
+func MockGoLiveResponse(scenario, ingestURL, streamKey string) (*GoLiveResponse, bool) {
+	build, ok := mockScenarios[scenario]
+	if !ok {
+		return nil, false
+	}
+	resp := build(ingestURL)
+	for i := range resp.IngestEndpoints {
+		resp.IngestEndpoints[i].Authentication = streamKey
+	}
+	return &resp, true
+}
+
+// NewMockGoLiveHandler returns a handler standing in for GetClientConfiguration. The
+// last element of the request path picks the scenario (e.g. POST /portrait), falling
+// back to defaultScenario for any other path.
+func NewMockGoLiveHandler(logger *zap.Logger, defaultScenario, ingestURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		req, err := decodeMockGoLiveRequest(r.Body)
+		if err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		scenario := path.Base(r.URL.Path)
+		if _, ok := mockScenarios[scenario]; !ok {
+			scenario = defaultScenario
+		}
+		if scenario == MockScenarioLegacySchema && req.SchemaVersion == GoLiveSchemaVersion2025 {
+			logger.Info("Rejecting Go Live request schema",
+				zap.String("scenario", scenario),
+				zap.String("schemaVersion", req.SchemaVersion))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp, ok := MockGoLiveResponse(scenario, ingestURL, req.Authentication)
+		if !ok {
+			http.Error(w, "unknown scenario", http.StatusNotFound)
+			return
+		}
+		resp.Meta.SchemaVersion = req.SchemaVersion
+
+		logger.Info("Answering Go Live request",
+			zap.String("scenario", scenario),
+			zap.String("schemaVersion", req.SchemaVersion),
+			zap.Int("canvasWidth", req.Preferences.CanvasWidth),
+			zap.Int("canvasHeight", req.Preferences.CanvasHeight),
+			zap.Int("portraitCanvases", len(req.Preferences.Canvases)),
+			zap.Intp("maxTracks", req.Preferences.MaximumVideoTracks),
+			zap.Int64p("maxAggregateBitrate", req.Preferences.MaximumAggregateBitrate))
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// decodeMockGoLiveRequest decodes a request in either schema, converting a
+// "2025-01-25" request to the "2024-06-04" layout.
+func decodeMockGoLiveRequest(body io.Reader) (*GoLiveRequest, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var version struct {
+		SchemaVersion string `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, err
+	}
+	if version.SchemaVersion != GoLiveSchemaVersion2025 {
+		var req GoLiveRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		return &req, nil
+	}
+
+	var req2025 GoLiveRequest2025
+	if err := json.Unmarshal(data, &req2025); err != nil {
+		return nil, err
+	}
+	if len(req2025.Preferences.Canvases) == 0 {
+		return nil, fmt.Errorf("no canvases in request")
+	}
+	primary := req2025.Preferences.Canvases[0]
+	return &GoLiveRequest{
+		Service:        req2025.Service,
+		SchemaVersion:  req2025.SchemaVersion,
+		Authentication: req2025.Authentication,
+		Client:         req2025.Client,
+		Preferences: GoLivePreferences{
+			MaximumAggregateBitrate: req2025.Preferences.MaximumAggregateBitrate,
+			MaximumVideoTracks:      req2025.Preferences.MaximumVideoTracks,
+			Width:                   primary.Width,
+			Height:                  primary.Height,
+			CanvasWidth:             primary.CanvasWidth,
+			CanvasHeight:            primary.CanvasHeight,
+			Framerate:               primary.Framerate,
+			Canvases:                req2025.Preferences.Canvases[1:],
+		},
+	}, nil
+}
@@ -0,0 +1,116 @@
+package twitch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newMockGoLiveServer(t *testing.T, defaultScenario string) *httptest.Server {
+	t.Helper()
+	logger, _ := zap.NewDevelopment()
+	server := httptest.NewServer(NewMockGoLiveHandler(logger, defaultScenario, "rtmp://127.0.0.1:1935/live/{stream_key}"))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMockGoLiveHandler_Scenarios(t *testing.T) {
+	server := newMockGoLiveServer(t, MockScenarioSuccess)
+	ctx := testContext()
+
+	t.Run("Success", func(t *testing.T) {
+		resp, err := callGoLiveAPIWithURL(ctx, "live_test_key", GoLiveOptions{}, server.URL+"/"+MockScenarioSuccess)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.EncoderConfigurations) != 3 {
+			t.Errorf("expected 3 encoder configurations, got %d", len(resp.EncoderConfigurations))
+		}
+		if len(resp.IngestEndpoints) != 1 || resp.IngestEndpoints[0].Authentication != "live_test_key" {
+			t.Errorf("expected an ingest endpoint authenticated with the stream key, got %+v", resp.IngestEndpoints)
+		}
+	})
+
+	t.Run("Portrait", func(t *testing.T) {
+		resp, err := callGoLiveAPIWithURL(ctx, "live_test_key", GoLiveOptions{}, server.URL+"/"+MockScenarioPortrait)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		portrait := 0
+		for _, enc := range resp.EncoderConfigurations {
+			if enc.Height > enc.Width {
+				portrait++
+			}
+		}
+		if portrait != 2 || len(resp.EncoderConfigurations) != 4 {
+			t.Errorf("expected 2 portrait tracks out of 4, got %d of %d", portrait, len(resp.EncoderConfigurations))
+		}
+	})
+
+	t.Run("Warning", func(t *testing.T) {
+		resp, err := callGoLiveAPIWithURL(ctx, "live_test_key", GoLiveOptions{}, server.URL+"/"+MockScenarioWarning)
+		if err != nil {
+			t.Fatalf("warning should not return error, got: %v", err)
+		}
+		if resp.Status.Result != "warning" || resp.Status.HTMLEnUS == "" {
+			t.Errorf("expected a warning status with a message, got %+v", resp.Status)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := callGoLiveAPIWithURL(ctx, "live_test_key", GoLiveOptions{}, server.URL+"/"+MockScenarioError)
+		if err == nil || !strings.Contains(err.Error(), "not currently supported") {
+			t.Errorf("expected the scenario's error message, got %v", err)
+		}
+	})
+
+	t.Run("No RTMP", func(t *testing.T) {
+		resp, err := callGoLiveAPIWithURL(ctx, "live_test_key", GoLiveOptions{}, server.URL+"/"+MockScenarioNoRTMP)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, endpoint := range resp.IngestEndpoints {
+			if strings.EqualFold(endpoint.Protocol, "RTMP") {
+				t.Errorf("expected no RTMP endpoint, got %+v", endpoint)
+			}
+		}
+	})
+}
+
+func TestMockGoLiveHandler_DefaultScenario(t *testing.T) {
+	server := newMockGoLiveServer(t, MockScenarioPortrait)
+
+	resp, err := callGoLiveAPIWithURL(testContext(), "live_test_key", GoLiveOptions{}, server.URL+"/api/v3/GetClientConfiguration")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Meta.ConfigID != "mock-portrait" {
+		t.Errorf("expected the default scenario for an unknown path, got config %s", resp.Meta.ConfigID)
+	}
+}
+
+func TestMockGoLiveHandler_RejectsGet(t *testing.T) {
+	server := newMockGoLiveServer(t, MockScenarioSuccess)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected HTTP 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockGoLiveScenarios(t *testing.T) {
+	scenarios := MockGoLiveScenarios()
+	if len(scenarios) != 6 {
+		t.Errorf("expected 6 scenarios, got %v", scenarios)
+	}
+	if _, ok := MockGoLiveResponse("unknown", DefaultMockIngestURL, "key"); ok {
+		t.Error("expected unknown scenario to be rejected")
+	}
+}
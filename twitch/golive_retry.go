@@ -0,0 +1,79 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zozman/stream-webpage-container/utils"
+)
+
+// GoLiveHTTPError is returned when the Go Live API answers with a non-200 status.
+type GoLiveHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *GoLiveHTTPError) Error() string {
+	return fmt.Sprintf("Go Live API returned HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// IsRetryableGoLiveError reports whether a failed Go Live call may succeed if repeated:
+// network errors, timeouts, HTTP 429 and 5xx. Rejections of the request itself and
+// error statuses in the response are not retryable.
+func IsRetryableGoLiveError(err error) bool {
+	var httpErr *GoLiveHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// GoLiveRetryPolicy controls how retryable Go Live failures are retried.
+type GoLiveRetryPolicy struct {
+	// Retries is how many times a failed call is repeated (0 = called once)
+	Retries int
+	// InitialBackoff is the wait before the first retry; it doubles on each retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration
+}
+
+// CallGoLiveAPIWithRetry calls the Go Live API like CallGoLiveAPI, retrying retryable
+// failures with exponential backoff. It returns the last error once retries run out.
+func CallGoLiveAPIWithRetry(ctx context.Context, streamKey string, opts GoLiveOptions, policy GoLiveRetryPolicy) (*GoLiveResponse, error) {
+	logger := utils.GetLoggerFromContext(ctx)
+	backoff := policy.InitialBackoff
+
+	for attempt := 0; ; attempt++ {
+		resp, err := CallGoLiveAPI(ctx, streamKey, opts)
+		if err == nil || attempt >= policy.Retries || !IsRetryableGoLiveError(err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		logger.Warn("Go Live API call failed, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Int("retries", policy.Retries),
+			zap.Duration("retryIn", backoff),
+			zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
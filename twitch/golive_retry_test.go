@@ -0,0 +1,105 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = GoLiveRetryPolicy{Retries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+// newFlakyGoLiveServer fails the first failures calls with status, then succeeds.
+func newFlakyGoLiveServer(t *testing.T, failures int, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(atomic.AddInt32(&calls, 1)) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GoLiveResponse{Meta: GoLiveMeta{ConfigID: "recovered"}, Status: GoLiveStatus{Result: "success"}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestCallGoLiveAPIWithRetry_RecoversFromServerErrors(t *testing.T) {
+	server, calls := newFlakyGoLiveServer(t, 2, http.StatusServiceUnavailable)
+
+	resp, err := CallGoLiveAPIWithRetry(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL}, testRetryPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Meta.ConfigID != "recovered" {
+		t.Errorf("expected config_id recovered, got %s", resp.Meta.ConfigID)
+	}
+	if *calls != 3 {
+		t.Errorf("expected 3 calls, got %d", *calls)
+	}
+}
+
+func TestCallGoLiveAPIWithRetry_GivesUp(t *testing.T) {
+	server, calls := newFlakyGoLiveServer(t, 100, http.StatusBadGateway)
+
+	_, err := CallGoLiveAPIWithRetry(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL}, testRetryPolicy)
+	var httpErr *GoLiveHTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected the last HTTP 502 error, got %v", err)
+	}
+	if *calls != 4 {
+		t.Errorf("expected 1 call plus 3 retries, got %d", *calls)
+	}
+}
+
+func TestCallGoLiveAPIWithRetry_DoesNotRetryRejections(t *testing.T) {
+	server, calls := newFlakyGoLiveServer(t, 100, http.StatusBadRequest)
+
+	if _, err := CallGoLiveAPIWithRetry(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL}, testRetryPolicy); err == nil {
+		t.Fatal("expected error for HTTP 400, got nil")
+	}
+	if *calls != 1 {
+		t.Errorf("expected a single call, got %d", *calls)
+	}
+}
+
+func TestCallGoLiveAPIWithRetry_StopsOnCancel(t *testing.T) {
+	server, calls := newFlakyGoLiveServer(t, 100, http.StatusServiceUnavailable)
+	ctx, cancel := context.WithCancel(testContext())
+	cancel()
+
+	policy := GoLiveRetryPolicy{Retries: 3, InitialBackoff: time.Hour}
+	if _, err := CallGoLiveAPIWithRetry(ctx, "live_test_key", GoLiveOptions{APIURL: server.URL}, policy); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if *calls > 1 {
+		t.Errorf("expected no retries after cancellation, got %d calls", *calls)
+	}
+}
+
+func TestIsRetryableGoLiveError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"Service Unavailable", &GoLiveHTTPError{StatusCode: 503}, true},
+		{"Too Many Requests", &GoLiveHTTPError{StatusCode: 429}, true},
+		{"Bad Request", &GoLiveHTTPError{StatusCode: 400}, false},
+		{"Timeout", fmt.Errorf("Go Live API request failed: %w", context.DeadlineExceeded), true},
+		{"Error Status", errors.New("Go Live API returned error: GPU not supported"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsRetryableGoLiveError(tc.err); got != tc.retryable {
+				t.Errorf("expected retryable=%v, got %v", tc.retryable, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package twitch
+
+import "strconv"
+
+// GoLiveRequest2025 is the request body for schema "2025-01-25". It carries the same
+// information as GoLiveRequest, but system build and revision are strings and every
+// canvas, the primary one included, is listed in preferences.canvases. The response
+// layout is shared with "2024-06-04".
+type GoLiveRequest2025 struct {
+	Service        string                 `json:"service"`
+	SchemaVersion  string                 `json:"schema_version"`
+	Authentication string                 `json:"authentication"`
+	Client         GoLiveClient           `json:"client"`
+	Capabilities   GoLiveCapabilities2025 `json:"capabilities"`
+	Preferences    GoLivePreferences2025  `json:"preferences"`
+}
+
+type GoLiveCapabilities2025 struct {
+	CPU            GoLiveCPU        `json:"cpu"`
+	Memory         GoLiveMemory     `json:"memory"`
+	GPU            []GoLiveGPU      `json:"gpu"`
+	System         GoLiveSystem2025 `json:"system"`
+	GamingFeatures *interface{}     `json:"gaming_features"`
+}
+
+// GoLiveSystem2025 describes the OS, with Build and Revision as strings.
+type GoLiveSystem2025 struct {
+	Version      string `json:"version"`
+	Name         string `json:"name"`
+	Build        string `json:"build"`
+	Release      string `json:"release"`
+	Revision     string `json:"revision"`
+	Bits         int    `json:"bits"`
+	ARM          bool   `json:"arm"`
+	ARMEmulation bool   `json:"armEmulation"`
+}
+
+// GoLivePreferences2025 lists every canvas in Canvases; the first is the primary
+// (landscape) canvas and any others must be portrait.
+type GoLivePreferences2025 struct {
+	MaximumAggregateBitrate *int64         `json:"maximum_aggregate_bitrate"`
+	MaximumVideoTracks      *int           `json:"maximum_video_tracks"`
+	CompositionGPUIndex     int            `json:"composition_gpu_index"`
+	Canvases                []GoLiveCanvas `json:"canvases"`
+	AudioSamplesPerSec      int            `json:"audio_samples_per_sec"`
+	AudioChannels           int            `json:"audio_channels"`
+}
+
+// newGoLiveRequest2025 converts a "2024-06-04" request to the "2025-01-25" layout.
+func newGoLiveRequest2025(req GoLiveRequest) GoLiveRequest2025 {
+	caps := req.Capabilities
+	prefs := req.Preferences
+
+	canvases := []GoLiveCanvas{{
+		Width:        prefs.Width,
+		Height:       prefs.Height,
+		CanvasWidth:  prefs.CanvasWidth,
+		CanvasHeight: prefs.CanvasHeight,
+		Framerate:    prefs.Framerate,
+	}}
+	canvases = append(canvases, prefs.Canvases...)
+
+	return GoLiveRequest2025{
+		Service:        req.Service,
+		SchemaVersion:  GoLiveSchemaVersion2025,
+		Authentication: req.Authentication,
+		Client:         req.Client,
+		Capabilities: GoLiveCapabilities2025{
+			CPU:    caps.CPU,
+			Memory: caps.Memory,
+			GPU:    caps.GPU,
+			System: GoLiveSystem2025{
+				Version:      caps.System.Version,
+				Name:         caps.System.Name,
+				Build:        strconv.Itoa(caps.System.Build),
+				Release:      caps.System.Release,
+				Revision:     strconv.Itoa(caps.System.Revision),
+				Bits:         caps.System.Bits,
+				ARM:          caps.System.ARM,
+				ARMEmulation: caps.System.ARMEmulation,
+			},
+			GamingFeatures: caps.GamingFeatures,
+		},
+		Preferences: GoLivePreferences2025{
+			MaximumAggregateBitrate: prefs.MaximumAggregateBitrate,
+			MaximumVideoTracks:      prefs.MaximumVideoTracks,
+			CompositionGPUIndex:     prefs.CompositionGPUIndex,
+			Canvases:                canvases,
+			AudioSamplesPerSec:      prefs.AudioSamplesPerSec,
+			AudioChannels:           prefs.AudioChannels,
+		},
+	}
+}
+
+// GoLiveSchemaVersions returns the request schema versions that can be selected.
+func GoLiveSchemaVersions() []string {
+	return []string{GoLiveSchemaVersion, GoLiveSchemaVersion2025}
+}
@@ -0,0 +1,155 @@
+package twitch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewGoLiveRequest2025(t *testing.T) {
+	maxTracks := 4
+	req := GoLiveRequest{
+		Service:        GoLiveService,
+		SchemaVersion:  GoLiveSchemaVersion,
+		Authentication: "live_test_key",
+		Capabilities: GoLiveCapabilities{
+			System: GoLiveSystem{Name: "Linux", Build: 7, Revision: 3},
+		},
+		Preferences: GoLivePreferences{
+			MaximumVideoTracks: &maxTracks,
+			Width:              1280,
+			Height:             720,
+			CanvasWidth:        1280,
+			CanvasHeight:       720,
+			Framerate:          GoLiveFramerate{Numerator: 30, Denominator: 1},
+			Canvases:           []GoLiveCanvas{{Width: 720, Height: 1280, CanvasWidth: 720, CanvasHeight: 1280}},
+		},
+	}
+
+	req2025 := newGoLiveRequest2025(req)
+	if req2025.SchemaVersion != GoLiveSchemaVersion2025 {
+		t.Errorf("expected schema %s, got %s", GoLiveSchemaVersion2025, req2025.SchemaVersion)
+	}
+	if req2025.Capabilities.System.Build != "7" || req2025.Capabilities.System.Revision != "3" {
+		t.Errorf("expected string build and revision, got %+v", req2025.Capabilities.System)
+	}
+	canvases := req2025.Preferences.Canvases
+	if len(canvases) != 2 {
+		t.Fatalf("expected 2 canvases, got %d", len(canvases))
+	}
+	if canvases[0].Width != 1280 || canvases[0].Framerate.Numerator != 30 {
+		t.Errorf("expected the primary canvas first, got %+v", canvases[0])
+	}
+	if canvases[1].Height != 1280 {
+		t.Errorf("expected the portrait canvas second, got %+v", canvases[1])
+	}
+
+	body, err := encodeGoLiveRequest(req, GoLiveSchemaVersion2025)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+		Preferences  map[string]json.RawMessage `json:"preferences"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := decoded.Preferences["width"]; ok {
+		t.Error("expected no flat canvas fields in preferences")
+	}
+	if !strings.Contains(string(decoded.Capabilities["system"]), `"build":"7"`) {
+		t.Errorf("expected a string build, got %s", decoded.Capabilities["system"])
+	}
+
+	if _, err := encodeGoLiveRequest(req, "2023-05-10"); err == nil {
+		t.Error("expected error for an unsupported schema version")
+	}
+}
+
+// newCountingMockGoLiveServer serves the mock handler, counting requests by schema version.
+func newCountingMockGoLiveServer(t *testing.T, scenario string) (*httptest.Server, map[string]*int32) {
+	t.Helper()
+	logger, _ := zap.NewDevelopment()
+	mock := NewMockGoLiveHandler(logger, scenario, "rtmp://127.0.0.1:1935/live/{stream_key}")
+	counts := map[string]*int32{GoLiveSchemaVersion: new(int32), GoLiveSchemaVersion2025: new(int32)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var version struct {
+			SchemaVersion string `json:"schema_version"`
+		}
+		if err := json.Unmarshal(data, &version); err == nil {
+			if count, ok := counts[version.SchemaVersion]; ok {
+				atomic.AddInt32(count, 1)
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, counts
+}
+
+func TestCallGoLiveAPI_Schema2025(t *testing.T) {
+	server, counts := newCountingMockGoLiveServer(t, MockScenarioPortrait)
+
+	opts := GoLiveOptions{
+		APIURL:         server.URL,
+		SchemaVersion:  GoLiveSchemaVersion2025,
+		PortraitCanvas: &GoLiveCanvas{Width: 720, Height: 1280, CanvasWidth: 720, CanvasHeight: 1280},
+	}
+	resp, err := CallGoLiveAPI(testContext(), "live_test_key", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Meta.SchemaVersion != GoLiveSchemaVersion2025 {
+		t.Errorf("expected a %s response, got %s", GoLiveSchemaVersion2025, resp.Meta.SchemaVersion)
+	}
+	if len(resp.EncoderConfigurations) != 4 {
+		t.Errorf("expected 4 encoder configurations, got %d", len(resp.EncoderConfigurations))
+	}
+	if *counts[GoLiveSchemaVersion2025] != 1 || *counts[GoLiveSchemaVersion] != 0 {
+		t.Errorf("expected a single %s request, got %d and %d %s requests",
+			GoLiveSchemaVersion2025, *counts[GoLiveSchemaVersion2025], *counts[GoLiveSchemaVersion], GoLiveSchemaVersion)
+	}
+}
+
+func TestCallGoLiveAPI_Schema2025FallsBackOnBadRequest(t *testing.T) {
+	server, counts := newCountingMockGoLiveServer(t, MockScenarioLegacySchema)
+
+	resp, err := CallGoLiveAPI(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL, SchemaVersion: GoLiveSchemaVersion2025})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Meta.ConfigID != "mock-legacy-schema" || resp.Meta.SchemaVersion != GoLiveSchemaVersion {
+		t.Errorf("expected the %s response, got %+v", GoLiveSchemaVersion, resp.Meta)
+	}
+	if *counts[GoLiveSchemaVersion2025] != 1 || *counts[GoLiveSchemaVersion] != 1 {
+		t.Errorf("expected one request per schema, got %d and %d",
+			*counts[GoLiveSchemaVersion2025], *counts[GoLiveSchemaVersion])
+	}
+}
+
+func TestCallGoLiveAPI_Schema2025NoFallbackOnServerError(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := CallGoLiveAPI(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL, SchemaVersion: GoLiveSchemaVersion2025})
+	if err == nil {
+		t.Fatal("expected error for HTTP 503, got nil")
+	}
+	if calls != 1 {
+		t.Errorf("expected no schema fallback for HTTP 503, got %d calls", calls)
+	}
+}
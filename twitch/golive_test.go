@@ -222,3 +222,38 @@ func TestCallGoLiveAPI_InvalidJSON(t *testing.T) {
 		t.Fatal("expected error for invalid JSON, got nil")
 	}
 }
+
+func TestCallGoLiveAPI_CustomURL(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GoLiveResponse{Status: GoLiveStatus{Result: "success"}})
+	}))
+	defer server.Close()
+
+	ctx := testContext()
+	if _, err := CallGoLiveAPI(ctx, "live_test_key", GoLiveOptions{APIURL: server.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Error("expected the custom Go Live URL to be called")
+	}
+}
+
+func TestCallGoLiveAPI_MaxAggregateBitrate(t *testing.T) {
+	var received GoLiveRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(GoLiveResponse{Status: GoLiveStatus{Result: "success"}})
+	}))
+	defer server.Close()
+
+	bitrate := 8000
+	if _, err := CallGoLiveAPI(testContext(), "live_test_key", GoLiveOptions{APIURL: server.URL, MaxAggregateBitrate: &bitrate}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.Preferences.MaximumAggregateBitrate == nil || *received.Preferences.MaximumAggregateBitrate != 8000000 {
+		t.Errorf("expected maximum_aggregate_bitrate of 8000000 bps, got %v", received.Preferences.MaximumAggregateBitrate)
+	}
+}
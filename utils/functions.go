@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"context"
 	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 // Function gets the value of an environmental variable and returns a default value if the variable is not set.
@@ -11,3 +16,19 @@ func GetEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// Function reads a non-negative integer number of seconds from an environmental variable,
+// logging a warning and returning the default when the value is invalid.
+func GetSecondsFromEnv(ctx context.Context, key string, defaultSeconds int) time.Duration {
+	value := GetEnvOrDefault(key, "")
+	if value == "" {
+		return time.Duration(defaultSeconds) * time.Second
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		GetLoggerFromContext(ctx).Warn("Invalid seconds value, using default",
+			zap.String("key", key), zap.String("value", value), zap.Int("default", defaultSeconds))
+		return time.Duration(defaultSeconds) * time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 func TestGetEnvOrDefault(t *testing.T) {
@@ -28,3 +32,28 @@ func TestGetEnvOrDefault(t *testing.T) {
 		}
 	})
 }
+
+func TestGetSecondsFromEnv(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := SaveLoggerToContext(context.Background(), logger)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{"Unset Uses Default", "", 10 * time.Second},
+		{"Valid Value", "3", 3 * time.Second},
+		{"Zero Is Allowed", "0", 0},
+		{"Negative Uses Default", "-1", 10 * time.Second},
+		{"Invalid Uses Default", "ten", 10 * time.Second},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_SECONDS", tc.value)
+			if got := GetSecondsFromEnv(ctx, "TEST_SECONDS", 10); got != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}